@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/smashed-avo/go-crawler/lib/handler"
+	"github.com/smashed-avo/go-crawler/lib/output"
+)
+
+// listFlag is a flag that may be repeated, the first value replaces the configured list
+type listFlag struct {
+	list *[]string
+	set  bool
+}
+
+func (l *listFlag) String() string {
+	if l.list == nil {
+		return ""
+	}
+	return strings.Join(*l.list, ",")
+}
+
+func (l *listFlag) Set(v string) error {
+	if !l.set {
+		*l.list, l.set = nil, true
+	}
+	*l.list = append(*l.list, v)
+	return nil
+}
+
+// crawl runs a single crawl without the server. The result is written once the crawl is finished, or as the
+// sites are crawled with the ndjson format. An interrupted crawl writes its partial result
+func crawl(args []string) error {
+	fs := flag.NewFlagSet("crawl", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: go-crawler crawl [flags] <url>")
+		fs.PrintDefaults()
+	}
+	cfg, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	fs.IntVar(&cfg.Crawl.Depth, "depth", cfg.Crawl.Depth, "maximum depth of the crawl, the seed URL is always expanded")
+	fs.IntVar(&cfg.Crawl.Concurrency, "concurrency", cfg.Crawl.Concurrency, "number of pages fetched at the same time")
+	fs.DurationVar(&cfg.Crawl.Timeout, "timeout", cfg.Crawl.Timeout, "wall-clock budget of the crawl, 0 for no budget")
+	fs.BoolVar(&cfg.Crawl.Sitemaps, "sitemaps", cfg.Crawl.Sitemaps, "also crawl the pages listed in the sitemaps of the site")
+	fs.StringVar(&cfg.Crawl.Strategy, "strategy", cfg.Crawl.Strategy, "order the sites of every host are fetched in: bfs, dfs or best")
+	fs.StringVar(&cfg.Crawl.Scorer, "scorer", cfg.Crawl.Scorer, "ranking of a best first crawl: segments, keywords or inlinks")
+	fs.Var(&listFlag{list: &cfg.Crawl.Keywords}, "keyword", "keyword ranking the URLs of a best first crawl, may be repeated")
+	fs.Int64Var(&cfg.Crawl.Seed, "seed", cfg.Crawl.Seed, "fetch a site at a time and break ties with this seed so the crawl is reproducible, 0 for none")
+	fs.StringVar(&cfg.Crawl.Mode, "mode", cfg.Crawl.Mode, "crawl, or linkcheck to report the broken links of every page in scope")
+	fs.IntVar(&cfg.Limits.MaxPages, "max-pages", cfg.Limits.MaxPages, "maximum number of pages fetched, 0 for no limit")
+	fs.IntVar(&cfg.Limits.MaxLinksPerPage, "max-links-per-page", cfg.Limits.MaxLinksPerPage, "maximum number of links followed per page, 0 for no limit")
+	fs.IntVar(&cfg.Limits.MaxPagesPerHost, "max-pages-per-host", cfg.Limits.MaxPagesPerHost, "maximum number of pages fetched per host, 0 for no limit")
+	fs.StringVar(&cfg.Scope.Mode, "scope", cfg.Scope.Mode, "links followed: all, host, domain or path")
+	fs.StringVar(&cfg.Scope.PathPrefix, "path-prefix", cfg.Scope.PathPrefix, "path prefix of the path scope, the directory of the seed URL by default")
+	fs.Var(&listFlag{list: &cfg.Scope.Include}, "include", "regular expression of the URLs followed, may be repeated")
+	fs.Var(&listFlag{list: &cfg.Scope.Exclude}, "exclude", "regular expression of the URLs not followed, may be repeated")
+	fs.StringVar(&cfg.Output.Format, "format", cfg.Output.Format, "output format: json, ndjson, dot, graphml, gexf or sitemap")
+	fs.StringVar(&cfg.Output.Shape, "shape", cfg.Output.Shape, "shape of the json output: tree or graph")
+	out := fs.String("o", "", "output file, stdout when empty")
+	hostFlags(fs, &cfg.Politeness)
+	cacheFlags(fs, &cfg.Cache)
+	dedupFlags(fs, &cfg.Dedup)
+
+	// Flags are accepted before and after the URL
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	rawURL := fs.Arg(0)
+	if fs.NArg() > 1 {
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() > 0 {
+			return fmt.Errorf("crawl: unexpected argument %q", fs.Arg(0))
+		}
+	}
+	if rawURL == "" {
+		fs.Usage()
+		return fmt.Errorf("crawl: missing url")
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if cfg.Output.Format == output.FormatSSE {
+		return fmt.Errorf("crawl: format %s is only served over HTTP", cfg.Output.Format)
+	}
+	// The settings are the defaults of the crawl parameters of the API, a linkcheck crawl crawls every page
+	// of the seed host unless the -depth flag or a scope is given
+	q := url.Values{"url": {rawURL}}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "depth" {
+			q.Set("depth", strconv.Itoa(cfg.Crawl.Depth))
+		}
+	})
+	u, depth, opts, err := handler.ParseCrawl(q, crawlDefaults(cfg))
+	if err != nil {
+		return err
+	}
+
+	// Interrupting the crawl stops it, the partial result is still written
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	pages, err := openCache(cfg)
+	if err != nil {
+		return err
+	}
+	if pages != nil {
+		defer pages.Close()
+	}
+
+	c := newCrawler(cfg, pages)
+	write := func(w io.Writer) error {
+		if output.Streamed(cfg.Output.Format) {
+			s := output.NewStream(w, cfg.Output.Format)
+			opts.Observer = s
+			s.Finish(c.Crawl(ctx, u, depth, opts))
+			return nil
+		}
+		o, err := output.New(c.Crawl(ctx, u, depth, opts), cfg.Output.Format, cfg.Output.Shape)
+		if err != nil {
+			return err
+		}
+		return o.Write(w)
+	}
+	if *out == "" {
+		return write(os.Stdout)
+	}
+	return writeFile(*out, write)
+}
+
+// writeFile writes to a temporary file next to path and renames it to path once the write succeeded, so a
+// failed crawl neither leaves an empty file nor replaces an existing one
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
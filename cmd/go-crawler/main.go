@@ -1,39 +1,173 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"log"
 	"net/http"
-	"time"
-
-	"goji.io"
-	"goji.io/pat"
+	"os"
+	"strings"
 
+	"github.com/smashed-avo/go-crawler/lib/cache"
+	"github.com/smashed-avo/go-crawler/lib/config"
 	"github.com/smashed-avo/go-crawler/lib/crawler"
+	"github.com/smashed-avo/go-crawler/lib/data"
 	"github.com/smashed-avo/go-crawler/lib/handler"
+	"github.com/smashed-avo/go-crawler/lib/linkcheck"
 	"github.com/smashed-avo/go-crawler/lib/links"
+	"github.com/smashed-avo/go-crawler/lib/robots"
+	"github.com/smashed-avo/go-crawler/lib/scheduler"
+	"github.com/smashed-avo/go-crawler/lib/sitemap"
 	"github.com/smashed-avo/go-crawler/lib/worker"
 )
 
-const port = "8000"
+const usage = `Usage:
+  go-crawler serve [flags]        start the HTTP server, the default without a command
+  go-crawler crawl [flags] <url>  crawl a site and write the result to stdout or a file
+
+Run go-crawler <command> -h for the flags of a command.
+`
 
-// main sets the router and starts the serves
+// main runs the requested command, the server when none is given
 func main() {
-	h := getHandler()
-	mux := goji.NewMux()
-	mux.HandleFunc(pat.Get("/crawl"), h.HandleCrawl)
-	fmt.Printf("Server started. Listening on port %s.\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, mux))
+	args := os.Args[1:]
+	cmd := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	var err error
+	switch cmd {
+	case "serve":
+		err = serve(args)
+	case "crawl":
+		err = crawl(args)
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
 
-func getHandler() *handler.Handler {
-	// Set timeout to 15s
-	client := &http.Client{
-		Timeout: 15 * time.Second,
+// loadConfig loads the configuration file named by the -config flag or the environment, the other flags are
+// bound to the loaded settings so they override them
+func loadConfig(fs *flag.FlagSet, args []string) (*config.Config, error) {
+	path := configPath(args)
+	fs.String("config", path, "YAML or JSON configuration file (env "+config.EnvFile+")")
+	return config.Load(path)
+}
+
+// configPath finds the -config flag before the flags are parsed
+func configPath(args []string) string {
+	for i, a := range args {
+		if a == "--" || !strings.HasPrefix(a, "-") {
+			continue
+		}
+		name := strings.TrimLeft(a, "-")
+		if name == "config" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(name, "config=") {
+			return strings.TrimPrefix(name, "config=")
+		}
 	}
-	l := links.NewCollector(client)
-	w := worker.NewWorker(l)
-	c := crawler.NewCrawler(w)
+	return os.Getenv(config.EnvFile)
+}
+
+// hostFlags registers the per host politeness limits, overridden per crawl
+func hostFlags(fs *flag.FlagSet, p *config.Politeness) {
+	fs.IntVar(&p.HostConcurrency, "host-concurrency", p.HostConcurrency, "maximum number of concurrent requests to a host, 0 for no limit")
+	fs.DurationVar(&p.HostDelay, "host-delay", p.HostDelay, "minimum delay between requests to a host")
+	fs.Float64Var(&p.HostRPS, "host-rps", p.HostRPS, "maximum requests per second to a host, 0 for no limit")
+	fs.BoolVar(&p.Robots, "robots", p.Robots, "honour robots.txt rules and Crawl-delay")
+}
+
+// cacheFlags registers the page cache settings
+func cacheFlags(fs *flag.FlagSet, c *config.Cache) {
+	fs.BoolVar(&c.Enabled, "cache", c.Enabled, "revalidate the pages of previous crawls with conditional requests")
+	fs.StringVar(&c.File, "cache-file", c.File, "file keeping the page cache between runs, in memory when empty")
+}
 
-	return handler.NewHandler(c)
+// dedupFlags registers the near duplicate settings
+func dedupFlags(fs *flag.FlagSet, d *config.Dedup) {
+	fs.BoolVar(&d.Near, "near-duplicates", d.Near, "report the pages whose text nearly duplicates a page already crawled")
+	fs.IntVar(&d.NearDistance, "near-distance", d.NearDistance, "number of bits the text fingerprints of near duplicates differ by at most")
+	fs.BoolVar(&d.SkipNear, "skip-near-duplicates", d.SkipNear, "do not expand the near duplicates")
+}
+
+// openCache returns the page cache, nil when it is disabled
+func openCache(cfg *config.Config) (*cache.Cache, error) {
+	if !cfg.Cache.Enabled {
+		return nil, nil
+	}
+	return cache.NewCache(cache.WithFile(cfg.Cache.File), cache.WithFlushInterval(cfg.Cache.FlushInterval))
+}
+
+// crawlDefaults returns the crawl parameters used when a crawl does not set them, by the API and the crawl
+// command alike
+func crawlDefaults(cfg *config.Config) handler.Defaults {
+	return handler.Defaults{
+		Depth:          cfg.Crawl.Depth,
+		MaxConcurrency: cfg.Crawl.MaxConcurrency,
+		Sitemaps:       cfg.Crawl.Sitemaps,
+		Scope:          cfg.Scope.Mode,
+		PathPrefix:     cfg.Scope.PathPrefix,
+		Include:        cfg.Scope.Include,
+		Exclude:        cfg.Scope.Exclude,
+		Scorer:         cfg.Crawl.Scorer,
+		Keywords:       cfg.Crawl.Keywords,
+		Seed:           cfg.Crawl.Seed,
+		Mode:           cfg.Crawl.Mode,
+		Format:         cfg.Output.Format,
+		Shape:          cfg.Output.Shape,
+	}
+}
+
+// newCrawler wires the collector, robots.txt, the sitemaps, the link checker and the near duplicate
+// detection into a crawler, pages are revalidated when a cache is set
+func newCrawler(cfg *config.Config, pages *cache.Cache) *crawler.Crawler {
+	// Redirects are recorded hop by hop and loops are stopped
+	client := &http.Client{
+		Timeout:       cfg.Client.Timeout,
+		CheckRedirect: links.CheckRedirect,
+	}
+	collectorOpts := []links.Option{links.WithUserAgent(cfg.Client.UserAgent), links.WithMaxRedirects(cfg.Client.MaxRedirects)}
+	if pages != nil {
+		collectorOpts = append(collectorOpts, links.WithCache(pages))
+	}
+	l := links.NewCollector(client, collectorOpts...)
+	r := robots.NewRobots(client, cfg.Client.UserAgent)
+	opts := []crawler.Option{
+		crawler.WithConcurrency(cfg.Crawl.Concurrency),
+		crawler.WithTimeout(cfg.Crawl.Timeout),
+		crawler.WithHostLimits(scheduler.Limits{
+			MaxConcurrent: cfg.Politeness.HostConcurrency,
+			MinDelay:      cfg.Politeness.HostDelay,
+			RPS:           cfg.Politeness.HostRPS,
+		}),
+		crawler.WithLimits(data.Limits{
+			MaxPages:        cfg.Limits.MaxPages,
+			MaxLinksPerPage: cfg.Limits.MaxLinksPerPage,
+			MaxPagesPerHost: cfg.Limits.MaxPagesPerHost,
+		}),
+		crawler.WithStrategy(cfg.Crawl.Strategy),
+		crawler.WithSitemaps(sitemap.NewSeeder(client, r, sitemap.WithUserAgent(cfg.Client.UserAgent))),
+		crawler.WithLinkChecker(linkcheck.NewChecker(client, linkcheck.WithUserAgent(cfg.Client.UserAgent))),
+	}
+	if cfg.Dedup.Near {
+		opts = append(opts, crawler.WithNearDuplicates(cfg.Dedup.NearDistance, cfg.Dedup.SkipNear))
+	}
+	workerOpts := make([]worker.Option, 0)
+	if cfg.Politeness.Robots {
+		workerOpts = append(workerOpts, worker.WithRobots(r))
+		opts = append(opts, crawler.WithCrawlDelay(r))
+	}
+	return crawler.NewCrawler(worker.NewWorker(l, workerOpts...), opts...)
 }
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"goji.io"
+	"goji.io/pat"
+
+	"github.com/smashed-avo/go-crawler/lib/cache"
+	"github.com/smashed-avo/go-crawler/lib/config"
+	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/handler"
+	"github.com/smashed-avo/go-crawler/lib/jobs"
+	"github.com/smashed-avo/go-crawler/lib/store"
+)
+
+// shutdownTimeout is how long the requests in flight are given to finish when the server stops
+const shutdownTimeout = 10 * time.Second
+
+// serve sets the router and starts the server, it stops on SIGINT or SIGTERM
+func serve(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	cfg, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	fs.StringVar(&cfg.Server.Addr, "addr", cfg.Server.Addr, "listen address, every interface when empty (env GO_CRAWLER_ADDR)")
+	fs.IntVar(&cfg.Server.Port, "port", cfg.Server.Port, "listen port (env GO_CRAWLER_PORT)")
+	fs.IntVar(&cfg.Crawl.MaxConcurrency, "max-concurrency", cfg.Crawl.MaxConcurrency, "largest concurrency parameter accepted by /crawl (env GO_CRAWLER_MAX_CONCURRENCY)")
+	// Per host politeness limits, overridden per request by /crawl parameters
+	hostFlags(fs, &cfg.Politeness)
+	cacheFlags(fs, &cfg.Cache)
+	dedupFlags(fs, &cfg.Dedup)
+	// Asynchronous crawls submitted to /crawls
+	fs.IntVar(&cfg.Jobs.Workers, "jobs", cfg.Jobs.Workers, "number of asynchronous crawls run at the same time")
+	fs.IntVar(&cfg.Jobs.QueueSize, "job-queue", cfg.Jobs.QueueSize, "number of asynchronous crawls waiting to run")
+	fs.StringVar(&cfg.Jobs.Store, "job-store", cfg.Jobs.Store, "file keeping the asynchronous crawls across restarts, in memory when empty")
+	fs.BoolVar(&cfg.Jobs.Resume, "job-resume", cfg.Jobs.Resume, "resume the asynchronous crawls interrupted by the last shutdown")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("serve: unexpected argument %q", fs.Arg(0))
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	// The default concurrency of the API is bounded like the requested one, the crawl command is not
+	if cfg.Crawl.Concurrency > cfg.Crawl.MaxConcurrency {
+		return fmt.Errorf("serve: crawl.concurrency %d is above crawl.max_concurrency %d", cfg.Crawl.Concurrency, cfg.Crawl.MaxConcurrency)
+	}
+
+	pages, err := openCache(cfg)
+	if err != nil {
+		return err
+	}
+	if pages != nil {
+		defer pages.Close()
+	}
+
+	var st *store.Store
+	if cfg.Jobs.Store != "" {
+		if st, err = store.NewStore(cfg.Jobs.Store); err != nil {
+			return err
+		}
+		defer st.Close()
+	}
+
+	h, j := getHandler(cfg, pages, st)
+	// Running crawls are saved as interrupted before the store is closed
+	defer j.Close()
+	mux := goji.NewMux()
+	mux.HandleFunc(pat.Get("/crawl"), h.HandleCrawl)
+	mux.HandleFunc(pat.Post("/crawls"), h.HandleSubmit)
+	mux.HandleFunc(pat.Get("/crawls/:id"), h.HandleStatus)
+	mux.HandleFunc(pat.Get("/crawls/:id/result"), h.HandleResult)
+	mux.HandleFunc(pat.Delete("/crawls/:id"), h.HandleCancel)
+	mux.HandleFunc(pat.Post("/crawls/:id/resume"), h.HandleResume)
+
+	srv := &http.Server{Addr: net.JoinHostPort(cfg.Server.Addr, strconv.Itoa(cfg.Server.Port)), Handler: mux}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	chErr := make(chan error, 1)
+	go func() {
+		chErr <- srv.ListenAndServe()
+	}()
+	fmt.Printf("Server started. Listening on %s.\n", srv.Addr)
+
+	select {
+	case err := <-chErr:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+// getHandler wires the crawler and the job manager into the handler, jobs are kept in the store when set
+func getHandler(cfg *config.Config, pages *cache.Cache, st *store.Store) (*handler.Handler, *jobs.Manager) {
+	c := newCrawler(cfg, pages)
+	defaults := crawlDefaults(cfg)
+	jobOpts := []jobs.Option{
+		jobs.WithWorkers(cfg.Jobs.Workers),
+		jobs.WithQueueSize(cfg.Jobs.QueueSize),
+		jobs.WithRetention(cfg.Jobs.Retention),
+		jobs.WithRetainedJobs(cfg.Jobs.Retained),
+	}
+	if st != nil {
+		parse := func(params url.Values) (*url.URL, int, data.Options, error) {
+			return handler.ParseCrawl(params, defaults)
+		}
+		jobOpts = append(jobOpts, jobs.WithStore(st, parse), jobs.WithCheckpointInterval(cfg.Jobs.CheckpointInterval))
+		if cfg.Jobs.Resume {
+			jobOpts = append(jobOpts, jobs.WithAutoResume())
+		}
+	}
+	j := jobs.NewManager(c, jobOpts...)
+	return handler.NewHandler(c, handler.WithJobs(j), handler.WithDefaults(defaults)), j
+}
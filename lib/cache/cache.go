@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+)
+
+// DefaultFlushInterval is how often a file cache writes its changes to disk
+const DefaultFlushInterval = time.Minute
+
+// Entry is what is kept of a fetched page to revalidate it on a later crawl
+type Entry struct {
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"last_modified,omitempty"`
+	BodyHash     string      `json:"body_hash"`
+	ContentType  string      `json:"content_type,omitempty"`
+	Title        string      `json:"title"`
+	Links        []data.Link `json:"links"`
+	Canonical    string      `json:"canonical,omitempty"`
+	ContentHash  string      `json:"content_hash,omitempty"`
+	SimHash      uint64      `json:"simhash,omitempty"`
+	Stored       time.Time   `json:"stored"`
+}
+
+// Cache stores the pages fetched by the crawls keyed by URL, it is safe for concurrent use
+type Cache struct {
+	sync.RWMutex
+	entries  map[string]*Entry
+	path     string
+	interval time.Duration
+	dirty    bool
+	done     chan struct{}
+	closed   sync.Once
+	wg       sync.WaitGroup
+}
+
+// Option sets a setting of the cache
+type Option func(*Cache)
+
+// WithFile keeps the cache in a JSON file, loaded when the cache is created and written as it changes
+func WithFile(path string) Option {
+	return func(c *Cache) {
+		c.path = path
+	}
+}
+
+// WithFlushInterval sets how often the changes of a file cache are written to disk
+func WithFlushInterval(d time.Duration) Option {
+	return func(c *Cache) {
+		if d > 0 {
+			c.interval = d
+		}
+	}
+}
+
+// NewCache returns a pointer to a new cache, in memory unless a file is set. The entries of an existing
+// file are loaded and changes are written to it in the background until the cache is closed
+func NewCache(opts ...Option) (*Cache, error) {
+	c := &Cache{entries: make(map[string]*Entry), interval: DefaultFlushInterval, done: make(chan struct{})}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.path == "" {
+		return c, nil
+	}
+
+	b, err := os.ReadFile(c.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &c.entries); err != nil {
+			return nil, err
+		}
+	}
+
+	c.wg.Add(1)
+	go c.flushLoop()
+	return c, nil
+}
+
+// Get returns the entry of a URL
+func (c *Cache) Get(url string) (*Entry, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	e, ok := c.entries[url]
+	return e, ok
+}
+
+// Put stores the entry of a URL
+func (c *Cache) Put(url string, e *Entry) {
+	c.Lock()
+	defer c.Unlock()
+	c.entries[url] = e
+	c.dirty = true
+}
+
+// Len returns the number of entries
+func (c *Cache) Len() int {
+	c.RLock()
+	defer c.RUnlock()
+	return len(c.entries)
+}
+
+// Flush writes the entries to the file of the cache when they changed since the last write. The file is
+// replaced atomically so a crash does not leave it half written
+func (c *Cache) Flush() (err error) {
+	if c.path == "" {
+		return nil
+	}
+	c.Lock()
+	if !c.dirty {
+		c.Unlock()
+		return nil
+	}
+	b, err := json.Marshal(c.entries)
+	c.dirty = false
+	c.Unlock()
+	// Changes are written again on the next flush when this one fails
+	defer func() {
+		if err != nil {
+			c.Lock()
+			c.dirty = true
+			c.Unlock()
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// Close stops the background writes and writes the last changes
+func (c *Cache) Close() error {
+	if c.path == "" {
+		return nil
+	}
+	c.closed.Do(func() { close(c.done) })
+	c.wg.Wait()
+	return c.Flush()
+}
+
+// flushLoop writes the changes at every interval until the cache is closed
+func (c *Cache) flushLoop() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.Flush(); err != nil {
+				println(err.Error())
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
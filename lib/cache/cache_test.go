@@ -0,0 +1,96 @@
+package cache_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smashed-avo/go-crawler/lib/cache"
+	"github.com/smashed-avo/go-crawler/lib/data"
+)
+
+var entry = &cache.Entry{
+	ETag:         `"v1"`,
+	LastModified: "Mon, 05 Oct 2026 10:00:00 GMT",
+	BodyHash:     "0123456789abcdef",
+	ContentType:  "text/html",
+	Title:        "Success Web",
+	Links:        []data.Link{{URL: "https://www.successweb.com/about", Text: "About"}},
+	Stored:       time.Date(2026, 10, 5, 10, 0, 0, 0, time.UTC),
+}
+
+func TestCache(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name          string
+		content       string
+		reopen        func(c *cache.Cache)
+		expectedFound bool
+		expectedError bool
+	}{
+		{
+			name:          "Written on close",
+			reopen:        func(c *cache.Cache) { assert.NoError(c.Close()) },
+			expectedFound: true,
+		},
+		{
+			name: "Written on flush interval",
+			reopen: func(c *cache.Cache) {
+				time.Sleep(50 * time.Millisecond)
+			},
+			expectedFound: true,
+		},
+		{
+			name:          "Corrupt file",
+			content:       "{not json",
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cache.json")
+			if tc.content != "" {
+				require.NoError(t, os.WriteFile(path, []byte(tc.content), 0644))
+			}
+
+			c, err := cache.NewCache(cache.WithFile(path), cache.WithFlushInterval(10*time.Millisecond))
+			assert.Equal(tc.expectedError, err != nil, tc.name)
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			c.Put("https://www.successweb.com", entry)
+			tc.reopen(c)
+
+			reopened, err := cache.NewCache(cache.WithFile(path))
+			require.NoError(t, err)
+			defer reopened.Close()
+			e, found := reopened.Get("https://www.successweb.com")
+			assert.Equal(tc.expectedFound, found, tc.name)
+			assert.Equal(entry, e, tc.name)
+			assert.Equal(1, reopened.Len(), tc.name)
+		})
+	}
+}
+
+func TestCacheMemory(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := cache.NewCache()
+	assert.NoError(err)
+	_, found := c.Get("https://www.successweb.com")
+	assert.False(found)
+
+	c.Put("https://www.successweb.com", entry)
+	e, found := c.Get("https://www.successweb.com")
+	assert.True(found)
+	assert.Equal(entry, e)
+	assert.NoError(c.Flush())
+	assert.NoError(c.Close())
+}
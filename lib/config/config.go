@@ -0,0 +1,328 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/dedup"
+	"github.com/smashed-avo/go-crawler/lib/frontier"
+	"github.com/smashed-avo/go-crawler/lib/output"
+	"github.com/smashed-avo/go-crawler/lib/robots"
+	"github.com/smashed-avo/go-crawler/lib/scope"
+	"github.com/smashed-avo/go-crawler/lib/simhash"
+)
+
+// EnvFile is the environment variable naming the configuration file when no file is given
+const EnvFile = "GO_CRAWLER_CONFIG"
+
+// Config holds every setting of the service, loaded from the defaults, a YAML or JSON file and the environment
+type Config struct {
+	Server     Server     `yaml:"server"`
+	Client     Client     `yaml:"client"`
+	Politeness Politeness `yaml:"politeness"`
+	Scope      Scope      `yaml:"scope"`
+	Limits     Limits     `yaml:"limits"`
+	Crawl      Crawl      `yaml:"crawl"`
+	Jobs       Jobs       `yaml:"jobs"`
+	Output     Output     `yaml:"output"`
+	Cache      Cache      `yaml:"cache"`
+	Dedup      Dedup      `yaml:"dedup"`
+}
+
+// Server is the listen address of the HTTP server
+type Server struct {
+	Addr string `yaml:"addr"`
+	Port int    `yaml:"port"`
+}
+
+// Client sets the HTTP client fetching pages, robots.txt and sitemaps
+type Client struct {
+	Timeout      time.Duration `yaml:"timeout"`
+	UserAgent    string        `yaml:"user_agent"`
+	MaxRedirects int           `yaml:"max_redirects"`
+}
+
+// Politeness sets the limits applied to every host
+type Politeness struct {
+	Robots          bool          `yaml:"robots"`
+	HostConcurrency int           `yaml:"host_concurrency"`
+	HostDelay       time.Duration `yaml:"host_delay"`
+	HostRPS         float64       `yaml:"host_rps"`
+}
+
+// Scope sets the links followed by crawls that do not set their own scope, every link when empty
+type Scope struct {
+	Mode       string   `yaml:"mode"`
+	PathPrefix string   `yaml:"path_prefix"`
+	Include    []string `yaml:"include"`
+	Exclude    []string `yaml:"exclude"`
+}
+
+// Limits sets the size limits of a crawl, 0 for no limit
+type Limits struct {
+	MaxPages        int `yaml:"max_pages"`
+	MaxLinksPerPage int `yaml:"max_links_per_page"`
+	MaxPagesPerHost int `yaml:"max_pages_per_host"`
+}
+
+// Crawl sets the defaults of a crawl
+type Crawl struct {
+	Depth          int           `yaml:"depth"`
+	Concurrency    int           `yaml:"concurrency"`
+	MaxConcurrency int           `yaml:"max_concurrency"`
+	Timeout        time.Duration `yaml:"timeout"`
+	Sitemaps       bool          `yaml:"sitemaps"`
+	Strategy       string        `yaml:"strategy"`
+	Scorer         string        `yaml:"scorer"`
+	Keywords       []string      `yaml:"keywords"`
+	Seed           int64         `yaml:"seed"`
+	Mode           string        `yaml:"mode"`
+}
+
+// Jobs sets the pool running the asynchronous crawls, they are kept in memory unless a store file is set
+type Jobs struct {
+	Workers            int           `yaml:"workers"`
+	QueueSize          int           `yaml:"queue_size"`
+	Store              string        `yaml:"store"`
+	CheckpointInterval time.Duration `yaml:"checkpoint_interval"`
+	Resume             bool          `yaml:"resume"`
+	Retention          time.Duration `yaml:"retention"`
+	Retained           int           `yaml:"retained"`
+}
+
+// Output sets the default format of the crawl results
+type Output struct {
+	Format string `yaml:"format"`
+	Shape  string `yaml:"shape"`
+}
+
+// Cache sets the page cache revalidating the pages of previous crawls, in memory unless a file is set
+type Cache struct {
+	Enabled       bool          `yaml:"enabled"`
+	File          string        `yaml:"file"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+}
+
+// Dedup sets the detection of near duplicates, the pages whose text fingerprints differ by at most
+// near_distance bits from the one of a page already crawled
+type Dedup struct {
+	Near         bool `yaml:"near"`
+	NearDistance int  `yaml:"near_distance"`
+	SkipNear     bool `yaml:"skip_near"`
+}
+
+// Default returns the settings used when neither the file nor the environment sets them. Robots.txt, the
+// host limits, near duplicates and long redirect chains are off so a crawl returns the same sites as without
+// a configuration
+func Default() *Config {
+	return &Config{
+		Server: Server{Port: 8000},
+		Client: Client{Timeout: 15 * time.Second, UserAgent: robots.DefaultUserAgent},
+		Crawl:  Crawl{Depth: 2, Concurrency: 10, MaxConcurrency: 100},
+		Jobs:   Jobs{Workers: 2, QueueSize: 100, CheckpointInterval: 30 * time.Second, Retention: time.Hour, Retained: 100},
+		Output: Output{Format: output.FormatJSON, Shape: output.ShapeTree},
+		Cache:  Cache{FlushInterval: time.Minute},
+		Dedup:  Dedup{NearDistance: dedup.DefaultNearDistance},
+	}
+}
+
+// Load returns the default settings overridden by a configuration file, when path is set, and then by the
+// environment. JSON files are read as YAML, unknown keys are rejected
+func Load(path string) (*Config, error) {
+	c := Default()
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("config: %v", err)
+		}
+		if err := c.decode(b); err != nil {
+			return nil, fmt.Errorf("config %s: %v", path, err)
+		}
+	}
+	if err := c.env(os.LookupEnv); err != nil {
+		return nil, fmt.Errorf("config: %v", err)
+	}
+	return c, nil
+}
+
+// decode overrides the settings set in a YAML or JSON document
+func (c *Config) decode(b []byte) error {
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// env overrides the settings set in the environment, lists are comma separated
+func (c *Config) env(lookup func(string) (string, bool)) error {
+	for _, v := range c.vars() {
+		s, ok := lookup(v.name)
+		if !ok {
+			continue
+		}
+		var err error
+		switch p := v.ptr.(type) {
+		case *string:
+			*p = s
+		case *int:
+			*p, err = strconv.Atoi(s)
+		case *int64:
+			*p, err = strconv.ParseInt(s, 10, 64)
+		case *float64:
+			*p, err = strconv.ParseFloat(s, 64)
+		case *bool:
+			*p, err = strconv.ParseBool(s)
+		case *time.Duration:
+			*p, err = time.ParseDuration(s)
+		case *[]string:
+			*p = splitList(s)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %q", v.name, s)
+		}
+	}
+	return nil
+}
+
+// envVar binds an environment variable to a setting
+type envVar struct {
+	name string
+	ptr  interface{}
+}
+
+// vars returns the environment variables overriding the settings
+func (c *Config) vars() []envVar {
+	return []envVar{
+		{"GO_CRAWLER_ADDR", &c.Server.Addr},
+		{"GO_CRAWLER_PORT", &c.Server.Port},
+		{"GO_CRAWLER_CLIENT_TIMEOUT", &c.Client.Timeout},
+		{"GO_CRAWLER_USER_AGENT", &c.Client.UserAgent},
+		{"GO_CRAWLER_MAX_REDIRECTS", &c.Client.MaxRedirects},
+		{"GO_CRAWLER_ROBOTS", &c.Politeness.Robots},
+		{"GO_CRAWLER_HOST_CONCURRENCY", &c.Politeness.HostConcurrency},
+		{"GO_CRAWLER_HOST_DELAY", &c.Politeness.HostDelay},
+		{"GO_CRAWLER_HOST_RPS", &c.Politeness.HostRPS},
+		{"GO_CRAWLER_SCOPE", &c.Scope.Mode},
+		{"GO_CRAWLER_PATH_PREFIX", &c.Scope.PathPrefix},
+		{"GO_CRAWLER_INCLUDE", &c.Scope.Include},
+		{"GO_CRAWLER_EXCLUDE", &c.Scope.Exclude},
+		{"GO_CRAWLER_MAX_PAGES", &c.Limits.MaxPages},
+		{"GO_CRAWLER_MAX_LINKS_PER_PAGE", &c.Limits.MaxLinksPerPage},
+		{"GO_CRAWLER_MAX_PAGES_PER_HOST", &c.Limits.MaxPagesPerHost},
+		{"GO_CRAWLER_DEPTH", &c.Crawl.Depth},
+		{"GO_CRAWLER_CONCURRENCY", &c.Crawl.Concurrency},
+		{"GO_CRAWLER_MAX_CONCURRENCY", &c.Crawl.MaxConcurrency},
+		{"GO_CRAWLER_TIMEOUT", &c.Crawl.Timeout},
+		{"GO_CRAWLER_SITEMAPS", &c.Crawl.Sitemaps},
+		{"GO_CRAWLER_STRATEGY", &c.Crawl.Strategy},
+		{"GO_CRAWLER_SCORER", &c.Crawl.Scorer},
+		{"GO_CRAWLER_KEYWORDS", &c.Crawl.Keywords},
+		{"GO_CRAWLER_SEED", &c.Crawl.Seed},
+		{"GO_CRAWLER_MODE", &c.Crawl.Mode},
+		{"GO_CRAWLER_JOBS", &c.Jobs.Workers},
+		{"GO_CRAWLER_JOB_QUEUE", &c.Jobs.QueueSize},
+		{"GO_CRAWLER_JOB_STORE", &c.Jobs.Store},
+		{"GO_CRAWLER_JOB_CHECKPOINT_INTERVAL", &c.Jobs.CheckpointInterval},
+		{"GO_CRAWLER_JOB_RESUME", &c.Jobs.Resume},
+		{"GO_CRAWLER_JOB_RETENTION", &c.Jobs.Retention},
+		{"GO_CRAWLER_JOB_RETAINED", &c.Jobs.Retained},
+		{"GO_CRAWLER_FORMAT", &c.Output.Format},
+		{"GO_CRAWLER_SHAPE", &c.Output.Shape},
+		{"GO_CRAWLER_CACHE", &c.Cache.Enabled},
+		{"GO_CRAWLER_CACHE_FILE", &c.Cache.File},
+		{"GO_CRAWLER_CACHE_FLUSH_INTERVAL", &c.Cache.FlushInterval},
+		{"GO_CRAWLER_NEAR_DUPLICATES", &c.Dedup.Near},
+		{"GO_CRAWLER_NEAR_DISTANCE", &c.Dedup.NearDistance},
+		{"GO_CRAWLER_SKIP_NEAR_DUPLICATES", &c.Dedup.SkipNear},
+	}
+}
+
+// splitList splits a comma separated list, ignoring empty items
+func splitList(s string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// ValidationError lists the invalid settings of a configuration
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid config: " + strings.Join(e, "; ")
+}
+
+// Validate checks every setting, the error lists all the invalid ones
+func (c *Config) Validate() error {
+	errs := make(ValidationError, 0)
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port must be between 1 and 65535, got %d", c.Server.Port)
+	check(c.Client.Timeout > 0, "client.timeout must be greater than 0, got %s", c.Client.Timeout)
+	check(strings.TrimSpace(c.Client.UserAgent) != "", "client.user_agent must not be empty")
+	check(c.Client.MaxRedirects >= 0, "client.max_redirects must not be negative, got %d", c.Client.MaxRedirects)
+	check(c.Politeness.HostConcurrency >= 0, "politeness.host_concurrency must not be negative, got %d", c.Politeness.HostConcurrency)
+	check(c.Politeness.HostDelay >= 0, "politeness.host_delay must not be negative, got %s", c.Politeness.HostDelay)
+	check(c.Politeness.HostRPS >= 0, "politeness.host_rps must not be negative, got %g", c.Politeness.HostRPS)
+
+	switch c.Scope.Mode {
+	case "", scope.ModeAll, scope.ModeHost, scope.ModeDomain, scope.ModePath:
+	default:
+		check(false, "scope.mode must be one of all, host, domain or path, got %q", c.Scope.Mode)
+	}
+	for _, expr := range append(append([]string{}, c.Scope.Include...), c.Scope.Exclude...) {
+		_, err := regexp.Compile(expr)
+		check(err == nil, "scope pattern %q is not a valid regular expression", expr)
+	}
+
+	check(c.Limits.MaxPages >= 0, "limits.max_pages must not be negative, got %d", c.Limits.MaxPages)
+	check(c.Limits.MaxLinksPerPage >= 0, "limits.max_links_per_page must not be negative, got %d", c.Limits.MaxLinksPerPage)
+	check(c.Limits.MaxPagesPerHost >= 0, "limits.max_pages_per_host must not be negative, got %d", c.Limits.MaxPagesPerHost)
+
+	check(c.Crawl.Depth > 0, "crawl.depth must be greater than 0, got %d", c.Crawl.Depth)
+	check(c.Crawl.Concurrency > 0, "crawl.concurrency must be greater than 0, got %d", c.Crawl.Concurrency)
+	check(c.Crawl.MaxConcurrency > 0, "crawl.max_concurrency must be greater than 0, got %d", c.Crawl.MaxConcurrency)
+	check(c.Crawl.Timeout >= 0, "crawl.timeout must not be negative, got %s", c.Crawl.Timeout)
+	check(frontier.Supported(c.Crawl.Strategy), "crawl.strategy must be one of bfs, dfs or best, got %q", c.Crawl.Strategy)
+	_, err := frontier.NewScorer(c.Crawl.Scorer, c.Crawl.Keywords)
+	check(err == nil, "crawl.scorer must be one of segments, keywords with crawl.keywords or inlinks, got %q", c.Crawl.Scorer)
+	check(c.Crawl.Mode == "" || c.Crawl.Mode == data.ModeCrawl || c.Crawl.Mode == data.ModeLinkCheck, "crawl.mode must be crawl or linkcheck, got %q", c.Crawl.Mode)
+
+	check(c.Jobs.Workers > 0, "jobs.workers must be greater than 0, got %d", c.Jobs.Workers)
+	check(c.Jobs.QueueSize > 0, "jobs.queue_size must be greater than 0, got %d", c.Jobs.QueueSize)
+	check(c.Jobs.Store == "" || c.Jobs.CheckpointInterval > 0, "jobs.checkpoint_interval must be greater than 0, got %s", c.Jobs.CheckpointInterval)
+	check(c.Jobs.Retention > 0, "jobs.retention must be greater than 0, got %s", c.Jobs.Retention)
+	check(c.Jobs.Retained > 0, "jobs.retained must be greater than 0, got %d", c.Jobs.Retained)
+
+	check(output.Supported(c.Output.Format), "output.format %q is not supported", c.Output.Format)
+	_, err = output.ParseShape(c.Output.Shape)
+	check(err == nil, "output.shape must be tree or graph, got %q", c.Output.Shape)
+	check(c.Output.Shape != output.ShapeGraph || !output.Streamed(c.Output.Format), "output.shape graph cannot be streamed as %s", c.Output.Format)
+
+	check(!c.Cache.Enabled || c.Cache.FlushInterval > 0, "cache.flush_interval must be greater than 0, got %s", c.Cache.FlushInterval)
+
+	check(c.Dedup.NearDistance >= 0 && c.Dedup.NearDistance <= simhash.Bits/2, "dedup.near_distance must be between 0 and %d, got %d", simhash.Bits/2, c.Dedup.NearDistance)
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
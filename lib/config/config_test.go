@@ -0,0 +1,264 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smashed-avo/go-crawler/lib/config"
+)
+
+func TestLoad(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name          string
+		file          string
+		content       string
+		env           map[string]string
+		expected      func() *config.Config
+		expectedError bool
+	}{
+		{
+			name:     "Defaults",
+			expected: config.Default,
+		},
+		{
+			name: "YAML file",
+			file: "config.yaml",
+			content: `
+server:
+  port: 9000
+client:
+  timeout: 30s
+politeness:
+  robots: true
+  host_delay: 500ms
+scope:
+  mode: host
+  exclude: ['\?source=']
+crawl:
+  depth: 4
+`,
+			expected: func() *config.Config {
+				c := config.Default()
+				c.Server.Port = 9000
+				c.Client.Timeout = 30 * time.Second
+				c.Politeness.Robots = true
+				c.Politeness.HostDelay = 500 * time.Millisecond
+				c.Scope.Mode = "host"
+				c.Scope.Exclude = []string{`\?source=`}
+				c.Crawl.Depth = 4
+				return c
+			},
+		},
+		{
+			name:    "JSON file",
+			file:    "config.json",
+			content: `{"jobs": {"workers": 4}, "output": {"format": "ndjson"}, "limits": {"max_pages": 500}, "cache": {"enabled": true, "file": "pages.json"}}`,
+			env:     map[string]string{"GO_CRAWLER_JOB_STORE": "jobs.db", "GO_CRAWLER_JOB_RESUME": "true", "GO_CRAWLER_JOB_RETENTION": "10m"},
+			expected: func() *config.Config {
+				c := config.Default()
+				c.Jobs.Store = "jobs.db"
+				c.Jobs.Resume = true
+				c.Jobs.Retention = 10 * time.Minute
+				c.Cache.Enabled = true
+				c.Cache.File = "pages.json"
+				c.Jobs.Workers = 4
+				c.Output.Format = "ndjson"
+				c.Limits.MaxPages = 500
+				return c
+			},
+		},
+		{
+			name:    "Environment overrides the file",
+			file:    "config.yaml",
+			content: "server:\n  port: 9000\n",
+			env: map[string]string{
+				"GO_CRAWLER_PORT":     "9001",
+				"GO_CRAWLER_HOST_RPS": "2.5",
+				"GO_CRAWLER_INCLUDE":  "/blog/, /news/",
+				"GO_CRAWLER_SITEMAPS": "true",
+				"GO_CRAWLER_TIMEOUT":  "2m",
+				"GO_CRAWLER_STRATEGY": "best",
+				"GO_CRAWLER_SEED":     "42",
+
+				"GO_CRAWLER_NEAR_DISTANCE":        "5",
+				"GO_CRAWLER_SKIP_NEAR_DUPLICATES": "true",
+			},
+			expected: func() *config.Config {
+				c := config.Default()
+				c.Server.Port = 9001
+				c.Politeness.HostRPS = 2.5
+				c.Scope.Include = []string{"/blog/", "/news/"}
+				c.Crawl.Sitemaps = true
+				c.Crawl.Timeout = 2 * time.Minute
+				c.Crawl.Strategy = "best"
+				c.Crawl.Seed = 42
+				c.Dedup.NearDistance = 5
+				c.Dedup.SkipNear = true
+				return c
+			},
+		},
+		{
+			name:          "Unknown key",
+			file:          "config.yaml",
+			content:       "server:\n  hostname: localhost\n",
+			expectedError: true,
+		},
+		{
+			name:          "Invalid duration",
+			file:          "config.yaml",
+			content:       "client:\n  timeout: soon\n",
+			expectedError: true,
+		},
+		{
+			name:          "Invalid environment variable",
+			env:           map[string]string{"GO_CRAWLER_DEPTH": "deep"},
+			expectedError: true,
+		},
+		{
+			name:          "Missing file",
+			file:          "missing.yaml",
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			path := ""
+			if tc.file != "" {
+				path = filepath.Join(t.TempDir(), tc.file)
+				if tc.content != "" {
+					require.NoError(t, os.WriteFile(path, []byte(tc.content), 0644))
+				}
+			}
+
+			c, err := config.Load(path)
+
+			assert.Equal(tc.expectedError, err != nil, tc.name)
+			if tc.expected != nil {
+				assert.Equal(tc.expected(), c, tc.name)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name           string
+		change         func(c *config.Config)
+		expectedErrors int
+	}{
+		{
+			name:   "Defaults",
+			change: func(c *config.Config) {},
+		},
+		{
+			name: "Invalid server and client",
+			change: func(c *config.Config) {
+				c.Server.Port = 70000
+				c.Client.Timeout = 0
+				c.Client.UserAgent = " "
+			},
+			expectedErrors: 3,
+		},
+		{
+			name: "Invalid scope",
+			change: func(c *config.Config) {
+				c.Scope.Mode = "site"
+				c.Scope.Include = []string{"("}
+			},
+			expectedErrors: 2,
+		},
+		{
+			name: "Negative limits and politeness",
+			change: func(c *config.Config) {
+				c.Limits.MaxPages = -1
+				c.Politeness.HostRPS = -1
+				c.Crawl.Timeout = -time.Second
+			},
+			expectedErrors: 3,
+		},
+		{
+			name: "Invalid crawl and jobs",
+			change: func(c *config.Config) {
+				c.Crawl.Depth = 0
+				c.Crawl.Concurrency = 0
+				c.Jobs.Workers = 0
+				c.Jobs.QueueSize = 0
+				c.Crawl.Strategy = "random"
+				c.Crawl.Scorer = "keywords"
+				c.Jobs.Store = "jobs.db"
+				c.Jobs.CheckpointInterval = 0
+				c.Jobs.Retention = 0
+				c.Jobs.Retained = 0
+			},
+			expectedErrors: 9,
+		},
+		{
+			name: "Invalid output",
+			change: func(c *config.Config) {
+				c.Output.Format = "svg"
+				c.Output.Shape = "list"
+			},
+			expectedErrors: 2,
+		},
+		{
+			name: "Maximum concurrency not positive",
+			change: func(c *config.Config) {
+				c.Crawl.MaxConcurrency = 0
+			},
+			expectedErrors: 1,
+		},
+		{
+			name: "Cache without flush interval",
+			change: func(c *config.Config) {
+				c.Cache.Enabled = true
+				c.Cache.FlushInterval = 0
+			},
+			expectedErrors: 1,
+		},
+		{
+			name: "Near distance out of range",
+			change: func(c *config.Config) {
+				c.Dedup.NearDistance = 40
+			},
+			expectedErrors: 1,
+		},
+		{
+			name: "Streamed graph",
+			change: func(c *config.Config) {
+				c.Output.Format = "ndjson"
+				c.Output.Shape = "graph"
+			},
+			expectedErrors: 1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := config.Default()
+			tc.change(c)
+
+			err := c.Validate()
+
+			if tc.expectedErrors == 0 {
+				assert.NoError(err, tc.name)
+				return
+			}
+			errs, ok := err.(config.ValidationError)
+			assert.True(ok, tc.name)
+			assert.Len(errs, tc.expectedErrors, tc.name)
+		})
+	}
+}
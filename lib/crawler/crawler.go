@@ -1,61 +1,493 @@
 package crawler
 
 import (
+	"context"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/dedup"
+	"github.com/smashed-avo/go-crawler/lib/frontier"
+	"github.com/smashed-avo/go-crawler/lib/links"
+	"github.com/smashed-avo/go-crawler/lib/scheduler"
 )
 
+// DefaultConcurrency is the number of workers fetching pages at the same time
+const DefaultConcurrency = 10
+
 // Workerer is an interface to the worker function
 type Workerer interface {
-	Do(node *data.Response, depth int, chQueue chan []*data.Response, visited *data.Visited)
-	GetPageTitle(u string) string
+	Do(ctx context.Context, node *data.Response, crawl *data.Crawl)
+}
+
+// Seeder finds pages of a site that may not be linked, such as the ones listed in its sitemaps
+type Seeder interface {
+	Seeds(ctx context.Context, seedURL *url.URL) []string
+}
+
+// LinkChecker checks the link targets of the pages of a finished crawl and reports the broken ones
+type LinkChecker interface {
+	Report(ctx context.Context, tree *data.Response, concurrency int, l scheduler.Limits) *data.LinkReport
 }
 
 // Crawler receiver for crawl function
 type Crawler struct {
-	Worker  Workerer
-	ChQueue chan []*data.Response
+	Worker      Workerer
+	concurrency int
+	timeout     time.Duration
+	hostLimits  scheduler.Limits
+	delayer     scheduler.Delayer
+	sizeLimits  data.Limits
+	seeder      Seeder
+	strategy    string
+	checker     LinkChecker
+	near        bool
+	nearDist    int
+	skipNear    bool
+}
+
+// Option sets a global setting of the crawler
+type Option func(*Crawler)
+
+// WithConcurrency sets the default size of the worker pool
+func WithConcurrency(n int) Option {
+	return func(c *Crawler) {
+		if n > 0 {
+			c.concurrency = n
+		}
+	}
+}
+
+// WithTimeout sets the default wall-clock budget of a crawl, no budget when not set
+func WithTimeout(d time.Duration) Option {
+	return func(c *Crawler) {
+		if d > 0 {
+			c.timeout = d
+		}
+	}
+}
+
+// WithHostLimits sets the default politeness limits applied to every host
+func WithHostLimits(l scheduler.Limits) Option {
+	return func(c *Crawler) {
+		c.hostLimits = l
+	}
+}
+
+// WithCrawlDelay sets the source of per host delays, such as robots.txt Crawl-delay
+func WithCrawlDelay(d scheduler.Delayer) Option {
+	return func(c *Crawler) {
+		c.delayer = d
+	}
+}
+
+// WithLimits sets the default size limits of a crawl
+func WithLimits(l data.Limits) Option {
+	return func(c *Crawler) {
+		c.sizeLimits = l
+	}
+}
+
+// WithSitemaps sets the source of the sitemap pages added to the crawls requesting them
+func WithSitemaps(s Seeder) Option {
+	return func(c *Crawler) {
+		c.seeder = s
+	}
+}
+
+// WithStrategy sets the default order the sites of every host are fetched in, breadth first when not set or
+// unknown, strategies are validated by the handler and the configuration
+func WithStrategy(strategy string) Option {
+	return func(c *Crawler) {
+		c.strategy = strategy
+	}
+}
+
+// WithLinkChecker sets the checker of the link targets of linkcheck crawls
+func WithLinkChecker(l LinkChecker) Option {
+	return func(c *Crawler) {
+		c.checker = l
+	}
+}
+
+// WithNearDuplicates reports the pages whose text fingerprints differ by at most distance bits from the one
+// of a page already crawled, they are not expanded when skip is set
+func WithNearDuplicates(distance int, skip bool) Option {
+	return func(c *Crawler) {
+		c.near, c.nearDist, c.skipNear = true, distance, skip
+	}
 }
 
 // NewCrawler factory method to inject worker instance
-func NewCrawler(w Workerer) *Crawler {
-	return &Crawler{Worker: w}
+func NewCrawler(w Workerer, opts ...Option) *Crawler {
+	c := &Crawler{Worker: w, concurrency: DefaultConcurrency}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
-// Crawl Initiates crawl process given an initial seed URLs
-func (c *Crawler) Crawl(seedURL *url.URL, maxDepth int) *data.Response {
-	//setup channels to process nodes recursively
-	c.ChQueue = make(chan []*data.Response)
-	defer close(c.ChQueue)
+// Crawl Initiates crawl process given an initial seed URLs, when the context is done or the budget
+// runs out the partial tree is returned flagged as truncated
+func (c *Crawler) Crawl(ctx context.Context, seedURL *url.URL, maxDepth int, opts data.Options) *data.Response {
+	timeout := c.timeout
+	if opts.Timeout > 0 {
+		timeout = opts.Timeout
+	}
+	// The link checks of a linkcheck crawl get a budget of their own
+	reqCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
 	// Maintain visited URL to detect loops
 	visited := &data.Visited{M: make(map[string]bool)}
 	visited.M[seedURL.String()] = true
 
-	// add first parent node to queue
-	parent := data.Response{
+	// The seed URL is always expanded
+	if maxDepth < 2 {
+		maxDepth = 2
+	}
+
+	// State shared by the workers of this crawl
+	limits := c.sizes(opts)
+	// Pages with the canonical URL or the content of a page already crawled are not expanded, near
+	// duplicates are when they are not skipped
+	dedupOpts := make([]dedup.Option, 0)
+	if c.near {
+		dedupOpts = append(dedupOpts, dedup.WithNear(c.nearDist))
+	}
+	index := dedup.NewIndex(dedupOpts...)
+	crawl := &data.Crawl{
+		MaxDepth:        maxDepth,
+		MaxLinksPerPage: limits.MaxLinksPerPage,
+		Scope:           opts.Scope,
+		Visited:         visited,
+		Dedup:           index,
+		SkipNear:        c.skipNear,
+	}
+
+	// add first parent node to queue, its title is set by the worker
+	parent := &data.Response{
 		Depth: 0,
-		Title: c.Worker.GetPageTitle(seedURL.String()),
 		Nodes: make([]*data.Response, 0),
 		URL:   seedURL.String(),
 	}
-	depth := 1
-	workers := 1
-	go c.Worker.Do(&parent, depth, c.ChQueue, visited)
-
-	for workers > 0 {
-		nodes := <-c.ChQueue
-		workers--
-		if len(nodes) > 0 {
-			depth = nodes[0].Depth + 1
-			if depth < maxDepth {
-				for _, node := range nodes {
-					workers++
-					go c.Worker.Do(node, depth, c.ChQueue, visited)
+	// A resumed crawl continues from the sites already fetched, unless the seed itself was not
+	resumed := opts.Resume != nil && fetched(opts.Resume)
+	if resumed {
+		parent = opts.Resume
+	}
+
+	// Pages listed in the sitemaps are children of the seed, the worker adds its links after them
+	if !resumed && opts.Sitemaps && c.seeder != nil {
+		for _, seed := range c.seeder.Seeds(ctx, seedURL) {
+			u, err := url.Parse(seed)
+			if err != nil || visited.M[seed] {
+				continue
+			}
+			visited.M[seed] = true
+			parent.Nodes = append(parent.Nodes, &data.Response{
+				Depth:    1,
+				URL:      seed,
+				Nodes:    make([]*data.Response, 0),
+				Source:   data.SourceSitemap,
+				External: opts.Scope != nil && !opts.Scope.InScope(u),
+			})
+		}
+	}
+
+	// Nodes are queued per host in the order of the crawl strategy and handed out honouring the politeness limits
+	strategy := c.strategy
+	if opts.Strategy != "" {
+		strategy = opts.Strategy
+	}
+	schedOpts := []scheduler.Option{scheduler.WithFrontier(func() frontier.Frontier {
+		f, err := frontier.New(strategy, opts.Scorer, opts.Seed)
+		if err != nil {
+			return frontier.NewFIFO()
+		}
+		return f
+	})}
+	// A seeded crawl hands out the hosts in turn whatever their politeness delays, so its order does not depend
+	// on the clock
+	if opts.Seed != 0 {
+		schedOpts = append(schedOpts, scheduler.WithStrictOrder())
+	}
+	sched := scheduler.NewScheduler(c.limits(opts), c.delayer, schedOpts...)
+	defer sched.Close()
+	// Scorers learning from the links of the fetched pages see them before their children are queued, the
+	// sites already queued they link to are ranked again
+	counter, _ := opts.Scorer.(frontier.Counter)
+
+	// Every node is fetched once, workers only register children below maximum depth.
+	// External nodes and nodes over the page limits are leaves that are not fetched.
+	// Children are queued once their parent is done so nodes are observed in tree order.
+	// Parents maps the nodes queued or in flight to the URL of their parent, pending counts them.
+	parents := make(map[*data.Response]string)
+	pages := newPageCounter(limits)
+	pending := 0
+	push := func(node *data.Response, parentURL string) {
+		if node.External || !pages.allow(node, crawl) {
+			observe(opts.Observer, node, parentURL)
+			return
+		}
+		parents[node] = parentURL
+		sched.Push(node)
+		opts.Progress.Queue()
+		pending++
+	}
+	if resumed {
+		// The seed was fetched, links to the host it was redirected to stay in scope
+		if r, ok := opts.Scope.(data.Redirecter); ok && parent.FinalURL != "" {
+			if u, err := url.Parse(parent.FinalURL); err == nil {
+				r.Redirected(u)
+			}
+		}
+		// Sites already fetched count towards the limits, the others are fetched again
+		var walk func(node *data.Response, parentURL string)
+		walk = func(node *data.Response, parentURL string) {
+			visited.M[node.URL] = true
+			if u, err := links.NormalizeURL(node.FinalURL); err == nil && node.FinalURL != "" {
+				visited.M[u] = true
+			}
+			if !fetched(node) {
+				*node = data.Response{Depth: node.Depth, URL: node.URL, Nodes: make([]*data.Response, 0), Source: node.Source, External: node.External}
+				push(node, parentURL)
+				return
+			}
+			if !node.External && node.Skipped == "" {
+				pages.count(node)
+				opts.Progress.Fetch()
+			}
+			// Duplicates and near duplicates were compared to the sites already indexed
+			if node.DuplicateOf == "" {
+				index.Seen(node)
+				if node.NearDuplicateOf == "" {
+					index.Near(node)
+				}
+			}
+			if counter != nil {
+				counter.Count(node.Links)
+				sched.Rescore(node.Links)
+			}
+			opts.Progress.Discover(len(node.Nodes))
+			for _, child := range node.Nodes {
+				walk(child, node.URL)
+			}
+		}
+		walk(parent, "")
+	} else {
+		push(parent, "")
+	}
+
+	// Start a fixed size pool of workers, a seeded crawl fetches a site at a time so its order does not
+	// depend on which worker finishes first
+	concurrency := c.concurrency
+	if opts.Concurrency > 0 {
+		concurrency = opts.Concurrency
+	}
+	// Link checks are reported in URL order whatever the pool size
+	checks := concurrency
+	if opts.Seed != 0 {
+		concurrency = 1
+	}
+	// A worker waits for the children of its node to be queued before taking the next one
+	chFetched := make(chan *data.Response)
+	chQueued := make(chan struct{})
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			for {
+				node, ok := sched.Next(ctx)
+				if !ok {
+					return
+				}
+				c.Worker.Do(ctx, node, crawl)
+				sched.Done(node)
+				chFetched <- node
+				<-chQueued
+			}
+		}()
+	}
+
+	// The tree is checkpointed at regular intervals when requested
+	var chCheckpoint <-chan time.Time
+	if opts.Checkpointer != nil && opts.CheckpointInterval > 0 {
+		ticker := time.NewTicker(opts.CheckpointInterval)
+		defer ticker.Stop()
+		chCheckpoint = ticker.C
+	}
+
+	stopped := false
+	chDone := ctx.Done()
+	for pending > 0 {
+		select {
+		case node := <-chFetched:
+			pending--
+			opts.Progress.Fetch()
+			opts.Progress.Discover(len(node.Nodes))
+			observe(opts.Observer, node, parents[node])
+			delete(parents, node)
+			if !stopped {
+				if counter != nil {
+					counter.Count(node.Links)
+					sched.Rescore(node.Links)
+				}
+				for _, child := range node.Nodes {
+					push(child, node.URL)
 				}
 			}
+			chQueued <- struct{}{}
+		case <-chCheckpoint:
+			opts.Checkpointer.Checkpoint(snapshot(parent, parents))
+		case <-chDone:
+			// Stop handing out jobs and wait for the workers in flight, their requests are aborted
+			stopped = true
+			pending -= sched.Close()
+			chDone = nil
+		}
+	}
+	// Fetches may also have failed because of the cancellation
+	parent.Truncated = ctx.Err() != nil
+	parent.Limits = crawl.LimitsHit()
+	index.Resolve(parent)
+	parent.Duplicates = dedup.Clusters(parent)
+	parent.NearDuplicates = dedup.NearClusters(parent)
+	// A linkcheck crawl checks the link targets of the pages crawled, a crawl that ran out of budget still
+	// has its links checked within a budget as long
+	if opts.Mode == data.ModeLinkCheck && c.checker != nil {
+		checkCtx := reqCtx
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			checkCtx, cancel = context.WithTimeout(reqCtx, timeout)
+			defer cancel()
 		}
+		parent.LinkCheck = c.checker.Report(checkCtx, parent, checks, c.limits(opts))
+	}
+	return parent
+}
+
+// limits merges the per request politeness limits with the crawler defaults
+func (c *Crawler) limits(opts data.Options) scheduler.Limits {
+	l := c.hostLimits
+	if opts.HostConcurrency > 0 {
+		l.MaxConcurrent = opts.HostConcurrency
+	}
+	if opts.HostDelay > 0 {
+		l.MinDelay = opts.HostDelay
+	}
+	if opts.HostRPS > 0 {
+		l.RPS = opts.HostRPS
+	}
+	return l
+}
+
+// sizes merges the per request size limits with the crawler defaults
+func (c *Crawler) sizes(opts data.Options) data.Limits {
+	l := c.sizeLimits
+	if opts.MaxPages > 0 {
+		l.MaxPages = opts.MaxPages
+	}
+	if opts.MaxLinksPerPage > 0 {
+		l.MaxLinksPerPage = opts.MaxLinksPerPage
+	}
+	if opts.MaxPagesPerHost > 0 {
+		l.MaxPagesPerHost = opts.MaxPagesPerHost
+	}
+	return l
+}
+
+// pageCounter counts the pages handed to the workers, in total and per host
+type pageCounter struct {
+	limits data.Limits
+	total  int
+	hosts  map[string]int
+}
+
+func newPageCounter(l data.Limits) *pageCounter {
+	return &pageCounter{limits: l, hosts: make(map[string]int)}
+}
+
+// allow counts a page to be fetched, a page over the limits is skipped and the limit recorded
+func (p *pageCounter) allow(node *data.Response, crawl *data.Crawl) bool {
+	if p.limits.MaxPages > 0 && p.total >= p.limits.MaxPages {
+		node.Skipped = data.LimitMaxPages
+		crawl.Hit(data.LimitMaxPages)
+		return false
+	}
+	host := ""
+	if u, err := url.Parse(node.URL); err == nil {
+		host = u.Host
+	}
+	if p.limits.MaxPagesPerHost > 0 && p.hosts[host] >= p.limits.MaxPagesPerHost {
+		node.Skipped = data.LimitMaxPagesPerHost
+		crawl.Hit(data.LimitMaxPagesPerHost)
+		return false
+	}
+	p.total++
+	p.hosts[host]++
+	return true
+}
+
+// count counts a page fetched before the crawl was resumed
+func (p *pageCounter) count(node *data.Response) {
+	host := ""
+	if u, err := url.Parse(node.URL); err == nil {
+		host = u.Host
+	}
+	p.total++
+	p.hosts[host]++
+}
+
+// observe notifies the observer of a crawl of a node
+func observe(o data.Observer, node *data.Response, parentURL string) {
+	if o == nil {
+		return
+	}
+	o.Observe(data.Event{
+		URL:       node.URL,
+		Parent:    parentURL,
+		Depth:     node.Depth,
+		Title:     node.Title,
+		Status:    node.Status,
+		Unchanged: node.Unchanged,
+		Error:     node.Error,
+		Source:    node.Source,
+		External:  node.External,
+		Skipped:   node.Skipped,
+
+		DuplicateOf:     node.DuplicateOf,
+		NearDuplicateOf: node.NearDuplicateOf,
+	})
+}
+
+// fetched reports whether a site of a resumed tree was processed, sites whose fetch was aborted when the
+// crawl was interrupted are fetched again. A skip is final, a crawl stopped before robots.txt is fetched
+// leaves its site unfetched rather than skipped
+func fetched(n *data.Response) bool {
+	switch {
+	case n.External, n.Skipped != "":
+		return true
+	case n.Error != "":
+		return !strings.Contains(n.Error, context.Canceled.Error()) && !strings.Contains(n.Error, context.DeadlineExceeded.Error())
+	default:
+		return n.Status > 0
+	}
+}
+
+// snapshot copies the tree of a running crawl. Sites queued or in flight are copied without their details
+// as a worker may be writing them
+func snapshot(node *data.Response, queued map[*data.Response]string) *data.Response {
+	if _, ok := queued[node]; ok {
+		return &data.Response{Depth: node.Depth, URL: node.URL, Nodes: make([]*data.Response, 0), Source: node.Source, External: node.External}
+	}
+	cp := *node
+	cp.Nodes = make([]*data.Response, 0, len(node.Nodes))
+	for _, child := range node.Nodes {
+		cp.Nodes = append(cp.Nodes, snapshot(child, queued))
 	}
-	return &parent
+	return &cp
 }
@@ -1,14 +1,22 @@
 package crawler_test
 
 import (
+	"context"
 	"fmt"
 	"net/url"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/smashed-avo/go-crawler/lib/crawler"
 	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/frontier"
+	"github.com/smashed-avo/go-crawler/lib/links"
+	"github.com/smashed-avo/go-crawler/lib/scheduler"
+	"github.com/smashed-avo/go-crawler/lib/worker"
 )
 
 const (
@@ -16,6 +24,12 @@ const (
 	emptyResponse
 	successResponse
 	maxDepthReachedResponse
+	wideResponse
+	slowResponse
+	externalResponse
+	sitemapResponse
+	resumedResponse
+	binaryResponse
 )
 
 var (
@@ -30,44 +44,119 @@ type mockStateWorker int
 
 type MockWorker struct {
 	State   mockStateWorker
-	ChQueue chan []*data.Response
+	running int32
+	maxSeen int32
+	calls   int32
 }
 
-func (w *MockWorker) Do(node *data.Response, depth int, chQueue chan []*data.Response, visited *data.Visited) {
+func (w *MockWorker) Do(ctx context.Context, node *data.Response, crawl *data.Crawl) {
+	maxDepth := crawl.MaxDepth
+	if node.Depth == 0 {
+		node.Title = "Success Web"
+	}
 	switch w.State {
 	case emptyResponse:
 		nodes := make([]*data.Response, 0)
 		node.Nodes = nodes
-		chQueue <- nodes
 		return
 	case successResponse, maxDepthReachedResponse:
 		nodes := make([]*data.Response, 0)
-		switch depth {
-		case 1:
-			nodes = append(nodes, child1)
-			break
-		case 2:
-			nodes = append(nodes, child2)
-			break
-		case 3:
-			nodes = append(nodes, child3)
-			break
-		case 4:
-			nodes = append(nodes, child4)
-			break
+		if node.Depth+1 < maxDepth {
+			switch node.Depth + 1 {
+			case 1:
+				nodes = append(nodes, child1)
+				break
+			case 2:
+				nodes = append(nodes, child2)
+				break
+			case 3:
+				nodes = append(nodes, child3)
+				break
+			case 4:
+				nodes = append(nodes, child4)
+				break
+			}
+		}
+		node.Nodes = nodes
+		return
+	case wideResponse:
+		// Track how many workers run at the same time
+		atomic.AddInt32(&w.calls, 1)
+		running := atomic.AddInt32(&w.running, 1)
+		for {
+			max := atomic.LoadInt32(&w.maxSeen)
+			if running <= max || atomic.CompareAndSwapInt32(&w.maxSeen, max, running) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&w.running, -1)
+		nodes := make([]*data.Response, 0)
+		if node.Depth+1 < maxDepth {
+			for i := 0; i < 20; i++ {
+				nodes = append(nodes, &data.Response{Depth: node.Depth + 1, URL: fmt.Sprintf("https://www.successweb.com/children%d", i), Nodes: make([]*data.Response, 0)})
+			}
+		}
+		node.Nodes = nodes
+		return
+	case externalResponse:
+		// Only the seed has children, one of them out of scope
+		nodes := make([]*data.Response, 0)
+		if node.Depth == 0 {
+			nodes = append(nodes,
+				&data.Response{Depth: 1, URL: "https://www.successweb.com/internal", Nodes: make([]*data.Response, 0)},
+				&data.Response{Depth: 1, URL: "https://www.otherweb.com", Nodes: make([]*data.Response, 0), External: true})
+		} else {
+			node.Title = "Fetched"
+		}
+		node.Nodes = nodes
+		return
+	case sitemapResponse:
+		// The seed links to a page also listed in the sitemaps and to a new one
+		if node.Depth == 0 {
+			for _, u := range []string{"https://www.successweb.com/listed", "https://www.successweb.com/linked"} {
+				crawl.Visited.Lock()
+				seen := crawl.Visited.M[u]
+				crawl.Visited.M[u] = true
+				crawl.Visited.Unlock()
+				if !seen {
+					node.Nodes = append(node.Nodes, &data.Response{Depth: 1, URL: u, Nodes: make([]*data.Response, 0), Source: data.SourceLink})
+				}
+			}
+		} else {
+			node.Title = "Fetched"
+		}
+		return
+	case resumedResponse:
+		// Every site fetched is a leaf
+		atomic.AddInt32(&w.calls, 1)
+		node.Status = 200
+		if node.Depth > 0 {
+			node.Title = "Fetched"
+		}
+		return
+	case binaryResponse:
+		// Every site below maximum depth links to two children, /a and /b under its path
+		nodes := make([]*data.Response, 0)
+		if node.Depth+1 < maxDepth {
+			for _, p := range []string{"/a", "/b"} {
+				u := node.URL + p
+				node.Links = append(node.Links, data.Link{URL: u})
+				nodes = append(nodes, &data.Response{Depth: node.Depth + 1, URL: u, Nodes: make([]*data.Response, 0)})
+			}
+		}
+		node.Nodes = nodes
+		return
+	case slowResponse:
+		// Seed links to a child that only returns once the crawl is cancelled
+		nodes := make([]*data.Response, 0)
+		if node.Depth == 0 {
+			nodes = append(nodes, &data.Response{Depth: 1, URL: "https://www.successweb.com/slow", Nodes: make([]*data.Response, 0)})
+		} else {
+			<-ctx.Done()
 		}
 		node.Nodes = nodes
-		chQueue <- nodes
 		return
-	default:
-		panic(fmt.Sprintf("Invalid mockStateWorker: %v", w.State))
-	}
-}
-
-func (w *MockWorker) GetPageTitle(u string) string {
-	switch w.State {
-	case emptyResponse, successResponse, maxDepthReachedResponse:
-		return "Success Web"
 	default:
 		panic(fmt.Sprintf("Invalid mockStateWorker: %v", w.State))
 	}
@@ -80,6 +169,7 @@ func TestCrawl(t *testing.T) {
 		name             string
 		state            mockStateWorker
 		maxDepth         int
+		concurrency      int
 		url              string
 		title            string
 		expectedResponse *data.Response
@@ -143,6 +233,16 @@ func TestCrawl(t *testing.T) {
 						&data.Response{Depth: 3, Title: "", URL: "https://www.successweb.com/children3", Nodes: []*data.Response{
 							&data.Response{Depth: 4, Title: "", URL: "https://www.successweb.com/children4", Nodes: []*data.Response{}}}}}}}}}},
 		},
+		{
+			name:     "External nodes not fetched",
+			state:    externalResponse,
+			maxDepth: 3,
+			url:      "https://www.successweb.com",
+			title:    "Success Web",
+			expectedResponse: &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{
+				&data.Response{Depth: 1, Title: "Fetched", URL: "https://www.successweb.com/internal", Nodes: []*data.Response{}},
+				&data.Response{Depth: 1, Title: "", URL: "https://www.otherweb.com", Nodes: []*data.Response{}, External: true}}},
+		},
 	}
 
 	for _, tc := range tt {
@@ -153,12 +253,514 @@ func TestCrawl(t *testing.T) {
 			m := MockWorker{State: tc.state}
 			c := crawler.NewCrawler(&m)
 
-			c.ChQueue = make(chan []*data.Response)
-			defer close(c.ChQueue)
-
-			r := c.Crawl(u, tc.maxDepth)
+			r := c.Crawl(context.Background(), u, tc.maxDepth, data.Options{Concurrency: tc.concurrency})
 
 			assert.Equal(tc.expectedResponse, r, tc.name)
 		})
 	}
 }
+
+func TestCrawlConcurrency(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name            string
+		concurrency     int
+		hostConcurrency int
+		expectedNodes   int
+		expectedMax     int32
+	}{
+		{
+			name:          "Default pool size",
+			concurrency:   0,
+			expectedNodes: 20,
+			expectedMax:   crawler.DefaultConcurrency,
+		},
+		{
+			name:          "Per request pool size",
+			concurrency:   3,
+			expectedNodes: 20,
+			expectedMax:   3,
+		},
+		{
+			name:          "Single worker",
+			concurrency:   1,
+			expectedNodes: 20,
+			expectedMax:   1,
+		},
+		{
+			name:            "Per host limit below pool size",
+			concurrency:     5,
+			hostConcurrency: 2,
+			expectedNodes:   20,
+			expectedMax:     2,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := url.ParseRequestURI("https://www.successweb.com")
+			assert.NoError(err)
+
+			m := MockWorker{State: wideResponse}
+			c := crawler.NewCrawler(&m)
+
+			r := c.Crawl(context.Background(), u, 2, data.Options{Concurrency: tc.concurrency, HostConcurrency: tc.hostConcurrency})
+
+			assert.Len(r.Nodes, tc.expectedNodes, tc.name)
+			assert.True(m.maxSeen <= tc.expectedMax, tc.name)
+		})
+	}
+}
+
+func TestCrawlCancelled(t *testing.T) {
+	assert := assert.New(t)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tt := []struct {
+		name              string
+		ctx               context.Context
+		crawler           []crawler.Option
+		opts              data.Options
+		expectedTruncated bool
+	}{
+		{
+			name:              "Per request timeout",
+			ctx:               context.Background(),
+			opts:              data.Options{Timeout: 10 * time.Millisecond},
+			expectedTruncated: true,
+		},
+		{
+			name:              "Default timeout",
+			ctx:               context.Background(),
+			crawler:           []crawler.Option{crawler.WithTimeout(10 * time.Millisecond)},
+			expectedTruncated: true,
+		},
+		{
+			name:              "Client cancelled",
+			ctx:               cancelled,
+			expectedTruncated: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := url.ParseRequestURI("https://www.successweb.com")
+			assert.NoError(err)
+
+			m := MockWorker{State: slowResponse}
+			c := crawler.NewCrawler(&m, tc.crawler...)
+
+			r := c.Crawl(tc.ctx, u, 2, tc.opts)
+
+			assert.Equal(tc.expectedTruncated, r.Truncated, tc.name)
+			assert.Equal("https://www.successweb.com", r.URL, tc.name)
+		})
+	}
+}
+
+func TestCrawlLimits(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name            string
+		crawler         []crawler.Option
+		opts            data.Options
+		expectedFetches int32
+		expectedSkipped int
+		expectedLimits  []string
+		expectedQueued  int64
+	}{
+		{
+			name:            "No limits",
+			expectedFetches: 21,
+			expectedSkipped: 0,
+			expectedQueued:  21,
+			expectedLimits:  []string{},
+		},
+		{
+			name:            "Max pages per request",
+			opts:            data.Options{Limits: data.Limits{MaxPages: 5}},
+			expectedFetches: 5,
+			expectedSkipped: 16,
+			expectedQueued:  5,
+			expectedLimits:  []string{data.LimitMaxPages},
+		},
+		{
+			name:            "Max pages per host by default",
+			crawler:         []crawler.Option{crawler.WithLimits(data.Limits{MaxPagesPerHost: 3})},
+			expectedFetches: 3,
+			expectedSkipped: 18,
+			expectedQueued:  3,
+			expectedLimits:  []string{data.LimitMaxPagesPerHost},
+		},
+		{
+			name:            "Request overrides default",
+			crawler:         []crawler.Option{crawler.WithLimits(data.Limits{MaxPages: 3})},
+			opts:            data.Options{Limits: data.Limits{MaxPages: 30}},
+			expectedFetches: 21,
+			expectedSkipped: 0,
+			expectedQueued:  21,
+			expectedLimits:  []string{},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := url.ParseRequestURI("https://www.successweb.com")
+			assert.NoError(err)
+
+			m := MockWorker{State: wideResponse}
+			c := crawler.NewCrawler(&m, tc.crawler...)
+
+			progress := &data.Progress{}
+			tc.opts.Progress = progress
+			r := c.Crawl(context.Background(), u, 2, tc.opts)
+
+			skipped := 0
+			for _, n := range r.Nodes {
+				if n.Skipped != "" {
+					skipped++
+				}
+			}
+			assert.Equal(tc.expectedFetches, m.calls, tc.name)
+			assert.Equal(tc.expectedSkipped, skipped, tc.name)
+			assert.Equal(tc.expectedLimits, append([]string{}, r.Limits...), tc.name)
+			assert.Equal(data.Progress{Discovered: 20, Queued: tc.expectedQueued, Fetched: tc.expectedQueued}, progress.Snapshot(), tc.name)
+		})
+	}
+}
+
+type MockObserver struct {
+	Events []data.Event
+}
+
+func (o *MockObserver) Observe(e data.Event) {
+	o.Events = append(o.Events, e)
+}
+
+func TestCrawlObserver(t *testing.T) {
+	assert := assert.New(t)
+
+	u, err := url.ParseRequestURI("https://www.successweb.com")
+	assert.NoError(err)
+
+	m := MockWorker{State: externalResponse}
+	c := crawler.NewCrawler(&m)
+	o := &MockObserver{}
+
+	c.Crawl(context.Background(), u, 3, data.Options{Observer: o})
+
+	// Parents are observed before their children, leaves as soon as they are registered
+	assert.Equal([]data.Event{
+		{URL: "https://www.successweb.com", Depth: 0, Title: "Success Web"},
+		{URL: "https://www.otherweb.com", Parent: "https://www.successweb.com", Depth: 1, External: true},
+		{URL: "https://www.successweb.com/internal", Parent: "https://www.successweb.com", Depth: 1, Title: "Fetched"},
+	}, o.Events)
+}
+
+func TestCrawlStrategy(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name          string
+		strategy      string
+		defaultOrder  string
+		scorer        data.Scorer
+		expectedOrder []string
+	}{
+		{
+			name:          "Breadth first by default",
+			expectedOrder: []string{"", "/a", "/b", "/a/a", "/a/b", "/b/a", "/b/b"},
+		},
+		{
+			name:          "Depth first",
+			strategy:      frontier.StrategyDFS,
+			expectedOrder: []string{"", "/b", "/b/b", "/b/a", "/a", "/a/b", "/a/a"},
+		},
+		{
+			name:          "Depth first as the crawler default",
+			defaultOrder:  frontier.StrategyDFS,
+			expectedOrder: []string{"", "/b", "/b/b", "/b/a", "/a", "/a/b", "/a/a"},
+		},
+		{
+			name:          "Best first by keywords, ties in the order found",
+			strategy:      frontier.StrategyBest,
+			scorer:        frontier.NewKeywords([]string{"/b"}),
+			expectedOrder: []string{"", "/b", "/b/a", "/b/b", "/a", "/a/b", "/a/a"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := url.ParseRequestURI("https://www.successweb.com")
+			assert.NoError(err)
+
+			c := crawler.NewCrawler(&MockWorker{State: binaryResponse}, crawler.WithStrategy(tc.defaultOrder))
+			o := &MockObserver{}
+			c.Crawl(context.Background(), u, 3, data.Options{Concurrency: 1, Strategy: tc.strategy, Scorer: tc.scorer, Observer: o})
+
+			order := make([]string, 0)
+			for _, e := range o.Events {
+				order = append(order, e.URL[len("https://www.successweb.com"):])
+			}
+			assert.Equal(tc.expectedOrder, order, tc.name)
+		})
+	}
+}
+
+func TestCrawlSeed(t *testing.T) {
+	assert := assert.New(t)
+
+	u, err := url.ParseRequestURI("https://www.successweb.com")
+	assert.NoError(err)
+
+	// Seeded crawls fetch a site at a time and break ties the same way whatever the concurrency
+	crawl := func(seed int64) []data.Event {
+		m := &MockWorker{State: binaryResponse}
+		o := &MockObserver{}
+		crawler.NewCrawler(m).Crawl(context.Background(), u, 4, data.Options{
+			Concurrency: 10,
+			Strategy:    frontier.StrategyBest,
+			Scorer:      frontier.NewInLinks(),
+			Seed:        seed,
+			Observer:    o,
+		})
+		return o.Events
+	}
+	first := crawl(42)
+	assert.Len(first, 15)
+	for i := 0; i < 5; i++ {
+		assert.Equal(first, crawl(42))
+	}
+}
+
+type MockSeeder struct {
+	URLs []string
+}
+
+func (s *MockSeeder) Seeds(ctx context.Context, seedURL *url.URL) []string {
+	return s.URLs
+}
+
+type MockScope struct {
+	Out string
+}
+
+func (s *MockScope) InScope(u *url.URL) bool {
+	return u.String() != s.Out
+}
+
+func TestCrawlSitemaps(t *testing.T) {
+	assert := assert.New(t)
+
+	seeder := &MockSeeder{URLs: []string{
+		"https://www.successweb.com",
+		"https://www.successweb.com/listed",
+		"https://www.otherweb.com/listed",
+	}}
+
+	tt := []struct {
+		name          string
+		sitemaps      bool
+		expectedNodes []*data.Response
+	}{
+		{
+			name:     "Sitemap pages added at depth 1",
+			sitemaps: true,
+			expectedNodes: []*data.Response{
+				{Depth: 1, Title: "Fetched", URL: "https://www.successweb.com/listed", Nodes: make([]*data.Response, 0), Source: data.SourceSitemap},
+				{Depth: 1, URL: "https://www.otherweb.com/listed", Nodes: make([]*data.Response, 0), Source: data.SourceSitemap, External: true},
+				{Depth: 1, Title: "Fetched", URL: "https://www.successweb.com/linked", Nodes: make([]*data.Response, 0), Source: data.SourceLink},
+			},
+		},
+		{
+			name:     "Sitemaps not requested",
+			sitemaps: false,
+			expectedNodes: []*data.Response{
+				{Depth: 1, Title: "Fetched", URL: "https://www.successweb.com/listed", Nodes: make([]*data.Response, 0), Source: data.SourceLink},
+				{Depth: 1, Title: "Fetched", URL: "https://www.successweb.com/linked", Nodes: make([]*data.Response, 0), Source: data.SourceLink},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := url.ParseRequestURI("https://www.successweb.com")
+			assert.NoError(err)
+
+			m := MockWorker{State: sitemapResponse}
+			c := crawler.NewCrawler(&m, crawler.WithSitemaps(seeder))
+
+			r := c.Crawl(context.Background(), u, 2, data.Options{Sitemaps: tc.sitemaps, Scope: &MockScope{Out: "https://www.otherweb.com/listed"}})
+
+			assert.Equal(tc.expectedNodes, r.Nodes, tc.name)
+		})
+	}
+}
+
+func TestCrawlResume(t *testing.T) {
+	assert := assert.New(t)
+
+	// resumeTree returns the tree of a crawl interrupted after fetching the seed and one of its children
+	resumeTree := func() *data.Response {
+		return &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Status: 200, Nodes: []*data.Response{
+			{Depth: 1, Title: "Before", URL: "https://www.successweb.com/done", Status: 200, Nodes: make([]*data.Response, 0)},
+			{Depth: 1, URL: "https://www.successweb.com/pending", Nodes: make([]*data.Response, 0), Source: data.SourceLink},
+			{Depth: 1, URL: "https://www.successweb.com/aborted", Error: `Get "https://www.successweb.com/aborted": context canceled`, Nodes: make([]*data.Response, 0)},
+			{Depth: 1, URL: "https://www.successweb.com/broken", Status: 404, Error: "Not Found", Nodes: make([]*data.Response, 0)},
+			{Depth: 1, URL: "https://www.otherweb.com", Nodes: make([]*data.Response, 0), External: true},
+		}}
+	}
+
+	tt := []struct {
+		name            string
+		resume          *data.Response
+		expectedCalls   int32
+		expectedFetched int64
+		expectedNodes   []*data.Response
+	}{
+		{
+			name:            "Sites not fetched are fetched again",
+			resume:          resumeTree(),
+			expectedCalls:   2,
+			expectedFetched: 5,
+			expectedNodes: []*data.Response{
+				{Depth: 1, Title: "Before", URL: "https://www.successweb.com/done", Status: 200, Nodes: make([]*data.Response, 0)},
+				{Depth: 1, Title: "Fetched", URL: "https://www.successweb.com/pending", Status: 200, Nodes: make([]*data.Response, 0), Source: data.SourceLink},
+				{Depth: 1, Title: "Fetched", URL: "https://www.successweb.com/aborted", Status: 200, Nodes: make([]*data.Response, 0)},
+				{Depth: 1, URL: "https://www.successweb.com/broken", Status: 404, Error: "Not Found", Nodes: make([]*data.Response, 0)},
+				{Depth: 1, URL: "https://www.otherweb.com", Nodes: make([]*data.Response, 0), External: true},
+			},
+		},
+		{
+			name:            "Seed not fetched starts over",
+			resume:          &data.Response{Depth: 0, URL: "https://www.successweb.com", Nodes: make([]*data.Response, 0)},
+			expectedCalls:   1,
+			expectedFetched: 1,
+			expectedNodes:   make([]*data.Response, 0),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := url.ParseRequestURI("https://www.successweb.com")
+			assert.NoError(err)
+
+			m := MockWorker{State: resumedResponse}
+			c := crawler.NewCrawler(&m)
+			progress := &data.Progress{}
+
+			r := c.Crawl(context.Background(), u, 3, data.Options{Resume: tc.resume, Progress: progress})
+
+			assert.Equal(tc.expectedCalls, atomic.LoadInt32(&m.calls), tc.name)
+			assert.Equal(tc.expectedFetched, progress.Snapshot().Fetched, tc.name)
+			assert.Equal("Success Web", r.Title, tc.name)
+			assert.Equal(tc.expectedNodes, r.Nodes, tc.name)
+		})
+	}
+}
+
+type MockCollector struct{}
+
+func (c *MockCollector) Collect(ctx context.Context, url string) (*links.Page, error) {
+	return &links.Page{StatusCode: 200, URL: url, Title: "Success Web"}, nil
+}
+
+type MockRobots struct {
+	Slow bool
+}
+
+func (r *MockRobots) Allowed(ctx context.Context, url string) (bool, error) {
+	if r.Slow {
+		// robots.txt answers once the crawl is stopped
+		<-ctx.Done()
+		return false, ctx.Err()
+	}
+	return true, nil
+}
+
+func TestCrawlResumeRobotsTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	u, err := url.ParseRequestURI("https://www.successweb.com")
+	assert.NoError(err)
+
+	// The budget runs out while robots.txt is fetched, the seed is not reported as disallowed
+	c := crawler.NewCrawler(worker.NewWorker(&MockCollector{}, worker.WithRobots(&MockRobots{Slow: true})))
+	r := c.Crawl(context.Background(), u, 2, data.Options{Timeout: 20 * time.Millisecond})
+	assert.True(r.Truncated)
+	assert.Equal("", r.Skipped)
+	assert.Equal(0, r.Status)
+
+	// The seed is fetched when the crawl resumes
+	c = crawler.NewCrawler(worker.NewWorker(&MockCollector{}, worker.WithRobots(&MockRobots{})))
+	r = c.Crawl(context.Background(), u, 2, data.Options{Resume: r})
+	assert.False(r.Truncated)
+	assert.Equal(200, r.Status)
+	assert.Equal("Success Web", r.Title)
+}
+
+type MockLinkChecker struct {
+	Concurrency int
+	Err         error
+}
+
+func (l *MockLinkChecker) Report(ctx context.Context, tree *data.Response, concurrency int, limits scheduler.Limits) *data.LinkReport {
+	l.Concurrency, l.Err = concurrency, ctx.Err()
+	return &data.LinkReport{Broken: make([]*data.BrokenLink, 0)}
+}
+
+func TestCrawlLinkCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	u, err := url.ParseRequestURI("https://www.successweb.com")
+	assert.NoError(err)
+
+	// The crawl runs out of budget, its links are checked by the pool of the crawler within a budget of their own
+	l := &MockLinkChecker{}
+	c := crawler.NewCrawler(&MockWorker{State: slowResponse}, crawler.WithConcurrency(4), crawler.WithLinkChecker(l))
+	r := c.Crawl(context.Background(), u, 2, data.Options{Mode: data.ModeLinkCheck, Timeout: 20 * time.Millisecond})
+
+	assert.True(r.Truncated)
+	assert.NotNil(r.LinkCheck)
+	assert.Equal(4, l.Concurrency)
+	assert.NoError(l.Err)
+}
+
+type MockCheckpointer struct {
+	sync.Mutex
+	Trees []*data.Response
+}
+
+func (c *MockCheckpointer) Checkpoint(tree *data.Response) {
+	c.Lock()
+	defer c.Unlock()
+	c.Trees = append(c.Trees, tree)
+}
+
+func TestCrawlCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+
+	u, err := url.ParseRequestURI("https://www.successweb.com")
+	assert.NoError(err)
+
+	m := MockWorker{State: slowResponse}
+	c := crawler.NewCrawler(&m)
+	cp := &MockCheckpointer{}
+
+	r := c.Crawl(context.Background(), u, 2, data.Options{Timeout: 50 * time.Millisecond, Checkpointer: cp, CheckpointInterval: 5 * time.Millisecond})
+
+	// The child being fetched is checkpointed without its details, the result is a different tree
+	cp.Lock()
+	defer cp.Unlock()
+	assert.True(len(cp.Trees) > 0)
+	last := cp.Trees[len(cp.Trees)-1]
+	assert.Equal(&data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{
+		{Depth: 1, URL: "https://www.successweb.com/slow", Nodes: make([]*data.Response, 0)},
+	}}, last)
+	assert.True(r.Truncated)
+	assert.NotSame(r, last)
+}
@@ -1,6 +1,14 @@
 package data
 
-import "sync"
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/PuerkitoBio/purell"
+)
 
 // Response model the response to API call
 type Response struct {
@@ -8,10 +16,342 @@ type Response struct {
 	Title string      `json:"title" description:"Title of a site fetched by the crawler"`
 	URL   string      `json:"url" description:"URL of a site fetched by the crawler"`
 	Nodes []*Response `json:"nodes" description:"Children of a site fetched by the crawler"`
+
+	Status        int        `json:"status,omitempty" description:"HTTP status code of the site"`
+	FinalURL      string     `json:"final_url,omitempty" description:"URL of the site after redirects"`
+	Redirects     []Redirect `json:"redirects,omitempty" description:"Redirects followed to fetch the site, in order"`
+	RedirectLoop  bool       `json:"redirect_loop,omitempty" description:"Redirects of the site loop back to a URL already requested"`
+	LongRedirects bool       `json:"long_redirects,omitempty" description:"Site reached through more redirects than the configured limit"`
+	ContentType   string     `json:"content_type,omitempty" description:"Content-Type of the site"`
+	ContentLength int64      `json:"content_length,omitempty" description:"Size in bytes of the site body"`
+	ResponseTime  int64      `json:"response_time_ms,omitempty" description:"Time in milliseconds to fetch the site"`
+	LastModified  string     `json:"last_modified,omitempty" description:"Last-Modified header of the site"`
+	Unchanged     bool       `json:"unchanged,omitempty" description:"Site not modified since it was cached, its title and links are the cached ones"`
+	Error         string     `json:"error,omitempty" description:"Error fetching the site"`
+
+	Canonical       string  `json:"canonical,omitempty" description:"Canonical URL of the site given by its Link header or a link rel=canonical element"`
+	ContentHash     string  `json:"content_hash,omitempty" description:"Hash of the visible text of the site with its whitespace collapsed"`
+	SimHash         uint64  `json:"simhash,omitempty,string" description:"SimHash fingerprint of the visible text of the site"`
+	DuplicateOf     string  `json:"duplicate_of,omitempty" description:"URL of the site this one duplicates, a duplicate is not expanded"`
+	DuplicateBy     string  `json:"duplicate_by,omitempty" description:"Why the site is a duplicate: canonical or content"`
+	NearDuplicateOf string  `json:"near_duplicate_of,omitempty" description:"URL of the site whose text this one nearly duplicates"`
+	Similarity      float64 `json:"similarity,omitempty" description:"Share of the fingerprint bits the site has in common with the site it nearly duplicates"`
+
+	Source    string   `json:"source,omitempty" description:"How the site was found: link or sitemap"`
+	External  bool     `json:"external,omitempty" description:"Site out of the crawl scope, recorded but not expanded"`
+	Skipped   string   `json:"skipped,omitempty" description:"Reason a site was not fetched by the crawler"`
+	Truncated bool     `json:"truncated,omitempty" description:"Crawl stopped before completion, set on the seed site only"`
+	Limits    []string `json:"limits,omitempty" description:"Limits that stopped the crawl from expanding, set on the seed site only"`
+
+	LinkCheck      *LinkReport         `json:"linkcheck,omitempty" description:"Broken links found by a linkcheck crawl, set on the seed site only"`
+	Duplicates     []*DuplicateCluster `json:"duplicates,omitempty" description:"Clusters of duplicate sites, set on the seed site only"`
+	NearDuplicates []*DuplicateCluster `json:"near_duplicates,omitempty" description:"Clusters of near duplicate sites, set on the seed site only"`
+
+	// Links of the site, including those not registered as children, used to build the graph
+	Links []Link `json:"-"`
+}
+
+// Key returns the URL a site is known by, its canonical URL or else its URL after redirects, normalized
+func (r *Response) Key() string {
+	if r.Canonical != "" {
+		return NormalizeKey(r.Canonical)
+	}
+	if r.FinalURL != "" {
+		return NormalizeKey(r.FinalURL)
+	}
+	return NormalizeKey(r.URL)
+}
+
+// Walk calls fn on every site of the tree, parents before their children
+func (r *Response) Walk(fn func(*Response)) {
+	fn(r)
+	for _, child := range r.Nodes {
+		child.Walk(fn)
+	}
 }
 
+// NormalizeKey returns a URL normalized without the trailing slash of its path, so /story/ and /story match
+func NormalizeKey(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	parsed, err = url.Parse(purell.NormalizeURL(parsed, purell.FlagsSafe|purell.FlagRemoveDuplicateSlashes|purell.FlagRemoveFragment))
+	if err != nil {
+		return u
+	}
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/")
+	return parsed.String()
+}
+
+// Redirect models a hop of the redirect chain of a site
+type Redirect struct {
+	URL      string `json:"url" description:"URL requested"`
+	Status   int    `json:"status" description:"HTTP status code of the redirect"`
+	Location string `json:"location" description:"Location header of the redirect"`
+}
+
+// Link models a link of a site, to another page or to a resource such as an image or a script
+type Link struct {
+	URL     string `json:"url" description:"Absolute and normalized URL of the link"`
+	Text    string `json:"text,omitempty" description:"Anchor text of the link, or alt text of an image or area"`
+	Rel     string `json:"rel,omitempty" description:"Rel attribute of the link"`
+	Element string `json:"element,omitempty" description:"HTML element of the link: a, area, img, script, link, iframe, form, video, audio, source or object"`
+	Attr    string `json:"attr,omitempty" description:"Attribute of the element holding the URL: href, src, srcset, action or data"`
+}
+
+// Navigational reports whether a link leads to another page the crawl may follow, <a> and <area> links.
+// Links without an element were collected before resources were and are anchors
+func (l Link) Navigational() bool {
+	return l.Element == "" || l.Element == "a" || l.Element == "area"
+}
+
+// LinkReport models the link targets checked by a linkcheck crawl, the broken ones are grouped by target
+type LinkReport struct {
+	Checked   int           `json:"checked" description:"Link targets checked"`
+	Unchecked int           `json:"unchecked,omitempty" description:"Link targets not checked as the crawl stopped or robots.txt disallows them"`
+	Broken    []*BrokenLink `json:"broken" description:"Broken link targets sorted by URL"`
+	Truncated bool          `json:"truncated,omitempty" description:"Checks stopped by their budget or the client before every target was checked"`
+}
+
+// BrokenLink models a link target that could not be fetched or answered with an error status
+type BrokenLink struct {
+	URL     string       `json:"url" description:"URL of the link target"`
+	Status  int          `json:"status,omitempty" description:"HTTP status code of the target"`
+	Type    string       `json:"type" description:"Type of error: dns, tls, timeout, connection, redirect, request, 4xx or 5xx"`
+	Error   string       `json:"error,omitempty" description:"Error fetching the target"`
+	Sources []LinkSource `json:"sources" description:"Pages linking to the target"`
+}
+
+// LinkSource models a page linking to a broken target
+type LinkSource struct {
+	URL     string `json:"url" description:"URL of the page holding the link"`
+	Text    string `json:"text,omitempty" description:"Anchor text of the link, or alt text of an image or area"`
+	Element string `json:"element,omitempty" description:"HTML element of the link"`
+	Attr    string `json:"attr,omitempty" description:"Attribute of the element holding the URL"`
+}
+
+// DuplicateCluster models a site crawled and the sites found to duplicate it, or nearly
+type DuplicateCluster struct {
+	URL         string      `json:"url" description:"URL of the site expanded"`
+	Canonical   string      `json:"canonical,omitempty" description:"Canonical URL of the site"`
+	ContentHash string      `json:"content_hash,omitempty" description:"Hash of the visible text of the site"`
+	SimHash     uint64      `json:"simhash,omitempty,string" description:"SimHash fingerprint of the visible text of the site"`
+	Duplicates  []Duplicate `json:"duplicates" description:"Sites duplicating it, in tree order"`
+}
+
+// Duplicate models a site duplicating another one
+type Duplicate struct {
+	URL        string  `json:"url" description:"URL of the duplicate site"`
+	By         string  `json:"by" description:"Why the site is a duplicate: canonical, content or near"`
+	Similarity float64 `json:"similarity,omitempty" description:"Share of the fingerprint bits of a near duplicate in common with the site"`
+}
+
+// Reasons a site is a duplicate
+const (
+	// DuplicateCanonical marks a site with the canonical URL of a site already crawled
+	DuplicateCanonical = "canonical"
+	// DuplicateContent marks a site with the content of a site already crawled
+	DuplicateContent = "content"
+	// DuplicateNear marks a site with a text fingerprint close to the one of a site already crawled
+	DuplicateNear = "near"
+)
+
+// Deduper finds the sites that duplicate a site already crawled, exactly or nearly
+type Deduper interface {
+	Seen(node *Response) (original, by string, dup bool)
+	Near(node *Response) (original string, similarity float64, near bool)
+}
+
+// Modes of a crawl
+const (
+	// ModeCrawl builds the tree of the sites crawled
+	ModeCrawl = "crawl"
+	// ModeLinkCheck also checks every link target of the pages crawled and reports the broken ones
+	ModeLinkCheck = "linkcheck"
+)
+
+// SkippedRobots marks a site disallowed by robots.txt
+const SkippedRobots = "robots"
+
+// Sources of a site
+const (
+	// SourceLink marks a site found in the links of its parent
+	SourceLink = "link"
+	// SourceSitemap marks a site listed in the sitemaps of the seed site
+	SourceSitemap = "sitemap"
+)
+
 // Visited keeps track of visited sites to avoid loops
 type Visited struct {
 	sync.RWMutex
 	M map[string]bool
 }
+
+// Scoper decides whether a link is followed by a crawl
+type Scoper interface {
+	InScope(u *url.URL) bool
+}
+
+// Redirecter is a scope that follows the seed to the URL it was redirected to
+type Redirecter interface {
+	Redirected(final *url.URL)
+}
+
+// Names of the crawl limits
+const (
+	LimitMaxPages        = "max_pages"
+	LimitMaxLinksPerPage = "max_links_per_page"
+	LimitMaxPagesPerHost = "max_pages_per_host"
+)
+
+// Scorer ranks the sites of a best first crawl, the higher the score the sooner a site is fetched
+type Scorer interface {
+	Score(node *Response) float64
+}
+
+// Limits model the size limits of a crawl, zero values disable a limit
+type Limits struct {
+	MaxPages        int
+	MaxLinksPerPage int
+	MaxPagesPerHost int
+}
+
+// Crawl keeps the settings and state shared by the workers of a single crawl
+type Crawl struct {
+	sync.Mutex
+	MaxDepth        int
+	MaxLinksPerPage int
+	Scope           Scoper
+	Visited         *Visited
+	Dedup           Deduper
+	// SkipNear stops the near duplicates from being expanded
+	SkipNear  bool
+	limitsHit []string
+}
+
+// Hit records a limit that stopped the crawl from expanding
+func (c *Crawl) Hit(limit string) {
+	c.Lock()
+	defer c.Unlock()
+	for _, l := range c.limitsHit {
+		if l == limit {
+			return
+		}
+	}
+	c.limitsHit = append(c.limitsHit, limit)
+}
+
+// LimitsHit returns the limits hit in the order they were hit
+func (c *Crawl) LimitsHit() []string {
+	c.Lock()
+	defer c.Unlock()
+	return append([]string(nil), c.limitsHit...)
+}
+
+// Options model the per request crawl settings, zero values fall back to the crawler defaults
+type Options struct {
+	Limits
+	Concurrency int
+	Timeout     time.Duration
+	Scope       Scoper
+	// Sitemaps adds the pages listed in the sitemaps of the seed site at depth 1
+	Sitemaps bool
+
+	// Strategy is the order the sites of every host are fetched in: bfs, dfs or best, Scorer ranks them for
+	// best first. A crawl with a Seed fetches a site at a time and breaks ties with it, so it is reproducible
+	Strategy string
+	Scorer   Scorer
+	Seed     int64
+
+	// Mode is crawl or linkcheck, a linkcheck crawl reports the broken links of the pages crawled
+	Mode string
+
+	// Politeness limits applied to every host
+	HostConcurrency int
+	HostDelay       time.Duration
+	HostRPS         float64
+
+	// Progress is updated by the crawl when set
+	Progress *Progress
+	// Observer is notified of every site of the crawl when set
+	Observer Observer
+
+	// Resume is the partial tree of an interrupted crawl, its sites already fetched are kept and the others
+	// are fetched again
+	Resume *Response
+	// Checkpointer is handed a copy of the tree at every checkpoint interval when set
+	Checkpointer       Checkpointer
+	CheckpointInterval time.Duration
+	// Params are the request parameters the options were parsed from, kept to resume the crawl
+	Params url.Values
+}
+
+// Event reports a site processed by a crawl, fetched or recorded as a leaf
+type Event struct {
+	URL       string `json:"url" description:"URL of the site"`
+	Parent    string `json:"parent,omitempty" description:"URL of the site linking to it, empty for the seed site"`
+	Depth     int    `json:"depth" description:"Depth of URL from seed website"`
+	Title     string `json:"title" description:"Title of the site"`
+	Status    int    `json:"status,omitempty" description:"HTTP status code of the site"`
+	Unchanged bool   `json:"unchanged,omitempty" description:"Site not modified since it was cached"`
+	Error     string `json:"error,omitempty" description:"Error fetching the site"`
+	Source    string `json:"source,omitempty" description:"How the site was found: link or sitemap"`
+	External  bool   `json:"external,omitempty" description:"Site out of the crawl scope"`
+	Skipped   string `json:"skipped,omitempty" description:"Reason the site was not fetched"`
+
+	DuplicateOf     string `json:"duplicate_of,omitempty" description:"URL of the site this one duplicates"`
+	NearDuplicateOf string `json:"near_duplicate_of,omitempty" description:"URL of the site whose text this one nearly duplicates"`
+}
+
+// Checkpointer saves the state of a running crawl. The tree handed over is a copy, sites queued or being
+// fetched only have their URL, depth, source and external flag
+type Checkpointer interface {
+	Checkpoint(tree *Response)
+}
+
+// Observer is notified of the sites of a crawl as they are processed. Parents are observed before their
+// children and calls are made from a single goroutine, a slow observer slows the crawl down
+type Observer interface {
+	Observe(e Event)
+}
+
+// Progress counts the sites of a running crawl, it is safe for concurrent use
+type Progress struct {
+	Discovered int64 `json:"discovered" description:"Links registered by the crawl"`
+	Queued     int64 `json:"queued" description:"Sites queued to be fetched"`
+	Fetched    int64 `json:"fetched" description:"Sites processed by the workers"`
+}
+
+// Discover counts links registered by the crawl
+func (p *Progress) Discover(n int) {
+	if p != nil {
+		atomic.AddInt64(&p.Discovered, int64(n))
+	}
+}
+
+// Queue counts a site queued to be fetched
+func (p *Progress) Queue() {
+	if p != nil {
+		atomic.AddInt64(&p.Queued, 1)
+	}
+}
+
+// Fetch counts a site processed by the workers
+func (p *Progress) Fetch() {
+	if p != nil {
+		atomic.AddInt64(&p.Fetched, 1)
+	}
+}
+
+// Snapshot returns a copy of the counters
+func (p *Progress) Snapshot() Progress {
+	if p == nil {
+		return Progress{}
+	}
+	return Progress{
+		Discovered: atomic.LoadInt64(&p.Discovered),
+		Queued:     atomic.LoadInt64(&p.Queued),
+		Fetched:    atomic.LoadInt64(&p.Fetched),
+	}
+}
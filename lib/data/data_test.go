@@ -0,0 +1,32 @@
+package data_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+)
+
+func TestWalk(t *testing.T) {
+	assert := assert.New(t)
+
+	tree := &data.Response{URL: "https://www.successweb.com", Nodes: []*data.Response{
+		{URL: "https://www.successweb.com/a", Nodes: []*data.Response{
+			{URL: "https://www.successweb.com/a/a", Nodes: []*data.Response{}},
+		}},
+		{URL: "https://www.successweb.com/b", Nodes: []*data.Response{}},
+	}}
+
+	// Parents are visited before their children, siblings in tree order
+	urls := make([]string, 0)
+	tree.Walk(func(n *data.Response) {
+		urls = append(urls, n.URL)
+	})
+	assert.Equal([]string{
+		"https://www.successweb.com",
+		"https://www.successweb.com/a",
+		"https://www.successweb.com/a/a",
+		"https://www.successweb.com/b",
+	}, urls)
+}
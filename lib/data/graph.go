@@ -0,0 +1,155 @@
+package data
+
+// Graph models a crawl as a node table keyed by canonical URL and the links between its sites
+type Graph struct {
+	Nodes     map[string]*GraphNode `json:"nodes" description:"Sites of the crawl keyed by canonical URL, or by URL after redirects when they have none"`
+	Edges     []*Edge               `json:"edges" description:"Links between the sites of the crawl"`
+	Resources []*Edge               `json:"resources,omitempty" description:"Resources used by the sites of the crawl, such as images, scripts and stylesheets"`
+	Truncated bool                  `json:"truncated,omitempty" description:"Crawl stopped before completion"`
+	Limits    []string              `json:"limits,omitempty" description:"Limits that stopped the crawl from expanding"`
+
+	Duplicates     []*DuplicateCluster `json:"duplicates,omitempty" description:"Clusters of duplicate sites"`
+	NearDuplicates []*DuplicateCluster `json:"near_duplicates,omitempty" description:"Clusters of near duplicate sites"`
+}
+
+// GraphNode models a site of the graph
+type GraphNode struct {
+	Depth           int        `json:"depth" description:"Depth of URL from seed website"`
+	URLs            []string   `json:"urls,omitempty" description:"URLs of the crawl redirected or canonicalized to the site"`
+	Title           string     `json:"title" description:"Title of a site fetched by the crawler"`
+	Status          int        `json:"status,omitempty" description:"HTTP status code of the site"`
+	FinalURL        string     `json:"final_url,omitempty" description:"URL of the site after redirects"`
+	Redirects       []Redirect `json:"redirects,omitempty" description:"Redirects followed to fetch the site, in order"`
+	RedirectLoop    bool       `json:"redirect_loop,omitempty" description:"Redirects of the site loop back to a URL already requested"`
+	LongRedirects   bool       `json:"long_redirects,omitempty" description:"Site reached through more redirects than the configured limit"`
+	ContentType     string     `json:"content_type,omitempty" description:"Content-Type of the site"`
+	ContentLength   int64      `json:"content_length,omitempty" description:"Size in bytes of the site body"`
+	ResponseTime    int64      `json:"response_time_ms,omitempty" description:"Time in milliseconds to fetch the site"`
+	Unchanged       bool       `json:"unchanged,omitempty" description:"Site not modified since it was cached"`
+	Error           string     `json:"error,omitempty" description:"Error fetching the site"`
+	Canonical       string     `json:"canonical,omitempty" description:"Canonical URL of the site"`
+	DuplicateOf     string     `json:"duplicate_of,omitempty" description:"URL of the site this one duplicates"`
+	NearDuplicateOf string     `json:"near_duplicate_of,omitempty" description:"URL of the site whose text this one nearly duplicates"`
+	Similarity      float64    `json:"similarity,omitempty" description:"Share of the fingerprint bits the site has in common with the site it nearly duplicates"`
+	Source          string     `json:"source,omitempty" description:"How the site was found: link or sitemap"`
+	External        bool       `json:"external,omitempty" description:"Site out of the crawl scope, recorded but not expanded"`
+	Skipped         string     `json:"skipped,omitempty" description:"Reason a site was not fetched by the crawler"`
+}
+
+// Edge models a link from a site to another site of the graph, or to a resource
+type Edge struct {
+	Source  string `json:"source" description:"URL of the linking site"`
+	Target  string `json:"target" description:"URL of the linked site or resource"`
+	Text    string `json:"text,omitempty" description:"Anchor text of the link"`
+	Rel     string `json:"rel,omitempty" description:"Rel attribute of the link"`
+	Element string `json:"element,omitempty" description:"HTML element of a resource link"`
+	Attr    string `json:"attr,omitempty" description:"Attribute of the element holding the resource URL"`
+}
+
+// Graph returns the crawl tree as a graph. Sites are keyed as the duplicates are, so the URLs redirected or
+// canonicalized to a page are a single node. Every link of a fetched site to a site of the crawl is an edge,
+// so cross-links and sites linked from many places are kept, links to sites out of the crawl are dropped.
+// Links to resources are listed apart whatever their target
+func (r *Response) Graph() *Graph {
+	g := &Graph{
+		Nodes:          make(map[string]*GraphNode),
+		Edges:          make([]*Edge, 0),
+		Truncated:      r.Truncated,
+		Limits:         r.Limits,
+		Duplicates:     r.Duplicates,
+		NearDuplicates: r.NearDuplicates,
+	}
+
+	// Sites in breadth first order, each URL is registered once by the workers
+	sites := []*Response{r}
+	for i := 0; i < len(sites); i++ {
+		sites = append(sites, sites[i].Nodes...)
+	}
+	// The site owning its key describes the node, else the first site found
+	keys := make(map[string]string)
+	owners := make(map[string]bool)
+	for _, s := range sites {
+		k := s.Key()
+		keys[s.URL] = k
+		own := NormalizeKey(s.URL) == k
+		n, ok := g.Nodes[k]
+		if !ok || own && !owners[k] {
+			urls := []string(nil)
+			if ok {
+				urls = n.URLs
+			}
+			n = newGraphNode(s)
+			n.URLs = urls
+			g.Nodes[k] = n
+			owners[k] = own
+		}
+		if !own {
+			n.URLs = append(n.URLs, s.URL)
+		}
+	}
+	// Links to the URL a site was redirected to lead to the site too
+	for _, s := range sites {
+		if _, ok := keys[s.FinalURL]; s.FinalURL != "" && !ok {
+			keys[s.FinalURL] = keys[s.URL]
+		}
+	}
+
+	// Same links of a site are merged, tree children always have an edge from their parent
+	seen := make(map[Edge]bool)
+	linked := make(map[[2]string]bool)
+	add := func(e Edge) {
+		if seen[e] {
+			return
+		}
+		seen[e] = true
+		linked[[2]string{e.Source, e.Target}] = true
+		g.Edges = append(g.Edges, &e)
+	}
+	resources := make(map[Edge]bool)
+	for _, s := range sites {
+		source := keys[s.URL]
+		for _, l := range s.Links {
+			if !l.Navigational() {
+				e := Edge{Source: source, Target: l.URL, Text: l.Text, Rel: l.Rel, Element: l.Element, Attr: l.Attr}
+				if !resources[e] {
+					resources[e] = true
+					g.Resources = append(g.Resources, &e)
+				}
+				continue
+			}
+			if target, ok := keys[l.URL]; ok {
+				add(Edge{Source: source, Target: target, Text: l.Text, Rel: l.Rel})
+			}
+		}
+		for _, child := range s.Nodes {
+			if !linked[[2]string{source, keys[child.URL]}] {
+				add(Edge{Source: source, Target: keys[child.URL]})
+			}
+		}
+	}
+	return g
+}
+
+func newGraphNode(r *Response) *GraphNode {
+	return &GraphNode{
+		Depth:           r.Depth,
+		Title:           r.Title,
+		Status:          r.Status,
+		FinalURL:        r.FinalURL,
+		Redirects:       r.Redirects,
+		RedirectLoop:    r.RedirectLoop,
+		LongRedirects:   r.LongRedirects,
+		ContentType:     r.ContentType,
+		ContentLength:   r.ContentLength,
+		ResponseTime:    r.ResponseTime,
+		Unchanged:       r.Unchanged,
+		Error:           r.Error,
+		Canonical:       r.Canonical,
+		DuplicateOf:     r.DuplicateOf,
+		NearDuplicateOf: r.NearDuplicateOf,
+		Similarity:      r.Similarity,
+		Source:          r.Source,
+		External:        r.External,
+		Skipped:         r.Skipped,
+	}
+}
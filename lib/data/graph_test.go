@@ -0,0 +1,86 @@
+package data_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+)
+
+func TestGraph(t *testing.T) {
+	assert := assert.New(t)
+
+	// The seed links to a and b, b links back to the seed and to a which is registered under the seed only
+	a := &data.Response{Depth: 1, Title: "A", URL: "https://www.successweb.com/a", Nodes: []*data.Response{}, Status: 200}
+	b := &data.Response{Depth: 1, Title: "B", URL: "https://www.successweb.com/b", Nodes: []*data.Response{}, Status: 200, Links: []data.Link{
+		{URL: "https://www.successweb.com", Text: "Home"},
+		{URL: "https://www.successweb.com/a", Text: "See A", Rel: "nofollow"},
+		{URL: "https://www.successweb.com/a", Text: "See A", Rel: "nofollow"},
+		{URL: "https://www.otherweb.com/not-crawled"},
+		{URL: "https://www.successweb.com/logo.png", Text: "Logo", Element: "img", Attr: "src"},
+		{URL: "https://www.successweb.com/a", Element: "iframe", Attr: "src"},
+	}}
+	ext := &data.Response{Depth: 1, URL: "https://www.otherweb.com", Nodes: []*data.Response{}, External: true}
+	seed := &data.Response{Depth: 0, Title: "Seed", URL: "https://www.successweb.com", Nodes: []*data.Response{a, b, ext}, Status: 200, Truncated: true, Links: []data.Link{
+		{URL: "https://www.successweb.com/a", Text: "A"},
+		{URL: "https://www.successweb.com/b", Text: "B", Element: "a", Attr: "href"},
+		{URL: "https://www.successweb.com/logo.png", Text: "Logo", Element: "img", Attr: "src"},
+		{URL: "https://www.successweb.com/logo.png", Text: "Logo", Element: "img", Attr: "src"},
+	}}
+
+	g := seed.Graph()
+
+	assert.Equal(map[string]*data.GraphNode{
+		"https://www.successweb.com":   {Depth: 0, Title: "Seed", Status: 200},
+		"https://www.successweb.com/a": {Depth: 1, Title: "A", Status: 200},
+		"https://www.successweb.com/b": {Depth: 1, Title: "B", Status: 200},
+		"https://www.otherweb.com":     {Depth: 1, External: true},
+	}, g.Nodes)
+	assert.Equal([]*data.Edge{
+		{Source: "https://www.successweb.com", Target: "https://www.successweb.com/a", Text: "A"},
+		{Source: "https://www.successweb.com", Target: "https://www.successweb.com/b", Text: "B"},
+		{Source: "https://www.successweb.com", Target: "https://www.otherweb.com"},
+		{Source: "https://www.successweb.com/b", Target: "https://www.successweb.com", Text: "Home"},
+		{Source: "https://www.successweb.com/b", Target: "https://www.successweb.com/a", Text: "See A", Rel: "nofollow"},
+	}, g.Edges)
+	// Resources are listed apart, even when they are also a site of the crawl
+	assert.Equal([]*data.Edge{
+		{Source: "https://www.successweb.com", Target: "https://www.successweb.com/logo.png", Text: "Logo", Element: "img", Attr: "src"},
+		{Source: "https://www.successweb.com/b", Target: "https://www.successweb.com/logo.png", Text: "Logo", Element: "img", Attr: "src"},
+		{Source: "https://www.successweb.com/b", Target: "https://www.successweb.com/a", Element: "iframe", Attr: "src"},
+	}, g.Resources)
+	assert.True(g.Truncated)
+}
+
+func TestGraphKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	// old redirects to new, amp is canonicalized to story and found before it
+	old := &data.Response{Depth: 1, Title: "New", URL: "https://www.successweb.com/old", FinalURL: "https://www.successweb.com/new", Nodes: []*data.Response{}, Status: 200}
+	amp := &data.Response{Depth: 1, Title: "Story AMP", URL: "https://www.successweb.com/story?amp=1", Canonical: "https://www.successweb.com/story/", Nodes: []*data.Response{}, Status: 200}
+	story := &data.Response{Depth: 1, Title: "Story", URL: "https://www.successweb.com/story", Nodes: []*data.Response{}, Status: 200, Links: []data.Link{
+		{URL: "https://www.successweb.com/new", Text: "New"},
+		{URL: "https://www.successweb.com/", Text: "Home"},
+	}}
+	seed := &data.Response{Depth: 0, Title: "Seed", URL: "https://www.successweb.com/", Nodes: []*data.Response{old, amp, story}, Status: 200, Links: []data.Link{
+		{URL: "https://www.successweb.com/old", Text: "Old"},
+		{URL: "https://www.successweb.com/story?amp=1", Text: "AMP"},
+		{URL: "https://www.successweb.com/story", Text: "Story"},
+	}}
+
+	g := seed.Graph()
+
+	assert.Equal(map[string]*data.GraphNode{
+		"https://www.successweb.com":       {Depth: 0, Title: "Seed", Status: 200},
+		"https://www.successweb.com/new":   {Depth: 1, Title: "New", Status: 200, FinalURL: "https://www.successweb.com/new", URLs: []string{"https://www.successweb.com/old"}},
+		"https://www.successweb.com/story": {Depth: 1, Title: "Story", Status: 200, URLs: []string{"https://www.successweb.com/story?amp=1"}},
+	}, g.Nodes)
+	assert.Equal([]*data.Edge{
+		{Source: "https://www.successweb.com", Target: "https://www.successweb.com/new", Text: "Old"},
+		{Source: "https://www.successweb.com", Target: "https://www.successweb.com/story", Text: "AMP"},
+		{Source: "https://www.successweb.com", Target: "https://www.successweb.com/story", Text: "Story"},
+		{Source: "https://www.successweb.com/story", Target: "https://www.successweb.com/new", Text: "New"},
+		{Source: "https://www.successweb.com/story", Target: "https://www.successweb.com", Text: "Home"},
+	}, g.Edges)
+}
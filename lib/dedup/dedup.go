@@ -0,0 +1,172 @@
+package dedup
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/simhash"
+)
+
+// DefaultNearDistance is the number of bits the text fingerprints of near duplicates differ by at most
+const DefaultNearDistance = 3
+
+// Index keeps the canonical URL, the content hash and the text fingerprint of the sites of a crawl to find
+// their duplicates, it is safe for concurrent use
+type Index struct {
+	sync.Mutex
+	canonical map[string]string
+	owned     map[string]bool
+	demoted   map[string]string
+	content   map[string]string
+	near      *simhash.Index
+}
+
+// Option sets a setting of the index
+type Option func(*Index)
+
+// WithNear also finds the near duplicates, the sites whose text fingerprints differ by at most distance bits
+// from the one of a site already crawled
+func WithNear(distance int) Option {
+	return func(i *Index) {
+		i.near = simhash.NewIndex(distance)
+	}
+}
+
+// NewIndex returns a pointer to a new empty index
+func NewIndex(opts ...Option) *Index {
+	i := &Index{
+		canonical: make(map[string]string),
+		owned:     make(map[string]bool),
+		demoted:   make(map[string]string),
+		content:   make(map[string]string),
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+// Seen registers a site and returns the site already registered with the same canonical URL or, failing
+// that, the same content hash. A site without a canonical URL is its own canonical URL after redirects and
+// only the sites fetched with a 200 status, or unchanged since cached, are compared. The canonical page
+// owns its canonical URL, a site registered with it before is demoted and reported by Resolve
+func (i *Index) Seen(node *data.Response) (string, string, bool) {
+	if node.Status != http.StatusOK && !node.Unchanged {
+		return "", "", false
+	}
+	canonical := node.Key()
+	own := owns(node, canonical)
+
+	i.Lock()
+	defer i.Unlock()
+	demoted := ""
+	if orig, ok := i.canonical[canonical]; ok && orig != node.URL {
+		if !own || i.owned[canonical] {
+			return orig, data.DuplicateCanonical, true
+		}
+		demoted = orig
+		i.demoted[orig] = node.URL
+	}
+	// The site demoted does not make its canonical page a duplicate of its content
+	if orig, ok := i.content[node.ContentHash]; ok && node.ContentHash != "" && orig != node.URL && orig != demoted {
+		return orig, data.DuplicateContent, true
+	}
+	i.canonical[canonical] = node.URL
+	i.owned[canonical] = i.owned[canonical] || own
+	if node.ContentHash != "" {
+		i.content[node.ContentHash] = node.URL
+	}
+	return "", "", false
+}
+
+// Resolve marks the sites of a finished crawl demoted by their canonical page as its duplicates, along with
+// the sites found to duplicate them
+func (i *Index) Resolve(tree *data.Response) {
+	i.Lock()
+	defer i.Unlock()
+	if len(i.demoted) == 0 {
+		return
+	}
+	tree.Walk(func(n *data.Response) {
+		if canonical, ok := i.demoted[n.URL]; ok {
+			n.DuplicateOf, n.DuplicateBy = canonical, data.DuplicateCanonical
+			return
+		}
+		if canonical, ok := i.demoted[n.DuplicateOf]; ok {
+			n.DuplicateOf = canonical
+		}
+	})
+}
+
+// Near registers the text fingerprint of a site and returns the site already registered with the nearest
+// fingerprint within the distance of the index and their similarity. Near duplicates are not registered so
+// clusters gather around the first site seen, only the sites with text fetched with a 200 status, or
+// unchanged since cached, are compared
+func (i *Index) Near(node *data.Response) (string, float64, bool) {
+	if i.near == nil || node.SimHash == 0 || (node.Status != http.StatusOK && !node.Unchanged) {
+		return "", 0, false
+	}
+
+	i.Lock()
+	defer i.Unlock()
+	if orig, d, ok := i.near.Nearest(node.SimHash); ok && orig != node.URL {
+		return orig, simhash.Similarity(d), true
+	}
+	i.near.Add(node.URL, node.SimHash)
+	return "", 0, false
+}
+
+// owns reports whether a site is the page of a canonical URL, before or after redirects
+func owns(node *data.Response, canonical string) bool {
+	return data.NormalizeKey(node.URL) == canonical || node.FinalURL != "" && data.NormalizeKey(node.FinalURL) == canonical
+}
+
+// Clusters returns the duplicate clusters of a crawl tree sorted by the URL of the site expanded, nil when
+// there is no duplicate
+func Clusters(tree *data.Response) []*data.DuplicateCluster {
+	return clusters(tree, func(n *data.Response) (string, data.Duplicate) {
+		return n.DuplicateOf, data.Duplicate{URL: n.URL, By: n.DuplicateBy}
+	})
+}
+
+// NearClusters returns the near duplicate clusters of a crawl tree sorted by the URL of the site they nearly
+// duplicate, nil when there is no near duplicate
+func NearClusters(tree *data.Response) []*data.DuplicateCluster {
+	return clusters(tree, func(n *data.Response) (string, data.Duplicate) {
+		return n.NearDuplicateOf, data.Duplicate{URL: n.URL, By: data.DuplicateNear, Similarity: n.Similarity}
+	})
+}
+
+// clusters groups the sites of a tree by the site they duplicate, as given by of
+func clusters(tree *data.Response, of func(*data.Response) (string, data.Duplicate)) []*data.DuplicateCluster {
+	nodes := make(map[string]*data.Response)
+	found := make(map[string]*data.DuplicateCluster)
+	var list []*data.DuplicateCluster
+	tree.Walk(func(n *data.Response) {
+		if _, ok := nodes[n.URL]; !ok {
+			nodes[n.URL] = n
+		}
+	})
+	tree.Walk(func(n *data.Response) {
+		u, dup := of(n)
+		if u == "" {
+			return
+		}
+		c, ok := found[u]
+		if !ok {
+			c = &data.DuplicateCluster{URL: u}
+			if orig, ok := nodes[u]; ok {
+				c.Canonical, c.ContentHash, c.SimHash = orig.Canonical, orig.ContentHash, orig.SimHash
+			}
+			found[u] = c
+			list = append(list, c)
+		}
+		c.Duplicates = append(c.Duplicates, dup)
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].URL < list[j].URL
+	})
+	return list
+}
@@ -0,0 +1,298 @@
+package dedup_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/dedup"
+)
+
+func TestSeen(t *testing.T) {
+	assert := assert.New(t)
+
+	// Sites are registered in order on the same index
+	index := dedup.NewIndex()
+
+	tt := []struct {
+		name             string
+		node             *data.Response
+		expectedOriginal string
+		expectedBy       string
+		expectedDup      bool
+	}{
+		{
+			name: "First site",
+			node: &data.Response{URL: "https://medium.com/story", Status: 200, Canonical: "https://medium.com/story", ContentHash: "h1"},
+		},
+		{
+			name:             "Same canonical URL",
+			node:             &data.Response{URL: "https://medium.com/story?source=card", Status: 200, Canonical: "https://medium.com/story", ContentHash: "h2"},
+			expectedOriginal: "https://medium.com/story",
+			expectedBy:       data.DuplicateCanonical,
+			expectedDup:      true,
+		},
+		{
+			name:             "Same content",
+			node:             &data.Response{URL: "https://medium.com/story/amp", Status: 200, ContentHash: "h1"},
+			expectedOriginal: "https://medium.com/story",
+			expectedBy:       data.DuplicateContent,
+			expectedDup:      true,
+		},
+		{
+			name: "Site without canonical URL",
+			node: &data.Response{URL: "https://medium.com/about", Status: 200, FinalURL: "https://medium.com/about/", ContentHash: "h3"},
+		},
+		{
+			name:             "Canonical URL of a site without one",
+			node:             &data.Response{URL: "https://medium.com/about?ref=footer", Status: 200, Canonical: "https://medium.com/about/", ContentHash: "h4"},
+			expectedOriginal: "https://medium.com/about",
+			expectedBy:       data.DuplicateCanonical,
+			expectedDup:      true,
+		},
+		{
+			name: "Site without content",
+			node: &data.Response{URL: "https://medium.com/app", Status: 200},
+		},
+		{
+			name: "Other site without content",
+			node: &data.Response{URL: "https://medium.com/app2", Status: 200},
+		},
+		{
+			name: "Error pages are not compared",
+			node: &data.Response{URL: "https://medium.com/missing", Status: 404, ContentHash: "h1"},
+		},
+		{
+			name:             "Unchanged site compared",
+			node:             &data.Response{URL: "https://medium.com/cached", Status: 304, Unchanged: true, ContentHash: "h3"},
+			expectedOriginal: "https://medium.com/about",
+			expectedBy:       data.DuplicateContent,
+			expectedDup:      true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			orig, by, dup := index.Seen(tc.node)
+			assert.Equal(tc.expectedOriginal, orig, tc.name)
+			assert.Equal(tc.expectedBy, by, tc.name)
+			assert.Equal(tc.expectedDup, dup, tc.name)
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	assert := assert.New(t)
+
+	// A site linking to the canonical page is fetched before it
+	index := dedup.NewIndex()
+	card := &data.Response{URL: "https://medium.com/story?source=card", Status: 200, Canonical: "https://medium.com/story", ContentHash: "h1"}
+	feed := &data.Response{URL: "https://medium.com/story?source=feed", Status: 200, Canonical: "https://medium.com/story/", ContentHash: "h2"}
+	story := &data.Response{URL: "https://medium.com/story", Status: 200, Canonical: "https://medium.com/story", ContentHash: "h1"}
+	tag := &data.Response{URL: "https://medium.com/story?source=tag", Status: 200, Canonical: "https://medium.com/story", ContentHash: "h3"}
+	copied := &data.Response{URL: "https://medium.com/copy", Status: 200, ContentHash: "h1"}
+
+	tt := []struct {
+		name             string
+		node             *data.Response
+		expectedOriginal string
+		expectedBy       string
+		expectedDup      bool
+	}{
+		{
+			name: "Non canonical fetched before canonical",
+			node: card,
+		},
+		{
+			name:             "Canonical URL with a trailing slash",
+			node:             feed,
+			expectedOriginal: card.URL,
+			expectedBy:       data.DuplicateCanonical,
+			expectedDup:      true,
+		},
+		{
+			name: "Canonical page owns its canonical URL",
+			node: story,
+		},
+		{
+			name:             "Canonical URL owned",
+			node:             tag,
+			expectedOriginal: story.URL,
+			expectedBy:       data.DuplicateCanonical,
+			expectedDup:      true,
+		},
+		{
+			name:             "Content of the canonical page",
+			node:             copied,
+			expectedOriginal: story.URL,
+			expectedBy:       data.DuplicateContent,
+			expectedDup:      true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			orig, by, dup := index.Seen(tc.node)
+			if dup {
+				tc.node.DuplicateOf, tc.node.DuplicateBy = orig, by
+			}
+			assert.Equal(tc.expectedOriginal, orig, tc.name)
+			assert.Equal(tc.expectedBy, by, tc.name)
+			assert.Equal(tc.expectedDup, dup, tc.name)
+		})
+	}
+
+	// The site demoted and its duplicates are duplicates of the canonical page once resolved
+	index.Resolve(&data.Response{URL: "https://medium.com", Nodes: []*data.Response{card, feed, story, tag, copied}})
+	assert.Equal(story.URL, card.DuplicateOf)
+	assert.Equal(data.DuplicateCanonical, card.DuplicateBy)
+	assert.Equal(story.URL, feed.DuplicateOf)
+	assert.Equal("", story.DuplicateOf)
+	assert.Equal(story.URL, tag.DuplicateOf)
+	assert.Equal(story.URL, copied.DuplicateOf)
+}
+
+func TestNear(t *testing.T) {
+	assert := assert.New(t)
+
+	// Sites are registered in order on the same index of the fingerprints within 3 bits
+	index := dedup.NewIndex(dedup.WithNear(3))
+
+	tt := []struct {
+		name               string
+		index              *dedup.Index
+		node               *data.Response
+		expectedOriginal   string
+		expectedSimilarity float64
+		expectedNear       bool
+	}{
+		{
+			name:  "First site",
+			index: index,
+			node:  &data.Response{URL: "https://medium.com/story", Status: 200, SimHash: 0xf0f0},
+		},
+		{
+			name:               "Fingerprint a bit apart",
+			index:              index,
+			node:               &data.Response{URL: "https://medium.com/story?ts=1", Status: 200, SimHash: 0xf0f1},
+			expectedOriginal:   "https://medium.com/story",
+			expectedSimilarity: 1 - 1.0/64,
+			expectedNear:       true,
+		},
+		{
+			name:               "Near duplicates are not registered",
+			index:              index,
+			node:               &data.Response{URL: "https://medium.com/story?ts=2", Status: 200, SimHash: 0xf0f3},
+			expectedOriginal:   "https://medium.com/story",
+			expectedSimilarity: 1 - 2.0/64,
+			expectedNear:       true,
+		},
+		{
+			name:  "Fingerprint too far",
+			index: index,
+			node:  &data.Response{URL: "https://medium.com/about", Status: 200, SimHash: 0xf0ff},
+		},
+		{
+			name:  "Same site",
+			index: index,
+			node:  &data.Response{URL: "https://medium.com/about", Status: 200, SimHash: 0xf0ff},
+		},
+		{
+			name:  "Site without text",
+			index: index,
+			node:  &data.Response{URL: "https://medium.com/app", Status: 200},
+		},
+		{
+			name:  "Error pages are not compared",
+			index: index,
+			node:  &data.Response{URL: "https://medium.com/missing", Status: 404, SimHash: 0xf0f0},
+		},
+		{
+			name:               "Unchanged site compared",
+			index:              index,
+			node:               &data.Response{URL: "https://medium.com/cached", Status: 304, Unchanged: true, SimHash: 0xf0fe},
+			expectedOriginal:   "https://medium.com/about",
+			expectedSimilarity: 1 - 1.0/64,
+			expectedNear:       true,
+		},
+		{
+			name:  "Index without near duplicates",
+			index: dedup.NewIndex(),
+			node:  &data.Response{URL: "https://medium.com/story", Status: 200, SimHash: 0xf0f0},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			orig, similarity, near := tc.index.Near(tc.node)
+			assert.Equal(tc.expectedOriginal, orig, tc.name)
+			assert.Equal(tc.expectedSimilarity, similarity, tc.name)
+			assert.Equal(tc.expectedNear, near, tc.name)
+		})
+	}
+}
+
+func TestClusters(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name             string
+		tree             *data.Response
+		near             bool
+		expectedClusters []*data.DuplicateCluster
+	}{
+		{
+			name:             "No duplicates",
+			tree:             &data.Response{URL: "https://medium.com", Nodes: []*data.Response{{URL: "https://medium.com/story"}}},
+			expectedClusters: nil,
+		},
+		{
+			name: "Duplicates grouped by site expanded",
+			tree: &data.Response{URL: "https://medium.com", ContentHash: "h0", Nodes: []*data.Response{
+				{URL: "https://medium.com/story", Canonical: "https://medium.com/story", ContentHash: "h1", Nodes: []*data.Response{
+					{URL: "https://medium.com/?ref=story", DuplicateOf: "https://medium.com", DuplicateBy: data.DuplicateContent},
+				}},
+				{URL: "https://medium.com/story?source=card", DuplicateOf: "https://medium.com/story", DuplicateBy: data.DuplicateCanonical},
+				{URL: "https://medium.com/story/amp", DuplicateOf: "https://medium.com/story", DuplicateBy: data.DuplicateContent},
+			}},
+			expectedClusters: []*data.DuplicateCluster{
+				{URL: "https://medium.com", ContentHash: "h0", Duplicates: []data.Duplicate{
+					{URL: "https://medium.com/?ref=story", By: data.DuplicateContent},
+				}},
+				{URL: "https://medium.com/story", Canonical: "https://medium.com/story", ContentHash: "h1", Duplicates: []data.Duplicate{
+					{URL: "https://medium.com/story?source=card", By: data.DuplicateCanonical},
+					{URL: "https://medium.com/story/amp", By: data.DuplicateContent},
+				}},
+			},
+		},
+		{
+			name: "Near duplicates grouped by site nearly duplicated",
+			tree: &data.Response{URL: "https://medium.com", SimHash: 0xf0, Nodes: []*data.Response{
+				{URL: "https://medium.com/story", SimHash: 0xf0f0},
+				{URL: "https://medium.com/story?ts=1", SimHash: 0xf0f1, NearDuplicateOf: "https://medium.com/story", Similarity: 0.984375},
+				{URL: "https://medium.com/story/amp", DuplicateOf: "https://medium.com/story", DuplicateBy: data.DuplicateContent},
+				{URL: "https://medium.com/?ts=1", SimHash: 0xf1, NearDuplicateOf: "https://medium.com", Similarity: 0.984375},
+			}},
+			near: true,
+			expectedClusters: []*data.DuplicateCluster{
+				{URL: "https://medium.com", SimHash: 0xf0, Duplicates: []data.Duplicate{
+					{URL: "https://medium.com/?ts=1", By: data.DuplicateNear, Similarity: 0.984375},
+				}},
+				{URL: "https://medium.com/story", SimHash: 0xf0f0, Duplicates: []data.Duplicate{
+					{URL: "https://medium.com/story?ts=1", By: data.DuplicateNear, Similarity: 0.984375},
+				}},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.near {
+				assert.Equal(tc.expectedClusters, dedup.NearClusters(tc.tree), tc.name)
+				return
+			}
+			assert.Equal(tc.expectedClusters, dedup.Clusters(tc.tree), tc.name)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+)
+
+// dotEscaper escapes a quoted DOT string
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "")
+
+// writeDOT writes a directed GraphViz graph, sites are identified by their URL
+func writeDOT(w io.Writer, g *data.Graph) error {
+	b := bufio.NewWriter(w)
+	nodes, _ := sortedNodes(g)
+
+	fmt.Fprintln(b, "digraph crawl {")
+	for _, n := range nodes {
+		fmt.Fprintf(b, "  %s [label=%s", quote(n.url), quote(n.label()))
+		for _, a := range n.values()[1:] {
+			fmt.Fprintf(b, ", %s=%s", a.name, quote(a.value))
+		}
+		fmt.Fprintln(b, "];")
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(b, "  %s -> %s", quote(e.Source), quote(e.Target))
+		if values := edgeValues(e); len(values) > 0 {
+			attrs := make([]string, 0, len(values))
+			for _, a := range values {
+				name := a.name
+				// The anchor text is the label shown on the edge
+				if name == "text" {
+					name = "label"
+				}
+				attrs = append(attrs, name+"="+quote(a.value))
+			}
+			fmt.Fprintf(b, " [%s]", strings.Join(attrs, ", "))
+		}
+		fmt.Fprintln(b, ";")
+	}
+	fmt.Fprintln(b, "}")
+	return b.Flush()
+}
+
+// quote returns a DOT quoted string
+func quote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
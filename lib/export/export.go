@@ -0,0 +1,145 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+)
+
+// Export formats
+const (
+	// FormatDOT is the GraphViz language
+	FormatDOT = "dot"
+	// FormatGraphML is the XML format read by yEd and most graph libraries
+	FormatGraphML = "graphml"
+	// FormatGEXF is the XML format of Gephi
+	FormatGEXF = "gexf"
+)
+
+// contentTypes of the export formats
+var contentTypes = map[string]string{
+	FormatDOT:     "text/vnd.graphviz; charset=utf-8",
+	FormatGraphML: "application/graphml+xml; charset=utf-8",
+	FormatGEXF:    "application/gexf+xml; charset=utf-8",
+}
+
+// Supported reports whether a format can be exported
+func Supported(format string) bool {
+	_, ok := contentTypes[format]
+	return ok
+}
+
+// ContentType returns the media type of an export format
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// Write serializes the graph of a crawl in the given format, a tree is exported through its Graph
+func Write(w io.Writer, format string, g *data.Graph) error {
+	switch format {
+	case FormatDOT:
+		return writeDOT(w, g)
+	case FormatGraphML:
+		return writeGraphML(w, g)
+	case FormatGEXF:
+		return writeGEXF(w, g)
+	default:
+		return fmt.Errorf("unknown export format: %q", format)
+	}
+}
+
+// node is a site of the graph with the index used as its ID by the formats
+type node struct {
+	id  int
+	url string
+	*data.GraphNode
+}
+
+// attr is a node or edge attribute, its type is one of string, int or boolean
+type attr struct {
+	name  string
+	typ   string
+	value string
+}
+
+// Attributes exported for every node and edge, in order
+var (
+	nodeAttrs = []attr{
+		{name: "url", typ: "string"},
+		{name: "depth", typ: "int"},
+		{name: "title", typ: "string"},
+		{name: "status", typ: "int"},
+		{name: "error", typ: "string"},
+		{name: "external", typ: "boolean"},
+		{name: "skipped", typ: "string"},
+	}
+	edgeAttrs = []attr{
+		{name: "text", typ: "string"},
+		{name: "rel", typ: "string"},
+	}
+)
+
+// sortedNodes returns the sites of a graph by depth then URL so exports are reproducible
+func sortedNodes(g *data.Graph) ([]*node, map[string]int) {
+	nodes := make([]*node, 0, len(g.Nodes))
+	for u, n := range g.Nodes {
+		nodes = append(nodes, &node{url: u, GraphNode: n})
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Depth != nodes[j].Depth {
+			return nodes[i].Depth < nodes[j].Depth
+		}
+		return nodes[i].url < nodes[j].url
+	})
+	ids := make(map[string]int, len(nodes))
+	for i, n := range nodes {
+		n.id = i
+		ids[n.url] = i
+	}
+	return nodes, ids
+}
+
+// values returns the attributes set on a site, unset ones are left out
+func (n *node) values() []attr {
+	res := []attr{
+		{name: "url", typ: "string", value: n.url},
+		{name: "depth", typ: "int", value: strconv.Itoa(n.Depth)},
+		{name: "title", typ: "string", value: n.Title},
+	}
+	if n.Status > 0 {
+		res = append(res, attr{name: "status", typ: "int", value: strconv.Itoa(n.Status)})
+	}
+	if n.Error != "" {
+		res = append(res, attr{name: "error", typ: "string", value: n.Error})
+	}
+	if n.External {
+		res = append(res, attr{name: "external", typ: "boolean", value: "true"})
+	}
+	if n.Skipped != "" {
+		res = append(res, attr{name: "skipped", typ: "string", value: n.Skipped})
+	}
+	return res
+}
+
+// label returns the title of a site or its URL when it has none
+func (n *node) label() string {
+	if n.Title != "" {
+		return n.Title
+	}
+	return n.url
+}
+
+// edgeValues returns the attributes set on a link
+func edgeValues(e *data.Edge) []attr {
+	res := make([]attr, 0, 2)
+	if e.Text != "" {
+		res = append(res, attr{name: "text", typ: "string", value: e.Text})
+	}
+	if e.Rel != "" {
+		res = append(res, attr{name: "rel", typ: "string", value: e.Rel})
+	}
+	return res
+}
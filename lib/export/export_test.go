@@ -0,0 +1,101 @@
+package export_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/export"
+)
+
+var graph = &data.Graph{
+	Nodes: map[string]*data.GraphNode{
+		"https://www.successweb.com":        {Depth: 0, Title: `Success "Web"`, Status: 200},
+		"https://www.successweb.com/broken": {Depth: 1, Status: 404, Error: "Not Found"},
+		"https://www.otherweb.com":          {Depth: 1, External: true},
+	},
+	Edges: []*data.Edge{
+		{Source: "https://www.successweb.com", Target: "https://www.successweb.com/broken", Text: "Broken & gone"},
+		{Source: "https://www.successweb.com", Target: "https://www.otherweb.com", Rel: "nofollow"},
+		{Source: "https://www.successweb.com/broken", Target: "https://www.successweb.com"},
+	},
+}
+
+func TestWrite(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name          string
+		format        string
+		expectedLines []string
+		expectedError bool
+	}{
+		{
+			name:   "DOT",
+			format: export.FormatDOT,
+			expectedLines: []string{
+				`digraph crawl {`,
+				`  "https://www.successweb.com" [label="Success \"Web\"", depth="0", title="Success \"Web\"", status="200"];`,
+				`  "https://www.otherweb.com" [label="https://www.otherweb.com", depth="1", title="", external="true"];`,
+				`  "https://www.successweb.com/broken" [label="https://www.successweb.com/broken", depth="1", title="", status="404", error="Not Found"];`,
+				`  "https://www.successweb.com" -> "https://www.successweb.com/broken" [label="Broken & gone"];`,
+				`  "https://www.successweb.com" -> "https://www.otherweb.com" [rel="nofollow"];`,
+				`  "https://www.successweb.com/broken" -> "https://www.successweb.com";`,
+				`}`,
+			},
+		},
+		{
+			name:   "GraphML",
+			format: export.FormatGraphML,
+			expectedLines: []string{
+				`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`,
+				`  <key id="depth" for="node" attr.name="depth" attr.type="int"></key>`,
+				`  <key id="text" for="edge" attr.name="text" attr.type="string"></key>`,
+				`  <graph id="crawl" edgedefault="directed">`,
+				`    <node id="n0">`,
+				`      <data key="url">https://www.successweb.com</data>`,
+				`      <data key="title">Success &#34;Web&#34;</data>`,
+				`      <data key="status">404</data>`,
+				`    <edge id="e0" source="n0" target="n2">`,
+				`      <data key="text">Broken &amp; gone</data>`,
+				`    <edge id="e2" source="n2" target="n0"></edge>`,
+			},
+		},
+		{
+			name:   "GEXF",
+			format: export.FormatGEXF,
+			expectedLines: []string{
+				`<gexf xmlns="http://gexf.net/1.3" version="1.3">`,
+				`  <graph defaultedgetype="directed" mode="static">`,
+				`      <attribute id="depth" title="depth" type="integer"></attribute>`,
+				`      <node id="0" label="Success &#34;Web&#34;">`,
+				`          <attvalue for="status" value="200"></attvalue>`,
+				`      <node id="1" label="https://www.otherweb.com">`,
+				`          <attvalue for="external" value="true"></attvalue>`,
+				`      <edge id="0" source="0" target="2" label="Broken &amp; gone">`,
+				`      <edge id="2" source="2" target="0"></edge>`,
+			},
+		},
+		{
+			name:          "Unknown format",
+			format:        "svg",
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var b bytes.Buffer
+			err := export.Write(&b, tc.format, graph)
+
+			assert.Equal(tc.expectedError, err != nil, tc.name)
+			lines := strings.Split(b.String(), "\n")
+			for _, l := range tc.expectedLines {
+				assert.Contains(lines, l, tc.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package export
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+)
+
+// GEXF 1.3 document, see https://gexf.net/schema.html
+type gexf struct {
+	XMLName xml.Name  `xml:"gexf"`
+	XMLNS   string    `xml:"xmlns,attr"`
+	Version string    `xml:"version,attr"`
+	Graph   gexfGraph `xml:"graph"`
+}
+
+type gexfGraph struct {
+	DefaultEdgeType string           `xml:"defaultedgetype,attr"`
+	Mode            string           `xml:"mode,attr"`
+	Attributes      []gexfAttributes `xml:"attributes"`
+	Nodes           []gexfNode       `xml:"nodes>node"`
+	Edges           []gexfEdge       `xml:"edges>edge"`
+}
+
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfNode struct {
+	ID        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr"`
+	AttValues *gexfAttValues `xml:"attvalues"`
+}
+
+type gexfEdge struct {
+	ID        string         `xml:"id,attr"`
+	Source    string         `xml:"source,attr"`
+	Target    string         `xml:"target,attr"`
+	Label     string         `xml:"label,attr,omitempty"`
+	AttValues *gexfAttValues `xml:"attvalues,omitempty"`
+}
+
+type gexfAttValues struct {
+	Values []gexfAttValue `xml:"attvalue"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// gexfTypes maps the attribute types to the GEXF ones
+var gexfTypes = map[string]string{
+	"string":  "string",
+	"int":     "integer",
+	"boolean": "boolean",
+}
+
+// writeGEXF writes a directed static GEXF graph, attributes are declared with their name as ID
+func writeGEXF(w io.Writer, g *data.Graph) error {
+	nodes, ids := sortedNodes(g)
+
+	doc := gexf{
+		XMLNS:   "http://gexf.net/1.3",
+		Version: "1.3",
+		Graph:   gexfGraph{DefaultEdgeType: "directed", Mode: "static"},
+	}
+	nodeClass := gexfAttributes{Class: "node"}
+	for _, a := range nodeAttrs {
+		nodeClass.Attributes = append(nodeClass.Attributes, gexfAttribute{ID: a.name, Title: a.name, Type: gexfTypes[a.typ]})
+	}
+	edgeClass := gexfAttributes{Class: "edge"}
+	for _, a := range edgeAttrs {
+		edgeClass.Attributes = append(edgeClass.Attributes, gexfAttribute{ID: a.name, Title: a.name, Type: gexfTypes[a.typ]})
+	}
+	doc.Graph.Attributes = []gexfAttributes{nodeClass, edgeClass}
+
+	for _, n := range nodes {
+		gn := gexfNode{ID: strconv.Itoa(n.id), Label: n.label(), AttValues: attValues(n.values())}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, gn)
+	}
+	for i, e := range g.Edges {
+		ge := gexfEdge{
+			ID:     strconv.Itoa(i),
+			Source: strconv.Itoa(ids[e.Source]),
+			Target: strconv.Itoa(ids[e.Target]),
+			Label:  e.Text,
+		}
+		if values := edgeValues(e); len(values) > 0 {
+			ge.AttValues = attValues(values)
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, ge)
+	}
+
+	return writeXML(w, doc)
+}
+
+// attValues returns the GEXF values of attributes
+func attValues(attrs []attr) *gexfAttValues {
+	res := &gexfAttValues{}
+	for _, a := range attrs {
+		res.Values = append(res.Values, gexfAttValue{For: a.name, Value: a.value})
+	}
+	return res
+}
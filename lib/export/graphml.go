@@ -0,0 +1,99 @@
+package export
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+)
+
+// GraphML document, see http://graphml.graphdrawing.org/specification.html
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// writeGraphML writes a directed GraphML graph, attributes are declared as keys named after them
+func writeGraphML(w io.Writer, g *data.Graph) error {
+	nodes, ids := sortedNodes(g)
+
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Graph: graphMLGraph{ID: "crawl", EdgeDefault: "directed"},
+	}
+	for _, a := range nodeAttrs {
+		doc.Keys = append(doc.Keys, graphMLKey{ID: a.name, For: "node", Name: a.name, Type: a.typ})
+	}
+	for _, a := range edgeAttrs {
+		doc.Keys = append(doc.Keys, graphMLKey{ID: a.name, For: "edge", Name: a.name, Type: a.typ})
+	}
+
+	for _, n := range nodes {
+		gn := graphMLNode{ID: "n" + strconv.Itoa(n.id)}
+		for _, a := range n.values() {
+			gn.Data = append(gn.Data, graphMLData{Key: a.name, Value: a.value})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, gn)
+	}
+	for i, e := range g.Edges {
+		ge := graphMLEdge{
+			ID:     "e" + strconv.Itoa(i),
+			Source: "n" + strconv.Itoa(ids[e.Source]),
+			Target: "n" + strconv.Itoa(ids[e.Target]),
+		}
+		for _, a := range edgeValues(e) {
+			ge.Data = append(ge.Data, graphMLData{Key: a.name, Value: a.value})
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, ge)
+	}
+
+	return writeXML(w, doc)
+}
+
+// writeXML writes an indented XML document with its header
+func writeXML(w io.Writer, doc interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
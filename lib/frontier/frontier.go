@@ -0,0 +1,215 @@
+package frontier
+
+import (
+	"container/heap"
+	"fmt"
+	"math/rand"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+)
+
+// Crawl strategies, the order sites are fetched in
+const (
+	// StrategyBFS fetches sites in the order they were found, level by level
+	StrategyBFS = "bfs"
+	// StrategyDFS fetches the last site found first, following a branch down before the next one
+	StrategyDFS = "dfs"
+	// StrategyBest fetches the site with the highest score first
+	StrategyBest = "best"
+)
+
+// Frontier holds the sites waiting to be fetched, it is not safe for concurrent use
+type Frontier interface {
+	Push(node *data.Response)
+	// Pop returns the next site to fetch, nil when empty
+	Pop() *data.Response
+	Len() int
+}
+
+// Rescorer is a frontier scoring its sites again when their score may have changed, such as when a scorer
+// learning from the links of the fetched pages counted new links to them
+type Rescorer interface {
+	Rescore(url string)
+}
+
+// Supported reports whether a strategy is known, empty means breadth first
+func Supported(strategy string) bool {
+	switch strategy {
+	case "", StrategyBFS, StrategyDFS, StrategyBest:
+		return true
+	}
+	return false
+}
+
+// New returns an empty frontier for a strategy. Best first ranks sites with the scorer, fewer path segments
+// first when not set, and breaks ties in the order they were found or at random when the seed is not zero
+func New(strategy string, s data.Scorer, seed int64) (Frontier, error) {
+	switch strategy {
+	case "", StrategyBFS:
+		return NewFIFO(), nil
+	case StrategyDFS:
+		return NewLIFO(), nil
+	case StrategyBest:
+		if s == nil {
+			s = Segments{}
+		}
+		return NewPriority(s, seed), nil
+	default:
+		return nil, fmt.Errorf("unknown strategy: %q", strategy)
+	}
+}
+
+// FIFO is a first in first out frontier, a breadth first crawl
+type FIFO struct {
+	nodes []*data.Response
+}
+
+// NewFIFO returns a pointer to a new empty FIFO frontier
+func NewFIFO() *FIFO {
+	return &FIFO{}
+}
+
+// Push adds a site at the back
+func (f *FIFO) Push(node *data.Response) {
+	f.nodes = append(f.nodes, node)
+}
+
+// Pop removes the site at the front
+func (f *FIFO) Pop() *data.Response {
+	if len(f.nodes) == 0 {
+		return nil
+	}
+	node := f.nodes[0]
+	f.nodes[0] = nil
+	f.nodes = f.nodes[1:]
+	return node
+}
+
+// Len returns the number of sites waiting
+func (f *FIFO) Len() int {
+	return len(f.nodes)
+}
+
+// LIFO is a last in first out frontier, a depth first crawl
+type LIFO struct {
+	nodes []*data.Response
+}
+
+// NewLIFO returns a pointer to a new empty LIFO frontier
+func NewLIFO() *LIFO {
+	return &LIFO{}
+}
+
+// Push adds a site on top
+func (l *LIFO) Push(node *data.Response) {
+	l.nodes = append(l.nodes, node)
+}
+
+// Pop removes the site on top
+func (l *LIFO) Pop() *data.Response {
+	if len(l.nodes) == 0 {
+		return nil
+	}
+	node := l.nodes[len(l.nodes)-1]
+	l.nodes[len(l.nodes)-1] = nil
+	l.nodes = l.nodes[:len(l.nodes)-1]
+	return node
+}
+
+// Len returns the number of sites waiting
+func (l *LIFO) Len() int {
+	return len(l.nodes)
+}
+
+// item is a site of a priority frontier with its rank and its position in the heap
+type item struct {
+	node  *data.Response
+	score float64
+	tie   int64
+	index int
+}
+
+// items is a max heap on the score, the lowest tie first
+type items []*item
+
+func (h items) Len() int { return len(h) }
+func (h items) Less(i, j int) bool {
+	if h[i].score != h[j].score {
+		return h[i].score > h[j].score
+	}
+	return h[i].tie < h[j].tie
+}
+func (h items) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+func (h *items) Push(x interface{}) {
+	it := x.(*item)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+func (h *items) Pop() interface{} {
+	old := *h
+	it := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return it
+}
+
+// Priority is a best first frontier, sites are scored when pushed and again when rescored
+type Priority struct {
+	scorer data.Scorer
+	rnd    *rand.Rand
+	seq    int64
+	items  items
+	queued map[string]*item
+}
+
+// NewPriority returns a pointer to a new empty priority frontier, ties are broken at random when the seed
+// is not zero
+func NewPriority(s data.Scorer, seed int64) *Priority {
+	p := &Priority{scorer: s, queued: make(map[string]*item)}
+	if seed != 0 {
+		p.rnd = rand.New(rand.NewSource(seed))
+	}
+	return p
+}
+
+// Push scores a site and adds it
+func (p *Priority) Push(node *data.Response) {
+	p.seq++
+	tie := p.seq
+	if p.rnd != nil {
+		tie = p.rnd.Int63()
+	}
+	it := &item{node: node, score: p.scorer.Score(node), tie: tie}
+	heap.Push(&p.items, it)
+	p.queued[node.URL] = it
+}
+
+// Pop removes the site with the highest score
+func (p *Priority) Pop() *data.Response {
+	if len(p.items) == 0 {
+		return nil
+	}
+	it := heap.Pop(&p.items).(*item)
+	delete(p.queued, it.node.URL)
+	return it.node
+}
+
+// Rescore scores a queued site again and moves it to its new rank, sites not queued are ignored
+func (p *Priority) Rescore(url string) {
+	it, ok := p.queued[url]
+	if !ok {
+		return
+	}
+	if score := p.scorer.Score(it.node); score != it.score {
+		it.score = score
+		heap.Fix(&p.items, it.index)
+	}
+}
+
+// Len returns the number of sites waiting
+func (p *Priority) Len() int {
+	return len(p.items)
+}
@@ -0,0 +1,199 @@
+package frontier_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/frontier"
+)
+
+var urls = []string{
+	"https://www.successweb.com/blog/2026/go",
+	"https://www.successweb.com/about",
+	"https://www.successweb.com/blog",
+	"https://www.successweb.com/blog/go",
+}
+
+// drain pushes the URLs in order and pops them all
+func drain(f frontier.Frontier, urls []string) []string {
+	for _, u := range urls {
+		f.Push(&data.Response{URL: u})
+	}
+	popped := make([]string, 0)
+	for f.Len() > 0 {
+		popped = append(popped, f.Pop().URL)
+	}
+	return popped
+}
+
+func TestFrontier(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name          string
+		strategy      string
+		scorer        data.Scorer
+		expectedOrder []string
+		expectedError bool
+	}{
+		{
+			name:          "Breadth first by default",
+			expectedOrder: urls,
+		},
+		{
+			name:          "Depth first",
+			strategy:      frontier.StrategyDFS,
+			expectedOrder: []string{urls[3], urls[2], urls[1], urls[0]},
+		},
+		{
+			name:          "Best first by path segments by default",
+			strategy:      frontier.StrategyBest,
+			expectedOrder: []string{urls[1], urls[2], urls[3], urls[0]},
+		},
+		{
+			name:          "Best first by keywords",
+			strategy:      frontier.StrategyBest,
+			scorer:        frontier.NewKeywords([]string{"Blog", " go "}),
+			expectedOrder: []string{urls[0], urls[3], urls[2], urls[1]},
+		},
+		{
+			name:          "Unknown strategy",
+			strategy:      "random",
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := frontier.New(tc.strategy, tc.scorer, 0)
+			if tc.expectedError {
+				assert.Error(err, tc.name)
+				return
+			}
+			assert.NoError(err, tc.name)
+			assert.Equal(tc.expectedOrder, drain(f, urls), tc.name)
+			assert.Nil(f.Pop(), tc.name)
+		})
+	}
+}
+
+func TestPrioritySeed(t *testing.T) {
+	assert := assert.New(t)
+
+	// Every URL has the same score, ties are broken in the order found without a seed and the same way for a seed
+	ties := []string{"https://a.com/1", "https://a.com/2", "https://a.com/3", "https://a.com/4", "https://a.com/5", "https://a.com/6"}
+	assert.Equal(ties, drain(frontier.NewPriority(frontier.Segments{}, 0), ties))
+	seeded := drain(frontier.NewPriority(frontier.Segments{}, 7), ties)
+	assert.ElementsMatch(ties, seeded)
+	assert.NotEqual(ties, seeded)
+	assert.Equal(seeded, drain(frontier.NewPriority(frontier.Segments{}, 7), ties))
+}
+
+func TestPriorityRescore(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name          string
+		links         []data.Link
+		rescore       []string
+		expectedOrder []string
+	}{
+		{
+			name:          "In the order found without in-links",
+			expectedOrder: urls,
+		},
+		{
+			name:          "In-links counted after being queued",
+			links:         []data.Link{{URL: urls[2]}, {URL: urls[3]}},
+			rescore:       []string{urls[2], urls[3]},
+			expectedOrder: []string{urls[2], urls[3], urls[0], urls[1]},
+		},
+		{
+			name:          "Not rescored",
+			links:         []data.Link{{URL: urls[2]}},
+			expectedOrder: urls,
+		},
+		{
+			name:          "Sites not queued ignored",
+			links:         []data.Link{{URL: urls[3]}, {URL: "https://www.successweb.com/news"}},
+			rescore:       []string{urls[3], "https://www.successweb.com/news"},
+			expectedOrder: []string{urls[3], urls[0], urls[1], urls[2]},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			scorer := frontier.NewInLinks()
+			p := frontier.NewPriority(scorer, 0)
+			for _, u := range urls {
+				p.Push(&data.Response{URL: u})
+			}
+			scorer.Count(tc.links)
+			for _, u := range tc.rescore {
+				p.Rescore(u)
+			}
+			assert.Equal(tc.expectedOrder, drain(p, nil), tc.name)
+		})
+	}
+}
+
+func TestScorer(t *testing.T) {
+	assert := assert.New(t)
+
+	node := &data.Response{URL: "https://www.successweb.com/blog/go"}
+	tt := []struct {
+		name          string
+		scorer        string
+		keywords      []string
+		links         []data.Link
+		expectedScore float64
+		expectedError bool
+	}{
+		{
+			name:          "Segments by default",
+			expectedScore: -2,
+		},
+		{
+			name:          "Keywords inferred",
+			keywords:      []string{"blog", "news"},
+			expectedScore: 1,
+		},
+		{
+			name:          "Keywords missing",
+			scorer:        frontier.ScorerKeywords,
+			expectedError: true,
+		},
+		{
+			name:   "In-links counted once per page",
+			scorer: frontier.ScorerInLinks,
+			links: []data.Link{
+				{URL: "https://www.successweb.com/blog/go"},
+				{URL: "https://www.successweb.com/blog/go", Text: "Again"},
+				{URL: "https://www.successweb.com/about"},
+			},
+			expectedScore: 1,
+		},
+		{
+			name:          "Unknown scorer",
+			scorer:        "pagerank",
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := frontier.NewScorer(tc.scorer, tc.keywords)
+			if tc.expectedError {
+				assert.Error(err, tc.name)
+				return
+			}
+			assert.NoError(err, tc.name)
+			if c, ok := s.(frontier.Counter); ok {
+				c.Count(tc.links)
+			}
+			assert.Equal(tc.expectedScore, s.Score(node), tc.name)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package frontier
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+)
+
+// Scorers of a best first crawl
+const (
+	// ScorerSegments ranks URLs with fewer path segments first
+	ScorerSegments = "segments"
+	// ScorerKeywords ranks URLs matching more keywords first
+	ScorerKeywords = "keywords"
+	// ScorerInLinks ranks URLs linked from more fetched pages first
+	ScorerInLinks = "inlinks"
+)
+
+// Counter is a scorer that learns from the links of the fetched pages, the crawler hands them over before
+// their children are queued
+type Counter interface {
+	Count(links []data.Link)
+}
+
+// NewScorer returns a scorer by name, keywords when empty and keywords are set or segments otherwise. A
+// scorer keeps state, every crawl needs its own
+func NewScorer(name string, keywords []string) (data.Scorer, error) {
+	if name == "" && len(keywords) > 0 {
+		name = ScorerKeywords
+	}
+	switch name {
+	case "", ScorerSegments:
+		return Segments{}, nil
+	case ScorerKeywords:
+		if len(keywords) == 0 {
+			return nil, fmt.Errorf("scorer %q needs keywords", name)
+		}
+		return NewKeywords(keywords), nil
+	case ScorerInLinks:
+		return NewInLinks(), nil
+	default:
+		return nil, fmt.Errorf("unknown scorer: %q", name)
+	}
+}
+
+// Segments ranks URLs by the number of segments of their path, the fewer the better
+type Segments struct{}
+
+// Score returns minus the number of path segments
+func (Segments) Score(node *data.Response) float64 {
+	u, err := url.Parse(node.URL)
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, s := range strings.Split(u.Path, "/") {
+		if s != "" {
+			n++
+		}
+	}
+	return -float64(n)
+}
+
+// Keywords ranks URLs by the number of keywords they contain, case insensitive
+type Keywords struct {
+	words []string
+}
+
+// NewKeywords returns a pointer to a new keyword scorer
+func NewKeywords(words []string) *Keywords {
+	k := &Keywords{}
+	for _, w := range words {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			k.words = append(k.words, w)
+		}
+	}
+	return k
+}
+
+// Score returns the number of keywords found in the URL
+func (k *Keywords) Score(node *data.Response) float64 {
+	u := strings.ToLower(node.URL)
+	n := 0
+	for _, w := range k.words {
+		if strings.Contains(u, w) {
+			n++
+		}
+	}
+	return float64(n)
+}
+
+// InLinks ranks URLs by the number of links to them found so far, it is safe for concurrent use
+type InLinks struct {
+	sync.Mutex
+	counts map[string]int
+}
+
+// NewInLinks returns a pointer to a new in-link scorer
+func NewInLinks() *InLinks {
+	return &InLinks{counts: make(map[string]int)}
+}
+
+// Count adds the links of a fetched page, a page linking twice to a URL counts once
+func (l *InLinks) Count(links []data.Link) {
+	l.Lock()
+	defer l.Unlock()
+	seen := make(map[string]bool, len(links))
+	for _, link := range links {
+		if !seen[link.URL] {
+			seen[link.URL] = true
+			l.counts[link.URL]++
+		}
+	}
+}
+
+// Score returns the number of pages linking to the URL
+func (l *InLinks) Score(node *data.Response) float64 {
+	l.Lock()
+	defer l.Unlock()
+	return float64(l.counts[node.URL])
+}
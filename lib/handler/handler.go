@@ -1,55 +1,125 @@
 package handler
 
 import (
-	"encoding/json"
+	"context"
+	"fmt"
 	"net/http"
 	"net/url"
-	"strconv"
 
 	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/output"
 )
 
 // Crawlerer interface for Crawl function, returns a crawl result from supplied URL
 type Crawlerer interface {
-	Crawl(seedURL *url.URL, maxDepth int) *data.Response
+	Crawl(ctx context.Context, seedURL *url.URL, maxDepth int, opts data.Options) *data.Response
 }
 
 // Handler exported type for HandleCrawl function
 type Handler struct {
-	Crawler Crawlerer
+	Crawler  Crawlerer
+	Jobs     Jobber
+	Defaults Defaults
 }
 
-func NewHandler(c Crawlerer) *Handler {
-	return &Handler{Crawler: c}
+// Defaults are the crawl parameters used when a request does not set them and the largest concurrency it can set
+type Defaults struct {
+	Depth          int
+	MaxConcurrency int
+	Sitemaps       bool
+	Scope          string
+	PathPrefix     string
+	Include        []string
+	Exclude        []string
+	Scorer         string
+	Keywords       []string
+	Seed           int64
+	Mode           string
+	Format         string
+	Shape          string
 }
 
-// HandleCrawl handles the crawl api request
+// Option sets a dependency of the handler
+type Option func(*Handler)
+
+// WithJobs sets the manager running the asynchronous crawls
+func WithJobs(j Jobber) Option {
+	return func(h *Handler) {
+		h.Jobs = j
+	}
+}
+
+// WithDefaults sets the crawl parameters used when a request does not set them
+func WithDefaults(d Defaults) Option {
+	return func(h *Handler) {
+		h.Defaults = d
+	}
+}
+
+func NewHandler(c Crawlerer, opts ...Option) *Handler {
+	h := &Handler{Crawler: c, Defaults: Defaults{Depth: defaultDepth, MaxConcurrency: defaultMaxConcurrency}}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// HandleCrawl handles the crawl api request, the tree, or the graph with shape=graph, is returned once the crawl
+// is finished unless the sites are streamed as they are crawled with format=ndjson, format=sse or
+// Accept: text/event-stream. The graph is exported with format=dot, format=graphml or format=gexf and the
+// sitemap of the site is built with format=sitemap
 func (h *Handler) HandleCrawl(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get URL parameter and validate/sanitise
-	urlParam := r.URL.Query().Get("url")
-	u, err := url.ParseRequestURI(urlParam)
+	// Get parameters and validate/sanitise
+	u, maxDepth, opts, err := ParseCrawl(r.URL.Query(), h.Defaults)
+	if err != nil {
+		println(err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	format, err := responseFormat(r, h.Defaults.Format)
+	if err != nil {
+		println(err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	shape, err := parseShape(r.URL.Query(), h.Defaults.Shape)
+	if err == nil && shape == output.ShapeGraph && output.Streamed(format) {
+		err = fmt.Errorf("shape %s cannot be streamed", shape)
+	}
 	if err != nil {
 		println(err.Error())
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	// Default param value
-	maxDepth := 2
-	maxDepthParam := r.URL.Query().Get("depth")
-	if maxDepthParam != "" {
-		maxDepth, err = strconv.Atoi(maxDepthParam)
-		if err != nil {
-			println(err.Error())
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+	if !output.Streamed(format) {
+		//Start crawling process, it stops when the client goes away
+		res := h.Crawler.Crawl(r.Context(), u, maxDepth, opts)
+		writeResult(w, res, shape, format)
+		return
 	}
 
-	//Start crawling process
-	res := h.Crawler.Crawl(u, maxDepth)
+	s := newStream(w, format)
+	opts.Observer = s
+	res := h.Crawler.Crawl(r.Context(), u, maxDepth, opts)
+	s.Finish(res)
+}
 
-	json.NewEncoder(w).Encode(res)
+// writeResult encodes a crawl result in the requested shape and format
+func writeResult(w http.ResponseWriter, res *data.Response, shape, format string) {
+	o, err := output.New(res, format, shape)
+	if err != nil {
+		println(err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", o.ContentType)
+	if o.Filename != "" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", o.Filename))
+	}
+	if err := o.Write(w); err != nil {
+		println(err.Error())
+	}
 }
@@ -1,24 +1,35 @@
 package handler_test
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"goji.io"
+	"goji.io/pat"
 
 	"github.com/smashed-avo/go-crawler/lib/data"
 	"github.com/smashed-avo/go-crawler/lib/handler"
+	"github.com/smashed-avo/go-crawler/lib/jobs"
 )
 
 const (
 	_ mockStateCrawler = iota
 	emptyResponse
 	successResponse
+	truncatedResponse
+	streamedResponse
+	paramsResponse
+	linkcheckResponse
 )
 
 type mockStateCrawler int
@@ -27,12 +38,32 @@ type MockCrawler struct {
 	State mockStateCrawler
 }
 
-func (c *MockCrawler) Crawl(seedURL *url.URL, maxDepth int) *data.Response {
+func (c *MockCrawler) Crawl(ctx context.Context, seedURL *url.URL, maxDepth int, opts data.Options) *data.Response {
 	switch c.State {
 	case emptyResponse:
 		return &data.Response{}
 	case successResponse:
 		return &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: make([]*data.Response, 0)}
+	case truncatedResponse:
+		return &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: make([]*data.Response, 0), Truncated: opts.Timeout == 30*time.Second}
+	case streamedResponse:
+		opts.Observer.Observe(data.Event{URL: "https://www.successweb.com", Depth: 0, Title: "Success Web", Status: 200})
+		opts.Observer.Observe(data.Event{URL: "https://www.successweb.com/broken", Parent: "https://www.successweb.com", Depth: 1, Status: 404, Error: "Not Found"})
+		return &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: make([]*data.Response, 0), Limits: []string{data.LimitMaxPages}}
+	case paramsResponse:
+		title := fmt.Sprintf("depth=%d sitemaps=%t scoped=%t strategy=%s scorer=%T seed=%d", maxDepth, opts.Sitemaps, opts.Scope != nil, opts.Strategy, opts.Scorer, opts.Seed)
+		return &data.Response{Depth: 0, Title: title, URL: seedURL.String(), Nodes: make([]*data.Response, 0)}
+	case linkcheckResponse:
+		// The report names the settings of the crawl
+		title := fmt.Sprintf("mode=%s depth=%d scoped=%t", opts.Mode, maxDepth, opts.Scope != nil)
+		res := &data.Response{Depth: 0, Title: title, URL: seedURL.String(), Nodes: make([]*data.Response, 0)}
+		if opts.Mode == data.ModeLinkCheck {
+			res.LinkCheck = &data.LinkReport{Checked: 2, Broken: []*data.BrokenLink{{
+				URL: "https://www.successweb.com/gone", Status: 404, Type: "4xx",
+				Sources: []data.LinkSource{{URL: seedURL.String(), Text: title, Element: "a", Attr: "href"}},
+			}}}
+		}
+		return res
 	default:
 		panic(fmt.Sprintf("Invalid mockStateCrawler: %v", c.State))
 	}
@@ -70,6 +101,55 @@ func TestHandleCrawl(t *testing.T) {
 			expectedStatusCode: 200,
 			expectedBody:       `{"depth":0,"title":"Success Web","url":"https://www.successweb.com","nodes":[]}`,
 		},
+		{
+			name:               "Success: passing concurrency",
+			state:              successResponse,
+			url:                "/crawl?url=https://successweb.com&concurrency=4",
+			expectedStatusCode: 200,
+			expectedBody:       `{"depth":0,"title":"Success Web","url":"https://www.successweb.com","nodes":[]}`,
+		},
+		{
+			name:               "Success: passing timeout duration",
+			state:              truncatedResponse,
+			url:                "/crawl?url=https://successweb.com&timeout=30s",
+			expectedStatusCode: 200,
+			expectedBody:       `{"depth":0,"title":"Success Web","url":"https://www.successweb.com","nodes":[],"truncated":true}`,
+		},
+		{
+			name:               "Success: passing timeout seconds",
+			state:              truncatedResponse,
+			url:                "/crawl?url=https://successweb.com&timeout=30",
+			expectedStatusCode: 200,
+			expectedBody:       `{"depth":0,"title":"Success Web","url":"https://www.successweb.com","nodes":[],"truncated":true}`,
+		},
+		{
+			name:               "Success: passing host politeness limits",
+			state:              successResponse,
+			url:                "/crawl?url=https://successweb.com&host_concurrency=2&host_delay=500ms&host_rps=1.5",
+			expectedStatusCode: 200,
+			expectedBody:       `{"depth":0,"title":"Success Web","url":"https://www.successweb.com","nodes":[]}`,
+		},
+		{
+			name:               "Success: passing scope rules",
+			state:              successResponse,
+			url:                "/crawl?url=https://successweb.com/blog/&scope=domain&include=/blog/&include=/docs/&exclude=%5C%3Fsource%3D",
+			expectedStatusCode: 200,
+			expectedBody:       `{"depth":0,"title":"Success Web","url":"https://www.successweb.com","nodes":[]}`,
+		},
+		{
+			name:               "Success: passing path prefix",
+			state:              successResponse,
+			url:                "/crawl?url=https://successweb.com/&path_prefix=/blog/",
+			expectedStatusCode: 200,
+			expectedBody:       `{"depth":0,"title":"Success Web","url":"https://www.successweb.com","nodes":[]}`,
+		},
+		{
+			name:               "Success: passing size limits",
+			state:              successResponse,
+			url:                "/crawl?url=https://successweb.com/&max_pages=100&max_links_per_page=20&max_pages_per_host=10",
+			expectedStatusCode: 200,
+			expectedBody:       `{"depth":0,"title":"Success Web","url":"https://www.successweb.com","nodes":[]}`,
+		},
 		{
 			name:               "Bad Request: empty URL",
 			state:              emptyResponse,
@@ -91,6 +171,188 @@ func TestHandleCrawl(t *testing.T) {
 			expectedStatusCode: 400,
 			expectedBody:       ``,
 		},
+		{
+			name:               "Bad Request: concurrency not int",
+			state:              emptyResponse,
+			url:                "/crawl?url=https://www.successweb.com&concurrency=aaaa",
+			expectedStatusCode: 400,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Bad Request: concurrency not positive",
+			state:              emptyResponse,
+			url:                "/crawl?url=https://www.successweb.com&concurrency=0",
+			expectedStatusCode: 400,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Bad Request: concurrency above the maximum",
+			state:              emptyResponse,
+			url:                "/crawl?url=https://www.successweb.com&concurrency=1000000",
+			expectedStatusCode: 400,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Bad Request: timeout not a duration",
+			state:              emptyResponse,
+			url:                "/crawl?url=https://www.successweb.com&timeout=soon",
+			expectedStatusCode: 400,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Bad Request: timeout not positive",
+			state:              emptyResponse,
+			url:                "/crawl?url=https://www.successweb.com&timeout=-1s",
+			expectedStatusCode: 400,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Bad Request: host concurrency not positive",
+			state:              emptyResponse,
+			url:                "/crawl?url=https://www.successweb.com&host_concurrency=-2",
+			expectedStatusCode: 400,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Bad Request: host delay not a duration",
+			state:              emptyResponse,
+			url:                "/crawl?url=https://www.successweb.com&host_delay=later",
+			expectedStatusCode: 400,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Bad Request: host rps not a number",
+			state:              emptyResponse,
+			url:                "/crawl?url=https://www.successweb.com&host_rps=fast",
+			expectedStatusCode: 400,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Bad Request: unknown strategy",
+			state:              emptyResponse,
+			url:                "/crawl?url=https://www.successweb.com&strategy=random",
+			expectedStatusCode: 400,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Bad Request: unknown scorer",
+			state:              emptyResponse,
+			url:                "/crawl?url=https://www.successweb.com&strategy=best&scorer=pagerank",
+			expectedStatusCode: 400,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Bad Request: seed not int",
+			state:              emptyResponse,
+			url:                "/crawl?url=https://www.successweb.com&seed=lucky",
+			expectedStatusCode: 400,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Bad Request: unknown scope",
+			state:              emptyResponse,
+			url:                "/crawl?url=https://www.successweb.com&scope=planet",
+			expectedStatusCode: 400,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Bad Request: include not a regular expression",
+			state:              emptyResponse,
+			url:                "/crawl?url=https://www.successweb.com&include=(",
+			expectedStatusCode: 400,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Success: graph shape",
+			state:              successResponse,
+			url:                "/crawl?url=https://www.successweb.com&shape=graph",
+			expectedStatusCode: 200,
+			expectedBody:       `{"nodes":{"https://www.successweb.com":{"depth":0,"title":"Success Web"}},"edges":[]}`,
+		},
+		{
+			name:               "Success: tree shape",
+			state:              successResponse,
+			url:                "/crawl?url=https://www.successweb.com&shape=tree",
+			expectedStatusCode: 200,
+			expectedBody:       `{"depth":0,"title":"Success Web","url":"https://www.successweb.com","nodes":[]}`,
+		},
+		{
+			name:               "Success: linkcheck report",
+			state:              linkcheckResponse,
+			url:                "/crawl?url=https://www.successweb.com&mode=linkcheck",
+			expectedStatusCode: 200,
+			expectedBody:       `{"checked":2,"broken":[{"url":"https://www.successweb.com/gone","status":404,"type":"4xx","sources":[{"url":"https://www.successweb.com","text":"mode=linkcheck depth=2147483647 scoped=true","element":"a","attr":"href"}]}]}`,
+		},
+		{
+			name:               "Success: linkcheck with depth",
+			state:              linkcheckResponse,
+			url:                "/crawl?url=https://www.successweb.com&mode=linkcheck&depth=3&shape=graph",
+			expectedStatusCode: 200,
+			expectedBody:       `{"nodes":{"https://www.successweb.com":{"depth":0,"title":"mode=linkcheck depth=3 scoped=true"}},"edges":[]}`,
+		},
+		{
+			name:               "Success: linkcheck of every site keeps the default depth",
+			state:              linkcheckResponse,
+			url:                "/crawl?url=https://www.successweb.com&mode=linkcheck&scope=all&shape=graph",
+			expectedStatusCode: 200,
+			expectedBody:       `{"nodes":{"https://www.successweb.com":{"depth":0,"title":"mode=linkcheck depth=2 scoped=true"}},"edges":[]}`,
+		},
+		{
+			name:               "Success: crawl mode",
+			state:              linkcheckResponse,
+			url:                "/crawl?url=https://www.successweb.com&mode=crawl",
+			expectedStatusCode: 200,
+			expectedBody:       `{"depth":0,"title":"mode=crawl depth=2 scoped=false","url":"https://www.successweb.com","nodes":[]}`,
+		},
+		{
+			name:               "Bad Request: unknown mode",
+			state:              emptyResponse,
+			url:                "/crawl?url=https://www.successweb.com&mode=audit",
+			expectedStatusCode: 400,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Bad Request: unknown shape",
+			state:              emptyResponse,
+			url:                "/crawl?url=https://www.successweb.com&shape=list",
+			expectedStatusCode: 400,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Bad Request: graph shape streamed",
+			state:              emptyResponse,
+			url:                "/crawl?url=https://www.successweb.com&shape=graph&format=ndjson",
+			expectedStatusCode: 400,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Success: passing sitemaps",
+			state:              successResponse,
+			url:                "/crawl?url=https://www.successweb.com&sitemaps=true",
+			expectedStatusCode: 200,
+			expectedBody:       `{"depth":0,"title":"Success Web","url":"https://www.successweb.com","nodes":[]}`,
+		},
+		{
+			name:               "Bad Request: sitemaps not a boolean",
+			state:              emptyResponse,
+			url:                "/crawl?url=https://www.successweb.com&sitemaps=maybe",
+			expectedStatusCode: 400,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Bad Request: unknown format",
+			state:              emptyResponse,
+			url:                "/crawl?url=https://www.successweb.com&format=xml",
+			expectedStatusCode: 400,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Bad Request: max pages not int",
+			state:              emptyResponse,
+			url:                "/crawl?url=https://www.successweb.com&max_pages=lots",
+			expectedStatusCode: 400,
+			expectedBody:       ``,
+		},
 	}
 
 	for _, tc := range tt {
@@ -115,3 +377,426 @@ func TestHandleCrawl(t *testing.T) {
 		})
 	}
 }
+
+const (
+	_ mockStateJobs = iota
+	jobQueued
+	jobRunning
+	jobDone
+	jobNotFound
+	queueFull
+	jobInterrupted
+)
+
+type mockStateJobs int
+
+type MockJobs struct {
+	State mockStateJobs
+}
+
+var queuedStatus = &jobs.Status{ID: "42", URL: "https://www.successweb.com", Depth: 2, Status: jobs.StatusQueued}
+
+func (j *MockJobs) Submit(seedURL *url.URL, maxDepth int, opts data.Options) (*jobs.Status, error) {
+	switch j.State {
+	case jobQueued:
+		return queuedStatus, nil
+	case queueFull:
+		return nil, jobs.ErrQueueFull
+	default:
+		panic(fmt.Sprintf("Invalid mockStateJobs: %v", j.State))
+	}
+}
+
+func (j *MockJobs) Status(id string) (*jobs.Status, error) {
+	switch j.State {
+	case jobRunning:
+		return &jobs.Status{ID: id, URL: "https://www.successweb.com", Depth: 2, Status: jobs.StatusRunning, Progress: data.Progress{Discovered: 10, Queued: 5, Fetched: 2}}, nil
+	case jobNotFound:
+		return nil, jobs.ErrNotFound
+	default:
+		panic(fmt.Sprintf("Invalid mockStateJobs: %v", j.State))
+	}
+}
+
+func (j *MockJobs) Result(id string) (*data.Response, *jobs.Status, error) {
+	switch j.State {
+	case jobRunning:
+		return nil, &jobs.Status{ID: id, URL: "https://www.successweb.com", Depth: 2, Status: jobs.StatusRunning}, jobs.ErrNotFinished
+	case jobDone:
+		return &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: make([]*data.Response, 0)}, nil, nil
+	case jobNotFound:
+		return nil, nil, jobs.ErrNotFound
+	default:
+		panic(fmt.Sprintf("Invalid mockStateJobs: %v", j.State))
+	}
+}
+
+func (j *MockJobs) Cancel(id string) (*jobs.Status, error) {
+	switch j.State {
+	case jobRunning:
+		return &jobs.Status{ID: id, URL: "https://www.successweb.com", Depth: 2, Status: jobs.StatusCancelled}, nil
+	case jobNotFound:
+		return nil, jobs.ErrNotFound
+	default:
+		panic(fmt.Sprintf("Invalid mockStateJobs: %v", j.State))
+	}
+}
+
+func (j *MockJobs) Resume(id string) (*jobs.Status, error) {
+	switch j.State {
+	case jobInterrupted:
+		return &jobs.Status{ID: id, URL: "https://www.successweb.com", Depth: 2, Status: jobs.StatusQueued, Progress: data.Progress{Discovered: 10, Queued: 5, Fetched: 2}}, nil
+	case jobDone:
+		return nil, jobs.ErrNotResumable
+	case jobNotFound:
+		return nil, jobs.ErrNotFound
+	default:
+		panic(fmt.Sprintf("Invalid mockStateJobs: %v", j.State))
+	}
+}
+
+// GET /crawl streamed
+func TestHandleCrawlStream(t *testing.T) {
+	assert := assert.New(t)
+
+	const (
+		root    = `{"type":"node","url":"https://www.successweb.com","depth":0,"title":"Success Web","status":200}`
+		broken  = `{"type":"node","url":"https://www.successweb.com/broken","parent":"https://www.successweb.com","depth":1,"title":"","status":404,"error":"Not Found"}`
+		summary = `{"type":"summary","url":"https://www.successweb.com","title":"Success Web","nodes":2,"fetched":2,"errors":1,"elapsed_ms":0,"limits":["max_pages"]}`
+	)
+
+	tt := []struct {
+		name                string
+		url                 string
+		accept              string
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			name:                "NDJSON",
+			url:                 "/crawl?url=https://www.successweb.com&format=ndjson",
+			expectedContentType: "application/x-ndjson",
+			expectedBody:        root + "\n" + broken + "\n" + summary + "\n",
+		},
+		{
+			name:                "Server-Sent Events from Accept header",
+			url:                 "/crawl?url=https://www.successweb.com",
+			accept:              "text/event-stream",
+			expectedContentType: "text/event-stream",
+			expectedBody:        "event: node\ndata: " + root + "\n\nevent: node\ndata: " + broken + "\n\nevent: summary\ndata: " + summary + "\n\n",
+		},
+		{
+			name:                "Format parameter wins over Accept header",
+			url:                 "/crawl?url=https://www.successweb.com&format=ndjson",
+			accept:              "text/event-stream",
+			expectedContentType: "application/x-ndjson",
+			expectedBody:        root + "\n" + broken + "\n" + summary + "\n",
+		},
+	}
+
+	elapsed := regexp.MustCompile(`"elapsed_ms":\d+`)
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			h := handler.NewHandler(&MockCrawler{State: streamedResponse})
+
+			req, err := http.NewRequest("GET", tc.url, nil)
+			assert.NoError(err)
+			req.Header.Set("Accept", tc.accept)
+
+			w := httptest.NewRecorder()
+			h.HandleCrawl(w, req)
+
+			assert.Equal(200, w.Code, tc.name)
+			assert.Equal(tc.expectedContentType, w.Header().Get("Content-Type"), tc.name)
+			assert.True(w.Flushed, tc.name)
+			assert.Equal(tc.expectedBody, elapsed.ReplaceAllString(w.Body.String(), `"elapsed_ms":0`), tc.name)
+		})
+	}
+}
+
+// GET /crawl with configured defaults
+func TestHandleCrawlDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	defaults := handler.Defaults{Depth: 4, MaxConcurrency: 8, Sitemaps: true, Scope: "host", Keywords: []string{"blog"}, Seed: 7, Shape: "graph"}
+
+	tt := []struct {
+		name               string
+		url                string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			name:               "Defaults",
+			url:                "/crawl?url=https://www.successweb.com",
+			expectedStatusCode: 200,
+			expectedBody:       `{"nodes":{"https://www.successweb.com":{"depth":0,"title":"depth=4 sitemaps=true scoped=true strategy= scorer=*frontier.Keywords seed=7"}},"edges":[]}`,
+		},
+		{
+			name:               "Parameters win over defaults",
+			url:                "/crawl?url=https://www.successweb.com&depth=3&sitemaps=false&strategy=best&scorer=inlinks&seed=42&shape=tree",
+			expectedStatusCode: 200,
+			expectedBody:       `{"depth":0,"title":"depth=3 sitemaps=false scoped=true strategy=best scorer=*frontier.InLinks seed=42","url":"https://www.successweb.com","nodes":[]}`,
+		},
+		{
+			name:               "Bad Request: concurrency above the default maximum",
+			url:                "/crawl?url=https://www.successweb.com&concurrency=9",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "Bad Request: default shape streamed",
+			url:                "/crawl?url=https://www.successweb.com&format=ndjson",
+			expectedStatusCode: 400,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			h := handler.NewHandler(&MockCrawler{State: paramsResponse}, handler.WithDefaults(defaults))
+
+			req, err := http.NewRequest("GET", tc.url, nil)
+			assert.NoError(err)
+
+			w := httptest.NewRecorder()
+			h.HandleCrawl(w, req)
+
+			assert.Equal(tc.expectedStatusCode, w.Code, tc.name)
+			assert.Equal(tc.expectedBody, strings.TrimSpace(w.Body.String()), tc.name)
+		})
+	}
+}
+
+// GET /crawl exported
+func TestHandleCrawlExport(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name                string
+		url                 string
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			name:                "GraphViz DOT",
+			url:                 "/crawl?url=https://www.successweb.com&format=dot",
+			expectedContentType: "text/vnd.graphviz; charset=utf-8",
+			expectedBody:        "digraph crawl {\n  \"https://www.successweb.com\" [label=\"Success Web\", depth=\"0\", title=\"Success Web\"];\n}\n",
+		},
+		{
+			name:                "GraphML",
+			url:                 "/crawl?url=https://www.successweb.com&format=graphml",
+			expectedContentType: "application/graphml+xml; charset=utf-8",
+			expectedBody:        "<?xml",
+		},
+		{
+			name:                "GEXF",
+			url:                 "/crawl?url=https://www.successweb.com&format=gexf&shape=graph",
+			expectedContentType: "application/gexf+xml; charset=utf-8",
+			expectedBody:        "<?xml",
+		},
+		{
+			name:                "Sitemap",
+			url:                 "/crawl?url=https://www.successweb.com&format=sitemap",
+			expectedContentType: "application/xml; charset=utf-8",
+			expectedBody:        "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<urlset xmlns=\"http://www.sitemaps.org/schemas/sitemap/0.9\">\n</urlset>\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			h := handler.NewHandler(&MockCrawler{State: successResponse})
+
+			req, err := http.NewRequest("GET", tc.url, nil)
+			assert.NoError(err)
+
+			w := httptest.NewRecorder()
+			h.HandleCrawl(w, req)
+
+			assert.Equal(200, w.Code, tc.name)
+			assert.Equal(tc.expectedContentType, w.Header().Get("Content-Type"), tc.name)
+			assert.True(strings.HasPrefix(w.Body.String(), tc.expectedBody), tc.name)
+		})
+	}
+}
+
+// POST /crawls, GET /crawls/:id, GET /crawls/:id/result, DELETE /crawls/:id, POST /crawls/:id/resume
+func TestHandleJobs(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name               string
+		state              mockStateJobs
+		method             string
+		url                string
+		form               url.Values
+		expectedStatusCode int
+		expectedLocation   string
+		expectedBody       string
+	}{
+		{
+			name:               "Submit from form",
+			state:              jobQueued,
+			method:             "POST",
+			url:                "/crawls",
+			form:               url.Values{"url": {"https://www.successweb.com"}, "max_pages": {"10"}},
+			expectedStatusCode: 202,
+			expectedLocation:   "/crawls/42",
+			expectedBody:       `{"id":"42","url":"https://www.successweb.com","depth":2,"status":"queued","progress":{"discovered":0,"queued":0,"fetched":0},"created_at":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:               "Submit from query string",
+			state:              jobQueued,
+			method:             "POST",
+			url:                "/crawls?url=https://www.successweb.com",
+			expectedStatusCode: 202,
+			expectedLocation:   "/crawls/42",
+			expectedBody:       `{"id":"42","url":"https://www.successweb.com","depth":2,"status":"queued","progress":{"discovered":0,"queued":0,"fetched":0},"created_at":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:               "Submit bad request",
+			state:              jobQueued,
+			method:             "POST",
+			url:                "/crawls",
+			form:               url.Values{"url": {"https://www.successweb.com"}, "max_pages": {"lots"}},
+			expectedStatusCode: 400,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Submit queue full",
+			state:              queueFull,
+			method:             "POST",
+			url:                "/crawls?url=https://www.successweb.com",
+			expectedStatusCode: 503,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Status with progress",
+			state:              jobRunning,
+			method:             "GET",
+			url:                "/crawls/42",
+			expectedStatusCode: 200,
+			expectedBody:       `{"id":"42","url":"https://www.successweb.com","depth":2,"status":"running","progress":{"discovered":10,"queued":5,"fetched":2},"created_at":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:               "Status not found",
+			state:              jobNotFound,
+			method:             "GET",
+			url:                "/crawls/43",
+			expectedStatusCode: 404,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Result of finished crawl",
+			state:              jobDone,
+			method:             "GET",
+			url:                "/crawls/42/result",
+			expectedStatusCode: 200,
+			expectedBody:       `{"depth":0,"title":"Success Web","url":"https://www.successweb.com","nodes":[]}`,
+		},
+		{
+			name:               "Result of finished crawl as a graph",
+			state:              jobDone,
+			method:             "GET",
+			url:                "/crawls/42/result?shape=graph",
+			expectedStatusCode: 200,
+			expectedBody:       `{"nodes":{"https://www.successweb.com":{"depth":0,"title":"Success Web"}},"edges":[]}`,
+		},
+		{
+			name:               "Result of finished crawl in unknown format",
+			state:              jobDone,
+			method:             "GET",
+			url:                "/crawls/42/result?format=xml",
+			expectedStatusCode: 400,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Result of running crawl",
+			state:              jobRunning,
+			method:             "GET",
+			url:                "/crawls/42/result",
+			expectedStatusCode: 409,
+			expectedBody:       `{"id":"42","url":"https://www.successweb.com","depth":2,"status":"running","progress":{"discovered":0,"queued":0,"fetched":0},"created_at":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:               "Result not found",
+			state:              jobNotFound,
+			method:             "GET",
+			url:                "/crawls/43/result",
+			expectedStatusCode: 404,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Cancel running crawl",
+			state:              jobRunning,
+			method:             "DELETE",
+			url:                "/crawls/42",
+			expectedStatusCode: 200,
+			expectedBody:       `{"id":"42","url":"https://www.successweb.com","depth":2,"status":"cancelled","progress":{"discovered":0,"queued":0,"fetched":0},"created_at":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:               "Cancel not found",
+			state:              jobNotFound,
+			method:             "DELETE",
+			url:                "/crawls/43",
+			expectedStatusCode: 404,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Resume interrupted crawl",
+			state:              jobInterrupted,
+			method:             "POST",
+			url:                "/crawls/42/resume",
+			expectedStatusCode: 202,
+			expectedLocation:   "/crawls/42",
+			expectedBody:       `{"id":"42","url":"https://www.successweb.com","depth":2,"status":"queued","progress":{"discovered":10,"queued":5,"fetched":2},"created_at":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:               "Resume finished crawl",
+			state:              jobDone,
+			method:             "POST",
+			url:                "/crawls/42/resume",
+			expectedStatusCode: 409,
+			expectedBody:       ``,
+		},
+		{
+			name:               "Resume not found",
+			state:              jobNotFound,
+			method:             "POST",
+			url:                "/crawls/43/resume",
+			expectedStatusCode: 404,
+			expectedBody:       ``,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			h := handler.NewHandler(&MockCrawler{State: emptyResponse}, handler.WithJobs(&MockJobs{State: tc.state}))
+			mux := goji.NewMux()
+			mux.HandleFunc(pat.Post("/crawls"), h.HandleSubmit)
+			mux.HandleFunc(pat.Get("/crawls/:id"), h.HandleStatus)
+			mux.HandleFunc(pat.Get("/crawls/:id/result"), h.HandleResult)
+			mux.HandleFunc(pat.Delete("/crawls/:id"), h.HandleCancel)
+			mux.HandleFunc(pat.Post("/crawls/:id/resume"), h.HandleResume)
+
+			req, err := http.NewRequest(tc.method, tc.url, strings.NewReader(tc.form.Encode()))
+			assert.NoError(err)
+			if tc.form != nil {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			assert.Equal(tc.expectedStatusCode, w.Code, tc.name)
+			assert.Equal(tc.expectedLocation, w.Header().Get("Location"), tc.name)
+
+			body, err := ioutil.ReadAll(w.Body)
+			require.NoError(t, err, "Error reading response")
+			if string(body) != "" {
+				assert.JSONEq(tc.expectedBody, string(body), tc.name)
+			} else {
+				assert.Equal(tc.expectedBody, string(body), tc.name)
+			}
+		})
+	}
+}
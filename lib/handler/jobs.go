@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"goji.io/pat"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/jobs"
+	"github.com/smashed-avo/go-crawler/lib/output"
+)
+
+// Jobber interface for the asynchronous crawl functions
+type Jobber interface {
+	Submit(seedURL *url.URL, maxDepth int, opts data.Options) (*jobs.Status, error)
+	Status(id string) (*jobs.Status, error)
+	Result(id string) (*data.Response, *jobs.Status, error)
+	Cancel(id string) (*jobs.Status, error)
+	Resume(id string) (*jobs.Status, error)
+}
+
+// HandleSubmit handles POST /crawls, the crawl parameters are those of GET /crawl sent as a form or in the
+// query string
+func (h *Handler) HandleSubmit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := r.ParseForm(); err != nil {
+		println(err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	u, maxDepth, opts, err := ParseCrawl(r.Form, h.Defaults)
+	if err != nil {
+		println(err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s, err := h.Jobs.Submit(u, maxDepth, opts)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/crawls/"+s.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(s)
+}
+
+// HandleStatus handles GET /crawls/:id, it returns the state and progress of a crawl
+func (h *Handler) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	s, err := h.Jobs.Status(pat.Param(r, "id"))
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(s)
+}
+
+// HandleResult handles GET /crawls/:id/result, it returns the tree, the graph with shape=graph or in an export
+// format, or the sitemap of a finished crawl, or the state of a crawl still running
+func (h *Handler) HandleResult(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	shape, err := parseShape(r.URL.Query(), h.Defaults.Shape)
+	format := r.URL.Query().Get("format")
+	if format == "" && !output.Streamed(h.Defaults.Format) {
+		format = h.Defaults.Format
+	}
+	if err == nil && (!output.Supported(format) || output.Streamed(format)) {
+		err = fmt.Errorf("invalid format parameter: %q", format)
+	}
+	if err != nil {
+		println(err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	res, s, err := h.Jobs.Result(pat.Param(r, "id"))
+	if err == jobs.ErrNotFinished {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(s)
+		return
+	}
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	writeResult(w, res, shape, format)
+}
+
+// HandleCancel handles DELETE /crawls/:id, the partial tree of a cancelled crawl stays available
+func (h *Handler) HandleCancel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	s, err := h.Jobs.Cancel(pat.Param(r, "id"))
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(s)
+}
+
+// HandleResume handles POST /crawls/:id/resume, an interrupted or cancelled crawl is queued again and keeps
+// the sites already fetched
+func (h *Handler) HandleResume(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	s, err := h.Jobs.Resume(pat.Param(r, "id"))
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/crawls/"+s.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(s)
+}
+
+// writeJobError maps job errors to status codes
+func writeJobError(w http.ResponseWriter, err error) {
+	println(err.Error())
+	switch err {
+	case jobs.ErrNotFound:
+		w.WriteHeader(http.StatusNotFound)
+	case jobs.ErrQueueFull:
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case jobs.ErrNotResumable:
+		w.WriteHeader(http.StatusConflict)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/frontier"
+	"github.com/smashed-avo/go-crawler/lib/linkcheck"
+	"github.com/smashed-avo/go-crawler/lib/output"
+	"github.com/smashed-avo/go-crawler/lib/scope"
+)
+
+// defaultDepth is the crawling depth when none is requested, only first level children of the seed URL
+const defaultDepth = 2
+
+// defaultMaxConcurrency is the largest worker pool a request can ask for when no maximum is set
+const defaultMaxConcurrency = 100
+
+// ParseCrawl validates the crawl parameters, unset parameters fall back to the handler defaults and unset
+// options to the crawler defaults. The parameters are kept in the options to resume the crawl
+func ParseCrawl(q url.Values, d Defaults) (*url.URL, int, data.Options, error) {
+	opts := data.Options{Params: q}
+
+	u, err := url.ParseRequestURI(q.Get("url"))
+	if err != nil {
+		return nil, 0, opts, err
+	}
+
+	// A linkcheck crawl reports the broken links of every page of a host or path scope unless a depth is
+	// requested, wider scopes keep the default depth
+	opts.Mode = valueOr(q, "mode", d.Mode)
+	if opts.Mode != "" && opts.Mode != data.ModeCrawl && opts.Mode != data.ModeLinkCheck {
+		return nil, 0, opts, fmt.Errorf("invalid mode parameter: %q", opts.Mode)
+	}
+
+	maxDepth := d.Depth
+	if maxDepth < 1 {
+		maxDepth = defaultDepth
+	}
+	if q.Get("depth") != "" {
+		maxDepth, err = strconv.Atoi(q.Get("depth"))
+		if err != nil {
+			return nil, 0, opts, err
+		}
+	}
+
+	// Size of the worker pool, bounded so a single request cannot start any number of goroutines
+	if opts.Concurrency, err = positiveInt(q, "concurrency"); err != nil {
+		return nil, 0, opts, err
+	}
+	maxConcurrency := d.MaxConcurrency
+	if maxConcurrency < 1 {
+		maxConcurrency = defaultMaxConcurrency
+	}
+	if opts.Concurrency > maxConcurrency {
+		return nil, 0, opts, fmt.Errorf("concurrency parameter %d is above the maximum of %d", opts.Concurrency, maxConcurrency)
+	}
+	// Wall-clock budget of the crawl
+	if opts.Timeout, err = positiveDuration(q, "timeout"); err != nil {
+		return nil, 0, opts, err
+	}
+	// Politeness limits applied to every host
+	if opts.HostConcurrency, err = positiveInt(q, "host_concurrency"); err != nil {
+		return nil, 0, opts, err
+	}
+	if opts.HostDelay, err = positiveDuration(q, "host_delay"); err != nil {
+		return nil, 0, opts, err
+	}
+	if opts.HostRPS, err = positiveFloat(q, "host_rps"); err != nil {
+		return nil, 0, opts, err
+	}
+
+	// Pages listed in the sitemaps of the site
+	if opts.Sitemaps, err = parseBool(q, "sitemaps"); err != nil {
+		return nil, 0, opts, err
+	}
+	if q.Get("sitemaps") == "" {
+		opts.Sitemaps = d.Sitemaps
+	}
+
+	// Order the sites of every host are fetched in, ranked by the scorer for a best first crawl
+	opts.Strategy = q.Get("strategy")
+	if !frontier.Supported(opts.Strategy) {
+		return nil, 0, opts, fmt.Errorf("invalid strategy parameter: %q", opts.Strategy)
+	}
+	scorer, keywords := valueOr(q, "scorer", d.Scorer), q["keyword"]
+	if len(keywords) == 0 {
+		keywords = d.Keywords
+	}
+	if scorer != "" || len(keywords) > 0 {
+		if opts.Scorer, err = frontier.NewScorer(scorer, keywords); err != nil {
+			return nil, 0, opts, err
+		}
+	}
+	// A seeded crawl is reproducible
+	opts.Seed = d.Seed
+	if q.Get("seed") != "" {
+		if opts.Seed, err = strconv.ParseInt(q.Get("seed"), 10, 64); err != nil {
+			return nil, 0, opts, fmt.Errorf("invalid seed parameter: %q", q.Get("seed"))
+		}
+	}
+
+	// Size limits of the crawl
+	if opts.MaxPages, err = positiveInt(q, "max_pages"); err != nil {
+		return nil, 0, opts, err
+	}
+	if opts.MaxLinksPerPage, err = positiveInt(q, "max_links_per_page"); err != nil {
+		return nil, 0, opts, err
+	}
+	if opts.MaxPagesPerHost, err = positiveInt(q, "max_pages_per_host"); err != nil {
+		return nil, 0, opts, err
+	}
+
+	// Links followed by the crawl, every link when neither a scope parameter nor a default is set and the
+	// links of the seed host for a linkcheck crawl
+	mode, prefix := valueOr(q, "scope", d.Scope), valueOr(q, "path_prefix", d.PathPrefix)
+	include, exclude := q["include"], q["exclude"]
+	if len(include) == 0 {
+		include = d.Include
+	}
+	if len(exclude) == 0 {
+		exclude = d.Exclude
+	}
+	if mode == "" && prefix == "" && opts.Mode == data.ModeLinkCheck {
+		mode = scope.ModeHost
+	}
+	if mode != "" || prefix != "" || len(include) > 0 || len(exclude) > 0 {
+		if mode == "" && prefix != "" {
+			mode = scope.ModePath
+		}
+		if opts.Scope, err = scope.NewScope(u, mode, prefix, include, exclude); err != nil {
+			return nil, 0, opts, err
+		}
+	}
+	if opts.Mode == data.ModeLinkCheck && q.Get("depth") == "" && (mode == scope.ModeHost || mode == scope.ModePath) {
+		maxDepth = linkcheck.MaxDepth
+	}
+
+	return u, maxDepth, opts, nil
+}
+
+// parseShape validates the shape of the crawl result, the default shape or a tree of sites when not set
+func parseShape(q url.Values, def string) (string, error) {
+	shape, err := output.ParseShape(valueOr(q, "shape", def))
+	if err != nil {
+		return "", fmt.Errorf("invalid shape parameter: %q", q.Get("shape"))
+	}
+	return shape, nil
+}
+
+// valueOr returns a parameter or a default when it is not set
+func valueOr(q url.Values, name, def string) string {
+	if v := q.Get(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// positiveInt parses an optional parameter that must be greater than zero
+func positiveInt(q url.Values, name string) (int, error) {
+	if q.Get(name) == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(q.Get(name))
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid %s parameter: %q", name, q.Get(name))
+	}
+	return n, nil
+}
+
+// parseBool parses an optional boolean parameter
+func parseBool(q url.Values, name string) (bool, error) {
+	if q.Get(name) == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(q.Get(name))
+	if err != nil {
+		return false, fmt.Errorf("invalid %s parameter: %q", name, q.Get(name))
+	}
+	return b, nil
+}
+
+// positiveFloat parses an optional parameter that must be greater than zero
+func positiveFloat(q url.Values, name string) (float64, error) {
+	if q.Get(name) == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(q.Get(name), 64)
+	if err != nil || f <= 0 {
+		return 0, fmt.Errorf("invalid %s parameter: %q", name, q.Get(name))
+	}
+	return f, nil
+}
+
+// positiveDuration parses an optional parameter given as a Go duration (90s, 2m) or a plain number of
+// seconds, that must be greater than zero
+func positiveDuration(q url.Values, name string) (time.Duration, error) {
+	if q.Get(name) == "" {
+		return 0, nil
+	}
+	d, err := parseDuration(q.Get(name))
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s parameter: %q", name, q.Get(name))
+	}
+	return d, nil
+}
+
+// parseDuration accepts a Go duration or a plain number of seconds
+func parseDuration(s string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(s); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/smashed-avo/go-crawler/lib/output"
+)
+
+// responseFormat returns the requested format, the format parameter wins over the Accept header and the
+// Accept header over the default format
+func responseFormat(r *http.Request, def string) (string, error) {
+	f := r.URL.Query().Get("format")
+	if f == "" {
+		if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			return output.FormatSSE, nil
+		}
+		if def != "" {
+			return def, nil
+		}
+		return output.FormatJSON, nil
+	}
+	if !output.Supported(f) {
+		return "", fmt.Errorf("invalid format parameter: %q", f)
+	}
+	return f, nil
+}
+
+// newStream returns a stream of the sites of a crawl to the client
+func newStream(w http.ResponseWriter, format string) *output.Stream {
+	s := output.NewStream(w, format)
+	w.Header().Set("Content-Type", s.ContentType())
+	if format == output.FormatSSE {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	return s
+}
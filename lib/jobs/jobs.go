@@ -0,0 +1,647 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+)
+
+// Job states
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusDone      = "done"
+	StatusCancelled = "cancelled"
+	// StatusInterrupted is a job stopped by a shutdown of the service, it can be resumed
+	StatusInterrupted = "interrupted"
+)
+
+const (
+	// DefaultWorkers is the number of crawls run at the same time
+	DefaultWorkers = 2
+	// DefaultQueueSize is the number of crawls waiting for a worker
+	DefaultQueueSize = 100
+	// DefaultCheckpointInterval is how often the state of a running crawl is saved to the store
+	DefaultCheckpointInterval = 30 * time.Second
+	// DefaultRetention is how long a job that stopped is kept in memory
+	DefaultRetention = time.Hour
+	// DefaultRetainedJobs is the number of jobs that stopped kept in memory
+	DefaultRetainedJobs = 100
+)
+
+var (
+	// ErrQueueFull is returned when no more crawls can be submitted
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrNotFound is returned for an unknown job ID
+	ErrNotFound = errors.New("job not found")
+	// ErrNotFinished is returned when the result of a job is requested before it finished
+	ErrNotFinished = errors.New("job not finished")
+	// ErrNotResumable is returned when resuming a job that was not interrupted or cancelled
+	ErrNotResumable = errors.New("job cannot be resumed")
+)
+
+// Crawlerer is an interface to the crawl function
+type Crawlerer interface {
+	Crawl(ctx context.Context, seedURL *url.URL, maxDepth int, opts data.Options) *data.Response
+}
+
+// Status model the state of a job returned by the API
+type Status struct {
+	ID        string        `json:"id" description:"ID of the job"`
+	URL       string        `json:"url" description:"Seed URL of the crawl"`
+	Depth     int           `json:"depth" description:"Maximum depth of the crawl"`
+	Status    string        `json:"status" description:"State of the job: queued, running, done, cancelled or interrupted"`
+	Progress  data.Progress `json:"progress" description:"Progress counters of the crawl"`
+	Created   time.Time     `json:"created_at" description:"Time the job was submitted"`
+	Started   *time.Time    `json:"started_at,omitempty" description:"Time the crawl started"`
+	Finished  *time.Time    `json:"finished_at,omitempty" description:"Time the crawl finished"`
+	Truncated bool          `json:"truncated,omitempty" description:"Crawl stopped before completion"`
+}
+
+// Record is the state of a job kept in a store. The result is the last checkpoint of a job not finished,
+// the links of its sites are kept apart as they are not part of the tree JSON
+type Record struct {
+	Status Status                 `json:"status"`
+	Params url.Values             `json:"params,omitempty"`
+	Result *data.Response         `json:"result,omitempty"`
+	Links  map[string][]data.Link `json:"links,omitempty"`
+}
+
+// Store keeps the jobs across restarts, Get returns ErrNotFound for an unknown job
+type Store interface {
+	Save(r *Record) error
+	Get(id string) (*Record, error)
+	List() ([]*Record, error)
+}
+
+// Parser rebuilds the options of a crawl from its request parameters to resume it
+type Parser func(params url.Values) (*url.URL, int, data.Options, error)
+
+// job is a crawl submitted to the manager
+type job struct {
+	id       string
+	seedURL  *url.URL
+	maxDepth int
+	opts     data.Options
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	// Guarded by the manager lock
+	status   string
+	created  time.Time
+	started  time.Time
+	finished time.Time
+	stopped  time.Time
+	result   *data.Response
+}
+
+// Manager runs crawls in the background on a bounded pool of workers
+type Manager struct {
+	sync.Mutex
+	crawler    Crawlerer
+	workers    int
+	queueSize  int
+	queue      chan *job
+	jobs       map[string]*job
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+	closing    bool
+	store      Store
+	parse      Parser
+	interval   time.Duration
+	autoResume bool
+	retention  time.Duration
+	retained   int
+}
+
+// Option sets a setting of the manager
+type Option func(*Manager)
+
+// WithWorkers sets the number of crawls run at the same time
+func WithWorkers(n int) Option {
+	return func(m *Manager) {
+		if n > 0 {
+			m.workers = n
+		}
+	}
+}
+
+// WithQueueSize sets the number of crawls waiting for a worker, further submissions are rejected
+func WithQueueSize(n int) Option {
+	return func(m *Manager) {
+		if n > 0 {
+			m.queueSize = n
+		}
+	}
+}
+
+// WithStore keeps the jobs in a store, running crawls are checkpointed and the jobs interrupted by a
+// shutdown can be resumed with their options rebuilt by parse
+func WithStore(s Store, parse Parser) Option {
+	return func(m *Manager) {
+		m.store = s
+		m.parse = parse
+	}
+}
+
+// WithCheckpointInterval sets how often the state of a running crawl is saved to the store
+func WithCheckpointInterval(d time.Duration) Option {
+	return func(m *Manager) {
+		if d > 0 {
+			m.interval = d
+		}
+	}
+}
+
+// WithRetention sets how long a job that stopped is kept in memory, it is then read from the store
+func WithRetention(d time.Duration) Option {
+	return func(m *Manager) {
+		if d > 0 {
+			m.retention = d
+		}
+	}
+}
+
+// WithRetainedJobs sets the number of jobs that stopped kept in memory, the oldest ones are read from the store
+func WithRetainedJobs(n int) Option {
+	return func(m *Manager) {
+		if n > 0 {
+			m.retained = n
+		}
+	}
+}
+
+// WithAutoResume resumes the jobs interrupted by the last shutdown when the manager starts
+func WithAutoResume() Option {
+	return func(m *Manager) {
+		m.autoResume = true
+	}
+}
+
+// NewManager returns a pointer to a new job manager and starts its workers. The jobs of the store are
+// loaded, the ones queued or running when the service stopped are interrupted. Jobs that stopped are dropped
+// from memory past the retention, without a store they are then unknown
+func NewManager(c Crawlerer, opts ...Option) *Manager {
+	m := &Manager{
+		crawler:   c,
+		workers:   DefaultWorkers,
+		queueSize: DefaultQueueSize,
+		jobs:      make(map[string]*job),
+		interval:  DefaultCheckpointInterval,
+		retention: DefaultRetention,
+		retained:  DefaultRetainedJobs,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	m.queue = make(chan *job, m.queueSize)
+	m.load()
+
+	for i := 0; i < m.workers; i++ {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			for {
+				select {
+				case j := <-m.queue:
+					m.run(j)
+				case <-m.ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	if m.autoResume {
+		for _, id := range m.interrupted() {
+			if _, err := m.Resume(id); err != nil {
+				println(err.Error())
+			}
+		}
+	}
+
+	// Jobs loaded and not resumed are subject to the retention too
+	m.Lock()
+	m.prune()
+	m.Unlock()
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(m.retention)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.Lock()
+				m.prune()
+				m.Unlock()
+			case <-m.ctx.Done():
+				return
+			}
+		}
+	}()
+	return m
+}
+
+// Submit queues a crawl and returns its job
+func (m *Manager) Submit(seedURL *url.URL, maxDepth int, opts data.Options) (*Status, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	j := &job{
+		id:       id,
+		seedURL:  seedURL,
+		maxDepth: maxDepth,
+		opts:     opts,
+		status:   StatusQueued,
+		created:  time.Now(),
+	}
+	m.prepare(j)
+
+	m.Lock()
+	select {
+	case m.queue <- j:
+	default:
+		m.Unlock()
+		j.cancel()
+		return nil, ErrQueueFull
+	}
+	m.jobs[id] = j
+	s, r := m.status(j), m.record(j, nil)
+	m.Unlock()
+
+	m.save(r)
+	return s, nil
+}
+
+// Resume queues again an interrupted or cancelled job, the sites already fetched are kept
+func (m *Manager) Resume(id string) (*Status, error) {
+	j, err := m.find(id)
+	if err != nil {
+		return nil, err
+	}
+	m.Lock()
+	// A job read from the store is kept in memory again, unless it was read at the same time
+	if kept, ok := m.jobs[id]; ok {
+		j = kept
+	} else {
+		m.jobs[id] = j
+	}
+	if (j.status != StatusInterrupted && j.status != StatusCancelled) || m.parse == nil {
+		m.Unlock()
+		return nil, ErrNotResumable
+	}
+	m.Unlock()
+
+	// Options are rebuilt from the request parameters, the scope and observers are not serializable
+	seedURL, maxDepth, opts, err := m.parse(j.opts.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Lock()
+	if j.status != StatusInterrupted && j.status != StatusCancelled {
+		m.Unlock()
+		return nil, ErrNotResumable
+	}
+	prev := *j
+	opts.Resume = j.result
+	j.seedURL, j.maxDepth, j.opts = seedURL, maxDepth, opts
+	j.status, j.started, j.finished, j.result = StatusQueued, time.Time{}, time.Time{}, nil
+	m.prepare(j)
+	select {
+	case m.queue <- j:
+	default:
+		j.cancel()
+		*j = prev
+		m.Unlock()
+		return nil, ErrQueueFull
+	}
+	s, r := m.status(j), m.record(j, nil)
+	m.Unlock()
+
+	m.save(r)
+	return s, nil
+}
+
+// prepare sets the progress, context and checkpoints of a job about to be queued
+func (m *Manager) prepare(j *job) {
+	j.opts.Progress = &data.Progress{}
+	j.ctx, j.cancel = context.WithCancel(m.ctx)
+	if m.store != nil {
+		j.opts.Checkpointer = &checkpointer{m: m, j: j}
+		j.opts.CheckpointInterval = m.interval
+	}
+}
+
+// Status returns the state and progress of a job
+func (m *Manager) Status(id string) (*Status, error) {
+	j, err := m.find(id)
+	if err != nil {
+		return nil, err
+	}
+	m.Lock()
+	defer m.Unlock()
+	return m.status(j), nil
+}
+
+// Result returns the crawl tree of a finished job, a cancelled job returns its partial tree
+func (m *Manager) Result(id string) (*data.Response, *Status, error) {
+	j, err := m.find(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	m.Lock()
+	defer m.Unlock()
+	if j.result == nil {
+		return nil, m.status(j), ErrNotFinished
+	}
+	return j.result, m.status(j), nil
+}
+
+// Cancel stops a job, a queued job never starts and a running crawl returns its partial tree
+func (m *Manager) Cancel(id string) (*Status, error) {
+	j, err := m.find(id)
+	if err != nil {
+		return nil, err
+	}
+	m.Lock()
+	var r *Record
+	switch j.status {
+	case StatusQueued:
+		j.status = StatusCancelled
+		j.finished = time.Now()
+		j.stopped = j.finished
+		// A resumed job keeps the sites fetched before
+		j.result = j.opts.Resume
+		if j.result == nil {
+			j.result = emptyResult(j)
+		}
+		r = m.record(j, j.result)
+	case StatusRunning:
+		j.status = StatusCancelled
+	}
+	j.cancel()
+	s := m.status(j)
+	m.Unlock()
+
+	if r != nil {
+		m.save(r)
+		m.Lock()
+		m.prune()
+		m.Unlock()
+	}
+	return s, nil
+}
+
+// Close cancels every job and waits for the workers to stop, running jobs are saved as interrupted
+func (m *Manager) Close() {
+	m.Lock()
+	m.closing = true
+	m.Unlock()
+	m.cancel()
+	m.wg.Wait()
+}
+
+// run crawls a job unless it was cancelled while queued
+func (m *Manager) run(j *job) {
+	m.Lock()
+	// A job picked up while the manager closes stays queued, it is interrupted on the next start
+	if j.status != StatusQueued || m.closing {
+		m.Unlock()
+		return
+	}
+	j.status = StatusRunning
+	j.started = time.Now()
+	r := m.record(j, nil)
+	m.Unlock()
+	m.save(r)
+
+	res := m.crawler.Crawl(j.ctx, j.seedURL, j.maxDepth, j.opts)
+
+	m.Lock()
+	switch {
+	case j.status != StatusRunning:
+	case m.closing && res.Truncated:
+		j.status = StatusInterrupted
+	default:
+		j.status = StatusDone
+	}
+	j.finished = time.Now()
+	j.stopped = j.finished
+	j.result = res
+	j.cancel()
+	r = m.record(j, res)
+	m.Unlock()
+	m.save(r)
+
+	// The job is dropped from memory once its last state is in the store
+	m.Lock()
+	m.prune()
+	m.Unlock()
+}
+
+// status returns the API model of a job, the manager lock must be held
+func (m *Manager) status(j *job) *Status {
+	s := &Status{
+		ID:       j.id,
+		URL:      j.seedURL.String(),
+		Depth:    j.maxDepth,
+		Status:   j.status,
+		Progress: j.opts.Progress.Snapshot(),
+		Created:  j.created,
+	}
+	if !j.started.IsZero() {
+		started := j.started
+		s.Started = &started
+	}
+	if !j.finished.IsZero() {
+		finished := j.finished
+		s.Finished = &finished
+	}
+	if j.result != nil {
+		s.Truncated = j.result.Truncated
+	}
+	return s
+}
+
+// checkpointer saves the tree of a running job
+type checkpointer struct {
+	m *Manager
+	j *job
+}
+
+// Checkpoint saves the running job with the tree as its result
+func (c *checkpointer) Checkpoint(tree *data.Response) {
+	c.m.Lock()
+	r := c.m.record(c.j, tree)
+	c.m.Unlock()
+	c.m.save(r)
+}
+
+// record returns the stored state of a job with a tree as its result, the manager lock must be held
+func (m *Manager) record(j *job, tree *data.Response) *Record {
+	if m.store == nil {
+		return nil
+	}
+	if tree == nil {
+		// A job not started yet keeps the tree it resumes from
+		tree = j.opts.Resume
+	}
+	r := &Record{Status: *m.status(j), Params: j.opts.Params, Result: tree}
+	if tree != nil {
+		r.Links = make(map[string][]data.Link)
+		tree.Walk(func(n *data.Response) {
+			if len(n.Links) > 0 {
+				r.Links[n.URL] = n.Links
+			}
+		})
+	}
+	return r
+}
+
+// save writes a record to the store, a failed write is logged and the job carries on
+func (m *Manager) save(r *Record) {
+	if m.store == nil || r == nil {
+		return
+	}
+	if err := m.store.Save(r); err != nil {
+		println(err.Error())
+	}
+}
+
+// load restores the jobs of the store, the ones not finished are interrupted
+func (m *Manager) load() {
+	if m.store == nil {
+		return
+	}
+	records, err := m.store.List()
+	if err != nil {
+		println(err.Error())
+		return
+	}
+	for _, r := range records {
+		j, err := m.restore(r)
+		if err != nil {
+			println(err.Error())
+			continue
+		}
+		m.jobs[j.id] = j
+	}
+}
+
+// find returns a job kept in memory, or reads it from the store when it was dropped from memory
+func (m *Manager) find(id string) (*job, error) {
+	m.Lock()
+	j, ok := m.jobs[id]
+	m.Unlock()
+	if ok {
+		return j, nil
+	}
+	if m.store == nil {
+		return nil, ErrNotFound
+	}
+	r, err := m.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return m.restore(r)
+}
+
+// restore rebuilds a job from its record, a job not finished is interrupted
+func (m *Manager) restore(r *Record) (*job, error) {
+	seedURL, err := url.Parse(r.Status.URL)
+	if err != nil {
+		return nil, err
+	}
+	progress := r.Status.Progress
+	j := &job{
+		id:       r.Status.ID,
+		seedURL:  seedURL,
+		maxDepth: r.Status.Depth,
+		opts:     data.Options{Params: r.Params, Progress: &progress},
+		status:   r.Status.Status,
+		created:  r.Status.Created,
+		stopped:  time.Now(),
+		result:   r.Result,
+	}
+	// The job does not run until it is resumed, its context is replaced then
+	j.ctx, j.cancel = context.WithCancel(context.Background())
+	if r.Status.Started != nil {
+		j.started = *r.Status.Started
+	}
+	if r.Status.Finished != nil {
+		j.finished = *r.Status.Finished
+	}
+	if j.status == StatusQueued || j.status == StatusRunning {
+		j.status = StatusInterrupted
+	}
+	if j.result == nil {
+		j.result = emptyResult(j)
+	}
+	j.result.Truncated = j.result.Truncated || j.status == StatusInterrupted
+	j.result.Walk(func(n *data.Response) {
+		n.Links = r.Links[n.URL]
+	})
+	return j, nil
+}
+
+// prune drops from memory the jobs stopped for longer than the retention and the oldest ones past the number
+// retained, the manager lock must be held
+func (m *Manager) prune() {
+	list := make([]*job, 0)
+	for _, j := range m.jobs {
+		if j.status != StatusQueued && j.status != StatusRunning {
+			list = append(list, j)
+		}
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].stopped.After(list[b].stopped) })
+	expired := time.Now().Add(-m.retention)
+	for i, j := range list {
+		if i >= m.retained || j.stopped.Before(expired) {
+			delete(m.jobs, j.id)
+		}
+	}
+}
+
+// interrupted returns the IDs of the interrupted jobs, oldest first
+func (m *Manager) interrupted() []string {
+	m.Lock()
+	defer m.Unlock()
+	list := make([]*job, 0)
+	for _, j := range m.jobs {
+		if j.status == StatusInterrupted {
+			list = append(list, j)
+		}
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].created.Before(list[b].created) })
+	ids := make([]string, 0, len(list))
+	for _, j := range list {
+		ids = append(ids, j.id)
+	}
+	return ids
+}
+
+// emptyResult is the result of a job that never fetched its seed
+func emptyResult(j *job) *data.Response {
+	return &data.Response{URL: j.seedURL.String(), Nodes: make([]*data.Response, 0), Truncated: true}
+}
+
+// newID returns a random job ID
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
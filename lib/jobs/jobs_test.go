@@ -0,0 +1,327 @@
+package jobs_test
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/jobs"
+)
+
+const (
+	_ mockStateCrawler = iota
+	successResponse
+	blockedResponse
+	resumedResponse
+)
+
+type mockStateCrawler int
+
+type MockCrawler struct {
+	State mockStateCrawler
+}
+
+func (c *MockCrawler) Crawl(ctx context.Context, seedURL *url.URL, maxDepth int, opts data.Options) *data.Response {
+	switch c.State {
+	case successResponse:
+		opts.Progress.Queue()
+		opts.Progress.Fetch()
+		return &data.Response{Depth: 0, Title: "Success Web", URL: seedURL.String(), Nodes: make([]*data.Response, 0)}
+	case blockedResponse:
+		// Runs until the crawl is cancelled
+		opts.Progress.Queue()
+		<-ctx.Done()
+		return &data.Response{Depth: 0, URL: seedURL.String(), Nodes: make([]*data.Response, 0), Truncated: true}
+	case resumedResponse:
+		// Returns the tree it resumes from
+		if opts.Resume == nil {
+			return &data.Response{Depth: 0, Title: "Not Resumed", URL: seedURL.String(), Nodes: make([]*data.Response, 0)}
+		}
+		res := *opts.Resume
+		res.Truncated = false
+		return &res
+	default:
+		panic(fmt.Sprintf("Invalid mockStateCrawler: %v", c.State))
+	}
+}
+
+var seedURL, _ = url.Parse("https://www.successweb.com")
+
+type MockStore struct {
+	sync.Mutex
+	records map[string]*jobs.Record
+}
+
+func (s *MockStore) Save(r *jobs.Record) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.records == nil {
+		s.records = make(map[string]*jobs.Record)
+	}
+	s.records[r.Status.ID] = r
+	return nil
+}
+
+func (s *MockStore) List() ([]*jobs.Record, error) {
+	s.Lock()
+	defer s.Unlock()
+	list := make([]*jobs.Record, 0, len(s.records))
+	for _, r := range s.records {
+		list = append(list, r)
+	}
+	return list, nil
+}
+
+func (s *MockStore) Get(id string) (*jobs.Record, error) {
+	s.Lock()
+	defer s.Unlock()
+	r, ok := s.records[id]
+	if !ok {
+		return nil, jobs.ErrNotFound
+	}
+	return r, nil
+}
+
+func (s *MockStore) get(id string) *jobs.Record {
+	s.Lock()
+	defer s.Unlock()
+	return s.records[id]
+}
+
+// parse rebuilds the crawl of a job from its parameters
+func parse(params url.Values) (*url.URL, int, data.Options, error) {
+	u, err := url.Parse(params.Get("url"))
+	return u, 2, data.Options{Params: params}, err
+}
+
+// waitStatus polls a job until it reaches a state
+func waitStatus(t *testing.T, m *jobs.Manager, id, status string) *jobs.Status {
+	deadline := time.Now().Add(time.Second)
+	for {
+		s, err := m.Status(id)
+		require.NoError(t, err)
+		if s.Status == status {
+			return s
+		}
+		if time.Now().After(deadline) {
+			require.FailNow(t, "job did not reach state", "%s is %s, expected %s", id, s.Status, status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSubmit(t *testing.T) {
+	assert := assert.New(t)
+
+	m := jobs.NewManager(&MockCrawler{State: successResponse})
+	defer m.Close()
+
+	s, err := m.Submit(seedURL, 3, data.Options{})
+	assert.NoError(err)
+	assert.NotEmpty(s.ID)
+	assert.Equal("https://www.successweb.com", s.URL)
+	assert.Equal(3, s.Depth)
+
+	s = waitStatus(t, m, s.ID, jobs.StatusDone)
+	assert.Equal(data.Progress{Queued: 1, Fetched: 1}, s.Progress)
+	assert.NotNil(s.Started)
+	assert.NotNil(s.Finished)
+
+	res, _, err := m.Result(s.ID)
+	assert.NoError(err)
+	assert.Equal("Success Web", res.Title)
+
+	_, err = m.Status("unknown")
+	assert.Equal(jobs.ErrNotFound, err)
+}
+
+func TestSubmitQueueFull(t *testing.T) {
+	assert := assert.New(t)
+
+	m := jobs.NewManager(&MockCrawler{State: blockedResponse}, jobs.WithWorkers(1), jobs.WithQueueSize(1))
+	defer m.Close()
+
+	running, err := m.Submit(seedURL, 2, data.Options{})
+	assert.NoError(err)
+	waitStatus(t, m, running.ID, jobs.StatusRunning)
+
+	// One job runs and one waits, the next one is rejected
+	queued, err := m.Submit(seedURL, 2, data.Options{})
+	assert.NoError(err)
+	assert.Equal(jobs.StatusQueued, queued.Status)
+	_, err = m.Submit(seedURL, 2, data.Options{})
+	assert.Equal(jobs.ErrQueueFull, err)
+
+	_, _, err = m.Result(queued.ID)
+	assert.Equal(jobs.ErrNotFinished, err)
+}
+
+func TestCancel(t *testing.T) {
+	assert := assert.New(t)
+
+	m := jobs.NewManager(&MockCrawler{State: blockedResponse}, jobs.WithWorkers(1))
+	defer m.Close()
+
+	running, err := m.Submit(seedURL, 2, data.Options{})
+	assert.NoError(err)
+	waitStatus(t, m, running.ID, jobs.StatusRunning)
+	queued, err := m.Submit(seedURL, 2, data.Options{})
+	assert.NoError(err)
+
+	// A queued job never starts
+	s, err := m.Cancel(queued.ID)
+	assert.NoError(err)
+	assert.Equal(jobs.StatusCancelled, s.Status)
+	assert.Nil(s.Started)
+
+	// A running crawl returns its partial tree
+	_, err = m.Cancel(running.ID)
+	assert.NoError(err)
+	s = waitStatus(t, m, running.ID, jobs.StatusCancelled)
+	for s.Finished == nil {
+		time.Sleep(time.Millisecond)
+		s, _ = m.Status(running.ID)
+	}
+	assert.True(s.Truncated)
+	res, _, err := m.Result(running.ID)
+	assert.NoError(err)
+	assert.True(res.Truncated)
+
+	_, err = m.Cancel("unknown")
+	assert.Equal(jobs.ErrNotFound, err)
+}
+
+func TestResume(t *testing.T) {
+	assert := assert.New(t)
+
+	params := url.Values{"url": {seedURL.String()}}
+	st := &MockStore{}
+	m := jobs.NewManager(&MockCrawler{State: blockedResponse}, jobs.WithWorkers(1), jobs.WithStore(st, parse))
+	running, err := m.Submit(seedURL, 2, data.Options{Params: params})
+	assert.NoError(err)
+	waitStatus(t, m, running.ID, jobs.StatusRunning)
+	queued, err := m.Submit(seedURL, 2, data.Options{Params: params})
+	assert.NoError(err)
+
+	_, err = m.Resume(running.ID)
+	assert.Equal(jobs.ErrNotResumable, err)
+
+	// A shutdown interrupts the running job, the queued one is left queued in the store
+	m.Close()
+	assert.Equal(jobs.StatusInterrupted, st.get(running.ID).Status.Status)
+	assert.True(st.get(running.ID).Result.Truncated)
+	assert.Equal(jobs.StatusQueued, st.get(queued.ID).Status.Status)
+	assert.Equal(params, st.get(running.ID).Params)
+
+	// Jobs not finished are interrupted when loaded
+	st.get(running.ID).Result.Title = "Checkpoint"
+	st.get(running.ID).Links = map[string][]data.Link{seedURL.String(): {{URL: "https://www.successweb.com/a"}}}
+	m = jobs.NewManager(&MockCrawler{State: resumedResponse}, jobs.WithStore(st, parse))
+	defer m.Close()
+	for _, id := range []string{running.ID, queued.ID} {
+		s, err := m.Status(id)
+		assert.NoError(err)
+		assert.Equal(jobs.StatusInterrupted, s.Status)
+		assert.True(s.Truncated)
+	}
+	res, _, err := m.Result(running.ID)
+	assert.NoError(err)
+	assert.Equal([]data.Link{{URL: "https://www.successweb.com/a"}}, res.Links)
+
+	// A resumed job continues from its checkpoint
+	s, err := m.Resume(running.ID)
+	assert.NoError(err)
+	assert.Equal(jobs.StatusQueued, s.Status)
+	waitStatus(t, m, running.ID, jobs.StatusDone)
+	res, _, err = m.Result(running.ID)
+	assert.NoError(err)
+	assert.Equal("Checkpoint", res.Title)
+	assert.False(res.Truncated)
+	assert.Equal(jobs.StatusDone, st.get(running.ID).Status.Status)
+
+	// A job never started resumes from scratch
+	_, err = m.Resume(queued.ID)
+	assert.NoError(err)
+	waitStatus(t, m, queued.ID, jobs.StatusDone)
+	res, _, err = m.Result(queued.ID)
+	assert.NoError(err)
+	assert.Equal("", res.Title)
+
+	_, err = m.Resume(running.ID)
+	assert.Equal(jobs.ErrNotResumable, err)
+	_, err = m.Resume("unknown")
+	assert.Equal(jobs.ErrNotFound, err)
+}
+
+func TestAutoResume(t *testing.T) {
+	assert := assert.New(t)
+
+	st := &MockStore{}
+	created := time.Now()
+	assert.NoError(st.Save(&jobs.Record{
+		Status: jobs.Status{ID: "interrupted", URL: seedURL.String(), Depth: 2, Status: jobs.StatusRunning, Created: created},
+		Params: url.Values{"url": {seedURL.String()}},
+		Result: &data.Response{Title: "Checkpoint", URL: seedURL.String(), Nodes: make([]*data.Response, 0)},
+	}))
+
+	m := jobs.NewManager(&MockCrawler{State: resumedResponse}, jobs.WithStore(st, parse), jobs.WithAutoResume())
+	defer m.Close()
+	waitStatus(t, m, "interrupted", jobs.StatusDone)
+	res, _, err := m.Result("interrupted")
+	assert.NoError(err)
+	assert.Equal("Checkpoint", res.Title)
+}
+
+func TestRetention(t *testing.T) {
+	assert := assert.New(t)
+
+	st := &MockStore{}
+	m := jobs.NewManager(&MockCrawler{State: successResponse}, jobs.WithWorkers(1), jobs.WithStore(st, parse),
+		jobs.WithRetainedJobs(1))
+	defer m.Close()
+	first, err := m.Submit(seedURL, 2, data.Options{})
+	assert.NoError(err)
+	second, err := m.Submit(seedURL, 2, data.Options{})
+	assert.NoError(err)
+	waitStatus(t, m, second.ID, jobs.StatusDone)
+
+	// The oldest job is dropped from memory and read from the store, the stored tree tells them apart
+	r := *st.get(first.ID)
+	stored := *r.Result
+	stored.Title = "Stored"
+	r.Result = &stored
+	assert.NoError(st.Save(&r))
+	deadline := time.Now().Add(time.Second)
+	res, s, err := m.Result(first.ID)
+	for err == nil && res.Title != "Stored" && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		res, s, err = m.Result(first.ID)
+	}
+	assert.NoError(err)
+	assert.Equal("Stored", res.Title)
+	assert.Equal(jobs.StatusDone, s.Status)
+	assert.Equal(data.Progress{Queued: 1, Fetched: 1}, s.Progress)
+	res, _, err = m.Result(second.ID)
+	assert.NoError(err)
+	assert.Equal("Success Web", res.Title)
+
+	// Without a store a job dropped from memory is unknown
+	m = jobs.NewManager(&MockCrawler{State: successResponse}, jobs.WithRetention(10*time.Millisecond))
+	defer m.Close()
+	s, err = m.Submit(seedURL, 2, data.Options{})
+	assert.NoError(err)
+	waitStatus(t, m, s.ID, jobs.StatusDone)
+	deadline = time.Now().Add(time.Second)
+	for err == nil && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		_, err = m.Status(s.ID)
+	}
+	assert.Equal(jobs.ErrNotFound, err)
+}
@@ -0,0 +1,256 @@
+package linkcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/links"
+	"github.com/smashed-avo/go-crawler/lib/scheduler"
+)
+
+// DefaultConcurrency is the number of links checked at the same time
+const DefaultConcurrency = 10
+
+// MaxDepth is the depth of a linkcheck crawl when none is requested, every page in scope is crawled
+const MaxDepth = math.MaxInt32
+
+// Types of error of a broken link
+const (
+	ErrorDNS        = "dns"
+	ErrorTLS        = "tls"
+	ErrorTimeout    = "timeout"
+	ErrorConnection = "connection"
+	ErrorRedirect   = "redirect"
+	ErrorRequest    = "request"
+	Error4xx        = "4xx"
+	Error5xx        = "5xx"
+)
+
+// Checker checks the link targets of a crawl with HEAD requests, falling back to GET for the servers that
+// do not support HEAD
+type Checker struct {
+	client      links.WebClient
+	userAgent   string
+	concurrency int
+}
+
+// Option sets a setting of the checker
+type Option func(*Checker)
+
+// WithUserAgent sets the User-Agent header sent on every check
+func WithUserAgent(ua string) Option {
+	return func(c *Checker) {
+		c.userAgent = ua
+	}
+}
+
+// WithConcurrency sets the default number of links checked at the same time
+func WithConcurrency(n int) Option {
+	return func(c *Checker) {
+		if n > 0 {
+			c.concurrency = n
+		}
+	}
+}
+
+// NewChecker returns a pointer to a new link checker
+func NewChecker(client links.WebClient, opts ...Option) *Checker {
+	c := &Checker{client: client, concurrency: DefaultConcurrency}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// target is a link target of the crawl and the pages linking to it
+type target struct {
+	sources []data.LinkSource
+	seen    map[data.LinkSource]bool
+	status  int
+	err     error
+	checked bool
+	queued  bool
+}
+
+// Report checks every link target of the pages of a crawl tree, the sites fetched by the crawl are not
+// fetched again. Checks honour the host limits and stop when the context is done, the targets left are
+// counted as unchecked
+func (c *Checker) Report(ctx context.Context, tree *data.Response, concurrency int, l scheduler.Limits) *data.LinkReport {
+	targets := make(map[string]*target)
+	nodes := make(map[string]*data.Response)
+	tree.Walk(func(n *data.Response) {
+		if _, ok := nodes[n.URL]; !ok {
+			nodes[n.URL] = n
+		}
+		for _, link := range n.Links {
+			t, ok := targets[link.URL]
+			if !ok {
+				t = &target{seen: make(map[data.LinkSource]bool)}
+				targets[link.URL] = t
+			}
+			src := data.LinkSource{URL: n.URL, Text: link.Text, Element: link.Element, Attr: link.Attr}
+			if !t.seen[src] {
+				t.seen[src] = true
+				t.sources = append(t.sources, src)
+			}
+		}
+	})
+
+	// Sites fetched without error keep their status, the others are checked
+	sched := scheduler.NewScheduler(l, nil)
+	pending := 0
+	for u, t := range targets {
+		n, ok := nodes[u]
+		switch {
+		case ok && n.Skipped == data.SkippedRobots:
+		case ok && n.Status > 0 && n.Error == "":
+			t.status, t.checked = n.Status, true
+		default:
+			sched.Push(&data.Response{URL: u})
+			t.queued = true
+			pending++
+		}
+	}
+	c.run(ctx, sched, pending, concurrency, targets)
+
+	// A target queued and not checked was cut off by the context
+	report := &data.LinkReport{Broken: make([]*data.BrokenLink, 0)}
+	for u, t := range targets {
+		if !t.checked {
+			report.Unchecked++
+			report.Truncated = report.Truncated || t.queued
+			continue
+		}
+		report.Checked++
+		if typ := Classify(t.status, t.err); typ != "" {
+			b := &data.BrokenLink{URL: u, Status: t.status, Type: typ, Sources: t.sources}
+			if t.err != nil {
+				b.Error = t.err.Error()
+			}
+			report.Broken = append(report.Broken, b)
+		}
+	}
+	sort.Slice(report.Broken, func(i, j int) bool {
+		return report.Broken[i].URL < report.Broken[j].URL
+	})
+	return report
+}
+
+// run checks the queued targets with a pool of workers, a check aborted by the context is left unchecked
+func (c *Checker) run(ctx context.Context, sched *scheduler.Scheduler, pending, concurrency int, targets map[string]*target) {
+	if pending == 0 {
+		return
+	}
+	if concurrency < 1 {
+		concurrency = c.concurrency
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				node, ok := sched.Next(ctx)
+				if !ok {
+					return
+				}
+				status, err := c.Check(ctx, node.URL)
+				sched.Done(node)
+
+				mu.Lock()
+				if ctx.Err() == nil {
+					t := targets[node.URL]
+					t.status, t.err, t.checked = status, err, true
+				}
+				pending--
+				if pending == 0 {
+					sched.Close()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Check returns the status of a link target, it is requested with GET when HEAD is not allowed or not
+// implemented
+func (c *Checker) Check(ctx context.Context, u string) (int, error) {
+	status, err := c.do(ctx, http.MethodHead, u)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		return c.do(ctx, http.MethodGet, u)
+	}
+	return status, err
+}
+
+// do sends a single request, the body is not read
+func (c *Checker) do(ctx context.Context, method, u string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// Classify returns the type of error of a checked link, empty when the link is not broken
+func Classify(status int, err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var opErr *net.OpError
+	switch {
+	case err == nil && status >= http.StatusInternalServerError:
+		return Error5xx
+	case err == nil && status >= http.StatusBadRequest:
+		return Error4xx
+	case err == nil:
+		return ""
+	case errors.Is(err, links.ErrRedirectLoop), errors.Is(err, links.ErrTooManyRedirects):
+		return ErrorRedirect
+	case errors.As(err, &dnsErr):
+		return ErrorDNS
+	case tlsError(err):
+		return ErrorTLS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorTimeout
+	case errors.As(err, &opErr):
+		return ErrorConnection
+	default:
+		return ErrorRequest
+	}
+}
+
+// tlsError reports whether an error comes from the TLS handshake or the verification of the certificate
+func tlsError(err error) bool {
+	var verifyErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &verifyErr), errors.As(err, &recordErr), errors.As(err, &alertErr):
+		return true
+	case errors.As(err, &authorityErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return true
+	}
+	// Handshake failures are often plain errors
+	return strings.Contains(err.Error(), "tls: ")
+}
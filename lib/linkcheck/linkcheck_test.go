@@ -0,0 +1,211 @@
+package linkcheck_test
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/linkcheck"
+	"github.com/smashed-avo/go-crawler/lib/links"
+	"github.com/smashed-avo/go-crawler/lib/scheduler"
+)
+
+// server answers HEAD as the sites checked do and records the requests it receives
+type server struct {
+	sync.Mutex
+	requests []string
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	s.Unlock()
+	switch r.URL.Path {
+	case "/gone":
+		w.WriteHeader(http.StatusNotFound)
+	case "/broken.png":
+		w.WriteHeader(http.StatusInternalServerError)
+	case "/nohead":
+		// HEAD is not allowed, GET works
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	case "/missing":
+		// HEAD is not implemented, GET finds nothing
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *server) requested() []string {
+	s.Lock()
+	defer s.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func TestCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &server{}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	tt := []struct {
+		name             string
+		path             string
+		expectedStatus   int
+		expectedRequests []string
+	}{
+		{
+			name:             "HEAD",
+			path:             "/ok",
+			expectedStatus:   200,
+			expectedRequests: []string{"HEAD /ok"},
+		},
+		{
+			name:             "GET when HEAD is not allowed",
+			path:             "/nohead",
+			expectedStatus:   200,
+			expectedRequests: []string{"HEAD /nohead", "GET /nohead"},
+		},
+		{
+			name:             "GET when HEAD is not implemented",
+			path:             "/missing",
+			expectedStatus:   404,
+			expectedRequests: []string{"HEAD /missing", "GET /missing"},
+		},
+		{
+			name:             "No GET for other errors",
+			path:             "/gone",
+			expectedStatus:   404,
+			expectedRequests: []string{"HEAD /gone"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s.requests = nil
+			c := linkcheck.NewChecker(http.DefaultClient)
+			status, err := c.Check(context.Background(), ts.URL+tc.path)
+			assert.NoError(err, tc.name)
+			assert.Equal(tc.expectedStatus, status, tc.name)
+			assert.Equal(tc.expectedRequests, s.requested(), tc.name)
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	assert := assert.New(t)
+
+	dnsErr := &url.Error{Op: "Head", URL: "https://nowhere.invalid", Err: &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "nowhere.invalid"}}}
+	refusedErr := &url.Error{Op: "Head", URL: "http://127.0.0.1:1", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+
+	tt := []struct {
+		name         string
+		status       int
+		err          error
+		expectedType string
+	}{
+		{name: "OK", status: 200},
+		{name: "Redirect", status: 304},
+		{name: "Not found", status: 404, expectedType: linkcheck.Error4xx},
+		{name: "Server error", status: 503, expectedType: linkcheck.Error5xx},
+		{name: "DNS", err: dnsErr, expectedType: linkcheck.ErrorDNS},
+		{name: "TLS", err: &url.Error{Op: "Head", URL: "https://self.signed", Err: x509.UnknownAuthorityError{}}, expectedType: linkcheck.ErrorTLS},
+		{name: "TLS handshake", err: errors.New("remote error: tls: handshake failure"), expectedType: linkcheck.ErrorTLS},
+		{name: "Timeout", err: &url.Error{Op: "Head", URL: "https://slow.com", Err: context.DeadlineExceeded}, expectedType: linkcheck.ErrorTimeout},
+		{name: "Connection", err: refusedErr, expectedType: linkcheck.ErrorConnection},
+		{name: "Redirect loop", err: &url.Error{Op: "Head", URL: "https://loop.com", Err: links.ErrRedirectLoop}, expectedType: linkcheck.ErrorRedirect},
+		{name: "Request", err: errors.New("unsupported protocol scheme"), expectedType: linkcheck.ErrorRequest},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(tc.expectedType, linkcheck.Classify(tc.status, tc.err), tc.name)
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &server{}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	// The seed links to a page fetched by the crawl, a page disallowed by robots.txt, a broken image and
+	// a page the crawl did not fetch, the fetched page links to the broken image too
+	tree := func() *data.Response {
+		return &data.Response{URL: ts.URL, Status: 200, Links: []data.Link{
+			{URL: ts.URL + "/gone", Text: "Gone", Element: "a", Attr: "href"},
+			{URL: ts.URL + "/gone", Text: "Gone", Element: "a", Attr: "href"},
+			{URL: ts.URL + "/private", Text: "Private", Element: "a", Attr: "href"},
+			{URL: ts.URL + "/broken.png", Text: "Logo", Element: "img", Attr: "src"},
+			{URL: ts.URL + "/ok", Text: "OK", Element: "a", Attr: "href"},
+			{URL: ts.URL + "/about", Text: "About", Element: "a", Attr: "href"},
+		}, Nodes: []*data.Response{
+			{URL: ts.URL + "/gone", Depth: 1, Status: 404},
+			{URL: ts.URL + "/private", Depth: 1, Skipped: data.SkippedRobots},
+			{URL: ts.URL + "/ok", Depth: 1, Status: 200},
+			{URL: ts.URL + "/about", Depth: 1, Status: 200, Links: []data.Link{
+				{URL: ts.URL + "/broken.png", Element: "img", Attr: "src"},
+			}},
+		}}
+	}
+	broken := []*data.BrokenLink{
+		{URL: ts.URL + "/broken.png", Status: 500, Type: linkcheck.Error5xx, Sources: []data.LinkSource{
+			{URL: ts.URL, Text: "Logo", Element: "img", Attr: "src"},
+			{URL: ts.URL + "/about", Element: "img", Attr: "src"},
+		}},
+		{URL: ts.URL + "/gone", Status: 404, Type: linkcheck.Error4xx, Sources: []data.LinkSource{
+			{URL: ts.URL, Text: "Gone", Element: "a", Attr: "href"},
+		}},
+	}
+
+	tt := []struct {
+		name             string
+		cancelled        bool
+		expectedReport   *data.LinkReport
+		expectedRequests []string
+	}{
+		{
+			name:             "Broken links grouped by target",
+			expectedReport:   &data.LinkReport{Checked: 4, Unchecked: 1, Broken: broken},
+			expectedRequests: []string{"HEAD /broken.png"},
+		},
+		{
+			name:             "Cancelled checks are left unchecked",
+			cancelled:        true,
+			expectedReport:   &data.LinkReport{Checked: 3, Unchecked: 2, Broken: broken[1:], Truncated: true},
+			expectedRequests: nil,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s.requests = nil
+			ctx, cancel := context.WithCancel(context.Background())
+			if tc.cancelled {
+				cancel()
+			}
+			defer cancel()
+
+			c := linkcheck.NewChecker(http.DefaultClient, linkcheck.WithConcurrency(2))
+			report := c.Report(ctx, tree(), 0, scheduler.Limits{MaxConcurrent: 1})
+			assert.Equal(tc.expectedReport, report, tc.name)
+			assert.ElementsMatch(tc.expectedRequests, s.requested(), tc.name)
+		})
+	}
+}
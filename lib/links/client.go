@@ -1,18 +1,69 @@
 package links
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+)
+
+// redirectLimit is the number of redirects followed before a fetch fails, as with the default http.Client
+const redirectLimit = 10
+
+var (
+	// ErrRedirectLoop is returned when a redirect leads back to a URL already requested by the fetch
+	ErrRedirectLoop = errors.New("redirect loop")
+	// ErrTooManyRedirects is returned when a fetch is redirected more than 10 times
+	ErrTooManyRedirects = fmt.Errorf("stopped after %d redirects", redirectLimit)
 )
 
 // HTTPClient Receiver for real http client
 type HTTPClient struct{}
 
-// WebClient Interface to web client Get
+// WebClient Interface to web client Do, the request carries the crawl context
 type WebClient interface {
-	Get(url string) (*http.Response, error)
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Do fetches website body as request
+func (h *HTTPClient) Do(req *http.Request) (*http.Response, error) {
+	return http.DefaultClient.Do(req)
+}
+
+// redirectsKey is the context key of the redirect chain recorded for a fetch
+type redirectsKey struct{}
+
+// chain is the redirect chain of a fetch
+type chain struct {
+	hops []data.Redirect
+}
+
+// withChain returns a context recording the redirect chain of a fetch
+func withChain(ctx context.Context) (context.Context, *chain) {
+	c := &chain{}
+	return context.WithValue(ctx, redirectsKey{}, c), c
 }
 
-// Get fetches website body as request
-func (h *HTTPClient) Get(url string) (*http.Response, error) {
-	return h.Get(url)
+// CheckRedirect is the CheckRedirect hook of the http.Client, it records every hop of the fetches of the
+// collector and stops redirect loops
+func CheckRedirect(req *http.Request, via []*http.Request) error {
+	prev := via[len(via)-1]
+	if c, ok := req.Context().Value(redirectsKey{}).(*chain); ok && req.Response != nil {
+		c.hops = append(c.hops, data.Redirect{
+			URL:      prev.URL.String(),
+			Status:   req.Response.StatusCode,
+			Location: req.Response.Header.Get("Location"),
+		})
+	}
+	for _, r := range via {
+		if r.URL.String() == req.URL.String() {
+			return ErrRedirectLoop
+		}
+	}
+	if len(via) >= redirectLimit {
+		return ErrTooManyRedirects
+	}
+	return nil
 }
@@ -1,63 +1,517 @@
 package links
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/PuerkitoBio/purell"
 	"golang.org/x/net/html"
+
+	"github.com/smashed-avo/go-crawler/lib/cache"
+	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/simhash"
 )
 
+// skipSchemes lists the non navigational schemes ignored when collecting links
+var skipSchemes = map[string]bool{
+	"mailto":     true,
+	"tel":        true,
+	"javascript": true,
+	"data":       true,
+}
+
+// linkAttrs lists the attributes holding a URL per element other than <a>, srcset holds a list of image
+// candidates
+var linkAttrs = map[string][]string{
+	"area":   {"href"},
+	"link":   {"href"},
+	"img":    {"src", "srcset"},
+	"script": {"src"},
+	"iframe": {"src"},
+	"form":   {"action"},
+	"video":  {"src"},
+	"audio":  {"src"},
+	"source": {"src", "srcset"},
+	"object": {"data"},
+}
+
+// Page models the result of a single fetch of a website
+type Page struct {
+	StatusCode    int
+	URL           string
+	Title         string
+	Links         []data.Link
+	Header        http.Header
+	ContentType   string
+	ContentLength int64
+	ResponseTime  time.Duration
+	// Unchanged is set when the page was not modified since it was cached
+	Unchanged bool
+	// Canonical is the canonical URL of the page given by the Link header or a <link rel="canonical">
+	Canonical string
+	// ContentHash is the hash of the visible text of an HTML page with its whitespace collapsed, empty when
+	// the page has no text
+	ContentHash string
+	// SimHash is the fingerprint of the visible text of an HTML page, pages differing by a few words have
+	// fingerprints differing by a few bits, 0 when the page has no text
+	SimHash uint64
+	// Redirects is the chain followed to fetch the page when the client uses CheckRedirect, flagged when it
+	// loops or is longer than the limit
+	Redirects     []data.Redirect
+	RedirectLoop  bool
+	LongRedirects bool
+}
+
+// Cacher stores the pages fetched to revalidate them on a later crawl
+type Cacher interface {
+	Get(url string) (*cache.Entry, bool)
+	Put(url string, e *cache.Entry)
+}
+
 // Collector processes a webpage and collect all links
 type Collector struct {
-	client WebClient
+	client       WebClient
+	userAgent    string
+	cache        Cacher
+	maxRedirects int
+}
+
+// Option sets a setting of the collector
+type Option func(*Collector)
+
+// WithUserAgent sets the User-Agent header sent on every fetch
+func WithUserAgent(ua string) Option {
+	return func(c *Collector) {
+		c.userAgent = ua
+	}
+}
+
+// WithCache revalidates the pages already cached with conditional requests, the title and links of a page
+// not modified are the cached ones
+func WithCache(c Cacher) Option {
+	return func(col *Collector) {
+		col.cache = c
+	}
+}
+
+// WithMaxRedirects flags the pages reached through more than n redirects, no page is flagged when not set
+func WithMaxRedirects(n int) Option {
+	return func(c *Collector) {
+		c.maxRedirects = n
+	}
 }
 
 // NewCollector returns a pointer to a new collector
-func NewCollector(client WebClient) *Collector {
-	return &Collector{client: client}
+func NewCollector(client WebClient, opts ...Option) *Collector {
+	c := &Collector{client: client}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
-// Collect extract title and all links from a given URL
-func (c *Collector) Collect(url string, chLinks chan string, chFinished chan bool, chErrors chan error) {
-	// Fetch website
-	resp, err := c.client.Get(url)
+// Collect fetches a given URL once and extracts its title and all links. When the body cannot be read, or
+// the redirects loop, the page is returned along the error with the details of the response.
+func (c *Collector) Collect(ctx context.Context, u string) (*Page, error) {
+	start := time.Now()
+
+	// Fetch website, the request is aborted when the context is done and its redirects are recorded
+	ctx, redirects := withChain(ctx)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
 	if err != nil {
-		chErrors <- err
-		return
+		return nil, err
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	var cached *cache.Entry
+	if c.cache != nil {
+		if e, ok := c.cache.Get(u); ok {
+			cached = e
+			if e.ETag != "" {
+				req.Header.Set("If-None-Match", e.ETag)
+			}
+			if e.LastModified != "" {
+				req.Header.Set("If-Modified-Since", e.LastModified)
+			}
+		}
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		// The last redirect is returned when the chain is stopped
+		if resp == nil || len(redirects.hops) == 0 {
+			return nil, err
+		}
+		page := &Page{
+			StatusCode:    resp.StatusCode,
+			URL:           resp.Request.URL.String(),
+			Links:         make([]data.Link, 0),
+			Header:        resp.Header,
+			ContentType:   resp.Header.Get("Content-Type"),
+			ContentLength: resp.ContentLength,
+			ResponseTime:  time.Since(start),
+		}
+		c.redirected(page, redirects, errors.Is(err, ErrRedirectLoop))
+		return page, err
 	}
 
 	b := resp.Body
 	defer b.Close()
 
+	// Links are resolved against the final URL after redirects
+	base, err := url.Parse(u)
+	if resp.Request != nil && resp.Request.URL != nil {
+		base, err = resp.Request.URL, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{
+		StatusCode:    resp.StatusCode,
+		URL:           base.String(),
+		Links:         make([]data.Link, 0),
+		Header:        resp.Header,
+		ContentType:   resp.Header.Get("Content-Type"),
+		ContentLength: resp.ContentLength,
+	}
+	c.redirected(page, redirects, false)
+	page.Canonical = canonicalHeader(resp.Header, base)
+
+	// A page not modified since it was cached keeps the cached title, links, canonical URL and fingerprints
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		page.Unchanged = true
+		page.Title = cached.Title
+		page.Links = append(page.Links, cached.Links...)
+		page.Canonical = cached.Canonical
+		page.ContentHash = cached.ContentHash
+		page.SimHash = cached.SimHash
+		page.ContentType = cached.ContentType
+		page.Header = resp.Header.Clone()
+		if page.Header.Get("Last-Modified") == "" {
+			page.Header.Set("Last-Modified", cached.LastModified)
+		}
+		page.ResponseTime = time.Since(start)
+		return page, nil
+	}
+
+	// Only HTML documents are parsed, the length is counted when the server does not send it
+	if IsHTML(page.ContentType) {
+		body := &countingReader{r: b}
+		hash := sha256.New()
+		err = parse(io.TeeReader(body, hash), base, page)
+		if page.ContentLength < 0 {
+			page.ContentLength = body.n
+		}
+		if err == nil && c.cache != nil && resp.StatusCode == http.StatusOK {
+			c.store(u, cached, page, hex.EncodeToString(hash.Sum(nil)))
+		}
+	}
+	page.ResponseTime = time.Since(start)
+	return page, err
+}
+
+// redirected sets the redirect chain of a page, a chain longer than the limit is flagged
+func (c *Collector) redirected(page *Page, redirects *chain, loop bool) {
+	if len(redirects.hops) == 0 {
+		return
+	}
+	page.Redirects = redirects.hops
+	page.RedirectLoop = loop
+	page.LongRedirects = c.maxRedirects > 0 && len(redirects.hops) > c.maxRedirects
+}
+
+// store caches a fetched page, a page with the same body as the cached one is unchanged even when the server
+// does not support conditional requests
+func (c *Collector) store(u string, cached *cache.Entry, page *Page, bodyHash string) {
+	page.Unchanged = cached != nil && cached.BodyHash == bodyHash
+	c.cache.Put(u, &cache.Entry{
+		ETag:         page.Header.Get("ETag"),
+		LastModified: page.Header.Get("Last-Modified"),
+		BodyHash:     bodyHash,
+		ContentType:  page.ContentType,
+		Title:        page.Title,
+		Links:        page.Links,
+		Canonical:    page.Canonical,
+		ContentHash:  page.ContentHash,
+		SimHash:      page.SimHash,
+		Stored:       time.Now(),
+	})
+}
+
+// parse tokenises an HTML document and extracts its title and all links, to pages and to resources, with
+// their element, attribute, anchor text and rel. The canonical URL is read unless the Link header gave it
+// and the visible text, out of the title, scripts and styles, is hashed and fingerprinted
+func parse(b io.Reader, base *url.URL, page *Page) error {
+	// Links are buffered as a <base> element applies to the whole document
+	found := make([]data.Link, 0)
+	inAnchor := -1
+	baseFound := false
+	inTitle, titleFound := false, false
+	hidden := 0
+	text := &strings.Builder{}
+
 	z := html.NewTokenizer(b)
 	for {
 		tt := z.Next()
 		switch tt {
 		case html.ErrorToken:
+			// Reading the body failed before the end of the document
+			if z.Err() != io.EOF {
+				return z.Err()
+			}
 			// End of the document
-			chFinished <- true
-			return
-		case html.StartTagToken, html.EndTagToken:
+			for _, a := range found {
+				if val, ok := resolveURL(base, a.URL); ok {
+					a.URL = val
+					a.Text = strings.Join(strings.Fields(a.Text), " ")
+					page.Links = append(page.Links, a)
+					if page.Canonical == "" && a.Element == "link" && hasRel(a.Rel, "canonical") {
+						page.Canonical = val
+					}
+				}
+			}
+			page.Title = strings.TrimSpace(page.Title)
+			if text.Len() > 0 {
+				sum := sha256.Sum256([]byte(text.String()))
+				page.ContentHash = hex.EncodeToString(sum[:])
+				page.SimHash = simhash.Fingerprint(strings.Fields(text.String()))
+			}
+			return nil
+		case html.TextToken:
+			t := z.Token().Data
+			if inTitle {
+				page.Title += t
+			}
+			if inAnchor >= 0 {
+				found[inAnchor].Text += t + " "
+			}
+			if !inTitle && hidden == 0 {
+				for _, w := range strings.Fields(t) {
+					if text.Len() > 0 {
+						text.WriteByte(' ')
+					}
+					text.WriteString(w)
+				}
+			}
+		case html.EndTagToken:
+			switch z.Token().Data {
+			case "title":
+				if inTitle {
+					inTitle, titleFound = false, true
+				}
+			case "a":
+				inAnchor = -1
+			case "script", "style", "noscript", "template":
+				if hidden > 0 {
+					hidden--
+				}
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
 			t := z.Token()
-			if "a" == t.Data {
-				for _, attr := range t.Attr {
-					if attr.Key == "href" {
-						// Make sure the url begins with http
-						if strings.Index(attr.Val, "http") == 0 {
-							if val, err := normalizeURL(attr.Val); err == nil {
-								chLinks <- val
-							}
-						}
+			switch t.Data {
+			case "title":
+				// Only the first <title> is the page title, others may belong to svg images
+				inTitle = !titleFound && tt == html.StartTagToken
+			case "style", "noscript", "template":
+				if tt == html.StartTagToken {
+					hidden++
+				}
+			case "a":
+				inAnchor = -1
+				if href, ok := getAttr(t, "href"); ok {
+					found = append(found, data.Link{URL: href, Rel: getRel(t), Element: "a", Attr: "href"})
+					if tt == html.StartTagToken {
+						inAnchor = len(found) - 1
+					}
+				}
+			case "base":
+				// Only the first <base href> is honoured
+				if href, ok := getAttr(t, "href"); ok && !baseFound {
+					if ref, err := url.Parse(strings.TrimSpace(href)); err == nil {
+						base = base.ResolveReference(ref)
+						baseFound = true
 					}
 				}
+			case "script":
+				found = append(found, resources(t)...)
+				if tt == html.StartTagToken {
+					hidden++
+				}
+			default:
+				found = append(found, resources(t)...)
+			}
+		}
+	}
+}
+
+// resources returns the links of an element other than an anchor, empty attributes are left out
+func resources(t html.Token) []data.Link {
+	attrs, ok := linkAttrs[t.Data]
+	if !ok {
+		return nil
+	}
+	alt, _ := getAttr(t, "alt")
+	list := make([]data.Link, 0)
+	for _, attr := range attrs {
+		val, ok := getAttr(t, attr)
+		if !ok || strings.TrimSpace(val) == "" {
+			continue
+		}
+		urls := []string{val}
+		if attr == "srcset" {
+			urls = parseSrcset(val)
+		}
+		for _, u := range urls {
+			list = append(list, data.Link{URL: u, Text: alt, Rel: getRel(t), Element: t.Data, Attr: attr})
+		}
+	}
+	return list
+}
+
+// parseSrcset returns the URLs of the candidates of a srcset attribute. A URL ends at a whitespace so data
+// URLs may contain commas, the descriptors following it are skipped
+func parseSrcset(srcset string) []string {
+	urls := make([]string, 0)
+	s := srcset
+	for {
+		s = strings.TrimLeft(s, " \t\n\r\f,")
+		if s == "" {
+			return urls
+		}
+		end := strings.IndexAny(s, " \t\n\r\f")
+		if end < 0 {
+			end = len(s)
+		}
+		u := s[:end]
+		s = s[end:]
+		if trimmed := strings.TrimRight(u, ","); trimmed != u {
+			// A URL ending with a comma has no descriptors
+			urls = append(urls, trimmed)
+			continue
+		}
+		urls = append(urls, u)
+		// Descriptors run until the next comma outside parentheses
+		depth := 0
+		i := 0
+		for ; i < len(s); i++ {
+			if s[i] == '(' {
+				depth++
+			} else if s[i] == ')' && depth > 0 {
+				depth--
+			} else if s[i] == ',' && depth == 0 {
+				break
+			}
+		}
+		s = s[i:]
+	}
+}
+
+// hasRel reports whether a rel attribute holds a value
+func hasRel(rel, value string) bool {
+	for _, r := range strings.Fields(rel) {
+		if r == value {
+			return true
+		}
+	}
+	return false
+}
+
+// linkHeader matches the links of a Link header and their parameters
+var linkHeader = regexp.MustCompile(`<([^>]*)>((?:\s*;\s*[^;,<]*)*)`)
+
+// relParam matches the rel parameter of a link of a Link header
+var relParam = regexp.MustCompile(`(?i)\brel\s*=\s*(?:"([^"]*)"|([^\s;,]*))`)
+
+// canonicalHeader returns the normalized canonical URL given by the Link header of a response, empty when
+// there is none
+func canonicalHeader(h http.Header, base *url.URL) string {
+	for _, v := range h.Values("Link") {
+		for _, m := range linkHeader.FindAllStringSubmatch(v, -1) {
+			rel := relParam.FindStringSubmatch(m[2])
+			if rel == nil || !hasRel(strings.ToLower(rel[1]+rel[2]), "canonical") {
+				continue
 			}
+			if u, ok := resolveURL(base, m[1]); ok {
+				return u
+			}
+		}
+	}
+	return ""
+}
+
+// getRel returns the rel attribute of a token lower cased with its values separated by a single space
+func getRel(t html.Token) string {
+	rel, _ := getAttr(t, "rel")
+	return strings.Join(strings.Fields(strings.ToLower(rel)), " ")
+}
+
+// IsHTML reports whether a Content-Type is an HTML document, a missing one is assumed to be HTML
+func IsHTML(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// countingReader counts the bytes read from a body
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// getAttr returns the value of the given attribute of a token
+func getAttr(t html.Token, key string) (string, bool) {
+	for _, attr := range t.Attr {
+		if attr.Key == key {
+			return attr.Val, true
 		}
 	}
+	return "", false
+}
+
+// resolveURL turns an href into an absolute, normalized http(s) URL
+func resolveURL(base *url.URL, href string) (string, bool) {
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return "", false
+	}
+	// Skip mailto:, tel:, javascript: and data: links explicitly
+	if skipSchemes[strings.ToLower(ref.Scheme)] {
+		return "", false
+	}
+	abs := base.ResolveReference(ref)
+	if abs.Scheme != "http" && abs.Scheme != "https" {
+		return "", false
+	}
+	val, err := NormalizeURL(abs.String())
+	if err != nil {
+		return "", false
+	}
+	return val, true
 }
 
-// Sanitise URL to include only safe URLs without fragments
-func normalizeURL(u string) (string, error) {
+// NormalizeURL sanitises a URL to include only safe URLs without fragments, it is the key of a visited site
+func NormalizeURL(u string) (string, error) {
 	parsedURL, err := url.Parse(u)
 	if err != nil {
 		return "", err
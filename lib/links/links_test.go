@@ -2,13 +2,22 @@ package links_test
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 
+	"github.com/smashed-avo/go-crawler/lib/cache"
+	"github.com/smashed-avo/go-crawler/lib/data"
 	"github.com/smashed-avo/go-crawler/lib/links"
+	"github.com/smashed-avo/go-crawler/lib/simhash"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -52,6 +61,76 @@ var (
  		<a href="#div_id">jump link</a>
  		<div id="div_id">jump here</div>
 	</body>
+</html>`
+	relativeLinksHTML = `<!DOCTYPE html>
+<html lang="en">
+	<head>
+		<title>title</title>
+	</head>
+	<body>
+		<a href="/about">About</a>
+		<a href="../docs">Docs</a>
+		<a href="page2.html">Page 2</a>
+		<a href="//cdn.example.com/x">CDN</a>
+		<a href="mailto:me@example.com">Mail me</a>
+		<a href="tel:+441234567890">Call me</a>
+		<a href="javascript:void(0)">Click</a>
+		<a href="data:text/plain,hello">Data</a>
+		<a href="ftp://ftp.example.com/file">FTP</a>
+	</body>
+</html>`
+	baseLinksHTML = `<!DOCTYPE html>
+<html lang="en">
+	<head>
+		<title>title</title>
+		<base href="https://static.example.com/assets/">
+	</head>
+	<body>
+		<a href="page2.html">Page 2</a>
+		<a href="/root">Root</a>
+	</body>
+</html>`
+	anchorsHTML = `<!DOCTYPE html>
+<html lang="en">
+	<body>
+		<a href="/about" rel="NoFollow  External">
+			About <b>us</b>
+		</a>
+		<a href="/empty"><img src="logo.png"></a>
+		<a href="/unclosed">Unclosed
+		<a href="/next">Next</a>
+	</body>
+</html>`
+	resourcesHTML = `<!DOCTYPE html>
+<html lang="en">
+	<head>
+		<link rel="Stylesheet" href="/style.css">
+		<link rel="icon" href="">
+		<script src="app.js"></script>
+		<script>inline()</script>
+	</head>
+	<body>
+		<img src="logo.png" alt="Logo" srcset="logo-2x.png 2x, data:image/png;base64,iVBO,RK 3x,logo-4x.png,  https://cdn.example.com/logo(1).png 480w">
+		<map><area href="/region" alt="Region"></map>
+		<iframe src="https://video.example.com/embed/1"></iframe>
+		<form action="/search"></form>
+		<form></form>
+		<video src="clip.mp4"><source src="clip.webm"></video>
+		<audio><source src="sound.ogg"></audio>
+		<picture><source srcset="wide.webp 1200w, narrow.webp 600w"></picture>
+		<object data="doc.pdf"></object>
+	</body>
+</html>`
+	titleHTML = `<!DOCTYPE html>
+<html lang="en">
+	<head>
+		<title>
+			Go &amp; the Web
+		</title>
+	</head>
+	<body>
+		<svg><title>icon</title></svg>
+	</body>
 </html>`
 )
 
@@ -60,6 +139,13 @@ const (
 	success
 	nonParseableLink
 	sanitiseFragment
+	relativeLinks
+	baseLinks
+	titleOnly
+	anchors
+	resourceLinks
+	pdfDocument
+	brokenBody
 	errorClient
 )
 
@@ -75,7 +161,11 @@ type nopCloser struct {
 
 func (nopCloser) Close() error { return nil }
 
-func (c *MockClient) Get(url string) (*http.Response, error) {
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) { return 0, errors.New(`connection reset`) }
+
+func (c *MockClient) Do(req *http.Request) (*http.Response, error) {
 	switch c.State {
 	case success:
 		return &http.Response{Body: nopCloser{bytes.NewBufferString(threeLinksHTML)}}, nil
@@ -83,6 +173,20 @@ func (c *MockClient) Get(url string) (*http.Response, error) {
 		return &http.Response{Body: nopCloser{bytes.NewBufferString(nonParseableLinkHTML)}}, nil
 	case sanitiseFragment:
 		return &http.Response{Body: nopCloser{bytes.NewBufferString(fragmentLinkHTML)}}, nil
+	case relativeLinks:
+		return &http.Response{Body: nopCloser{bytes.NewBufferString(relativeLinksHTML)}, Request: redirectedRequest()}, nil
+	case baseLinks:
+		return &http.Response{Body: nopCloser{bytes.NewBufferString(baseLinksHTML)}, Request: redirectedRequest()}, nil
+	case titleOnly:
+		return &http.Response{Body: nopCloser{bytes.NewBufferString(titleHTML)}}, nil
+	case anchors:
+		return &http.Response{Body: nopCloser{bytes.NewBufferString(anchorsHTML)}, Request: redirectedRequest()}, nil
+	case resourceLinks:
+		return &http.Response{Body: nopCloser{bytes.NewBufferString(resourcesHTML)}, Request: redirectedRequest()}, nil
+	case pdfDocument:
+		return &http.Response{Body: nopCloser{bytes.NewBufferString(threeLinksHTML)}, Header: http.Header{"Content-Type": []string{"application/pdf"}}}, nil
+	case brokenBody:
+		return &http.Response{Body: nopCloser{io.MultiReader(bytes.NewBufferString("<html><title>t"), errReader{})}}, nil
 	case errorClient:
 		return nil, errors.New(`couldn't fetch website`)
 	default:
@@ -90,33 +194,118 @@ func (c *MockClient) Get(url string) (*http.Response, error) {
 	}
 }
 
+// redirectedRequest mocks the final request of a redirected fetch
+func redirectedRequest() *http.Request {
+	u, _ := url.Parse("https://www.example.com/blog/post/")
+	return &http.Request{URL: u}
+}
+
 func TestDo(t *testing.T) {
 	assert := assert.New(t)
 
 	tt := []struct {
-		name          string
-		state         mockStateClient
+		name  string
+		state mockStateClient
+		// Links to other pages, the ones followed by the crawl
 		expectedLinks []string
-		expectedError error
+		// Every link with its anchor text, rel, element and attribute, only checked when set
+		expectedAnchors []data.Link
+		expectedTitle   string
+		expectedError   error
 	}{
 		{
 			name:          "Success - Collect three links",
 			state:         success,
 			expectedLinks: []string{`https://www.linkedsite1.com`, `https://www.linkedsite2.com`, `https://www.linkedsite3.com`},
+			expectedTitle: "title",
 			expectedError: nil,
 		},
 		{
 			name:          "Success - Link non parseable ommited",
 			state:         nonParseableLink,
 			expectedLinks: []string{},
+			expectedTitle: "title",
 			expectedError: nil,
 		},
 		{
 			name:          "Success - Hash link sanitised",
 			state:         sanitiseFragment,
 			expectedLinks: []string{`https://www.linkedsite1.com`},
+			expectedTitle: "title",
 			expectedError: nil,
 		},
+		{
+			name:          "Success - Relative links resolved against final URL",
+			state:         relativeLinks,
+			expectedLinks: []string{`https://www.example.com/about`, `https://www.example.com/blog/docs`, `https://www.example.com/blog/post/page2.html`, `https://cdn.example.com/x`},
+			expectedTitle: "title",
+			expectedError: nil,
+		},
+		{
+			name:          "Success - Base href honoured",
+			state:         baseLinks,
+			expectedLinks: []string{`https://static.example.com/assets/page2.html`, `https://static.example.com/root`},
+			expectedTitle: "title",
+			expectedError: nil,
+		},
+		{
+			name:          "Success - First title unescaped and trimmed",
+			state:         titleOnly,
+			expectedLinks: []string{},
+			expectedTitle: "Go & the Web",
+			expectedError: nil,
+		},
+		{
+			name:          "Success - Anchor text and rel",
+			state:         anchors,
+			expectedLinks: []string{`https://www.example.com/about`, `https://www.example.com/empty`, `https://www.example.com/unclosed`, `https://www.example.com/next`},
+			expectedAnchors: []data.Link{
+				{URL: `https://www.example.com/about`, Text: `About us`, Rel: `nofollow external`, Element: "a", Attr: "href"},
+				{URL: `https://www.example.com/empty`, Element: "a", Attr: "href"},
+				{URL: `https://www.example.com/blog/post/logo.png`, Element: "img", Attr: "src"},
+				{URL: `https://www.example.com/unclosed`, Text: `Unclosed`, Element: "a", Attr: "href"},
+				{URL: `https://www.example.com/next`, Text: `Next`, Element: "a", Attr: "href"},
+			},
+			expectedTitle: "",
+			expectedError: nil,
+		},
+		{
+			name:          "Success - Resources recorded with their element and attribute",
+			state:         resourceLinks,
+			expectedLinks: []string{`https://www.example.com/region`},
+			expectedAnchors: []data.Link{
+				{URL: `https://www.example.com/style.css`, Rel: "stylesheet", Element: "link", Attr: "href"},
+				{URL: `https://www.example.com/blog/post/app.js`, Element: "script", Attr: "src"},
+				{URL: `https://www.example.com/blog/post/logo.png`, Text: "Logo", Element: "img", Attr: "src"},
+				{URL: `https://www.example.com/blog/post/logo-2x.png`, Text: "Logo", Element: "img", Attr: "srcset"},
+				{URL: `https://www.example.com/blog/post/logo-4x.png`, Text: "Logo", Element: "img", Attr: "srcset"},
+				{URL: `https://cdn.example.com/logo(1).png`, Text: "Logo", Element: "img", Attr: "srcset"},
+				{URL: `https://www.example.com/region`, Text: "Region", Element: "area", Attr: "href"},
+				{URL: `https://video.example.com/embed/1`, Element: "iframe", Attr: "src"},
+				{URL: `https://www.example.com/search`, Element: "form", Attr: "action"},
+				{URL: `https://www.example.com/blog/post/clip.mp4`, Element: "video", Attr: "src"},
+				{URL: `https://www.example.com/blog/post/clip.webm`, Element: "source", Attr: "src"},
+				{URL: `https://www.example.com/blog/post/sound.ogg`, Element: "source", Attr: "src"},
+				{URL: `https://www.example.com/blog/post/wide.webp`, Element: "source", Attr: "srcset"},
+				{URL: `https://www.example.com/blog/post/narrow.webp`, Element: "source", Attr: "srcset"},
+				{URL: `https://www.example.com/blog/post/doc.pdf`, Element: "object", Attr: "data"},
+			},
+			expectedTitle: "",
+			expectedError: nil,
+		},
+		{
+			name:          "Success - Non HTML document not parsed",
+			state:         pdfDocument,
+			expectedLinks: []string{},
+			expectedTitle: "",
+			expectedError: nil,
+		},
+		{
+			name:          "Error - body read failed",
+			state:         brokenBody,
+			expectedLinks: []string{},
+			expectedError: errors.New(`connection reset`),
+		},
 		{
 			name:          "Error - client fetch failed",
 			state:         errorClient,
@@ -130,32 +319,353 @@ func TestDo(t *testing.T) {
 			m := MockClient{State: tc.state}
 			c := links.NewCollector(&m)
 
-			chLinks := make(chan string)
-			chErrors := make(chan error)
-			chFinished := make(chan bool)
-
-			go c.Collect(`www.google.com`, chLinks, chFinished, chErrors)
-
 			links := make([]string, 0)
-			var err error
-		loop:
-			for {
-				select {
-				case link := <-chLinks:
-					links = append(links, link)
-				case <-chFinished:
-					break loop
-				case err = <-chErrors:
-					break loop
+			title := ""
+			page, err := c.Collect(context.Background(), `www.google.com`)
+			if err == nil {
+				for _, l := range page.Links {
+					if l.Navigational() {
+						links = append(links, l.URL)
+					}
 				}
+				title = page.Title
 			}
 
-			close(chLinks)
-			close(chErrors)
-			close(chFinished)
-
 			assert.Equal(tc.expectedLinks, links, tc.name)
+			if tc.expectedAnchors != nil {
+				assert.Equal(tc.expectedAnchors, page.Links, tc.name)
+			}
+			assert.Equal(tc.expectedTitle, title, tc.name)
 			assert.Equal(tc.expectedError, err, tc.name)
 		})
 	}
 }
+
+func TestCollectDetails(t *testing.T) {
+	assert := assert.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, threeLinksHTML)
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	tt := []struct {
+		name                  string
+		path                  string
+		expectedStatus        int
+		expectedURL           string
+		expectedContentType   string
+		expectedContentLength int64
+	}{
+		{
+			name:                  "Redirect followed, streamed length counted",
+			path:                  "/old",
+			expectedStatus:        http.StatusOK,
+			expectedURL:           s.URL + "/new",
+			expectedContentType:   "text/html; charset=utf-8",
+			expectedContentLength: int64(len(threeLinksHTML)),
+		},
+		{
+			name:                  "Not found",
+			path:                  "/missing",
+			expectedStatus:        http.StatusNotFound,
+			expectedURL:           s.URL + "/missing",
+			expectedContentType:   "text/plain; charset=utf-8",
+			expectedContentLength: int64(len("404 page not found\n")),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := links.NewCollector(s.Client())
+			page, err := c.Collect(context.Background(), s.URL+tc.path)
+
+			assert.NoError(err, tc.name)
+			assert.Equal(tc.expectedStatus, page.StatusCode, tc.name)
+			assert.Equal(tc.expectedURL, page.URL, tc.name)
+			assert.Equal(tc.expectedContentType, page.ContentType, tc.name)
+			assert.Equal(tc.expectedContentLength, page.ContentLength, tc.name)
+			assert.True(page.ResponseTime > 0, tc.name)
+		})
+	}
+}
+
+func TestCollectRedirects(t *testing.T) {
+	assert := assert.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/http", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/www", http.StatusFound)
+	})
+	mux.HandleFunc("/www", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/en/", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/en/", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, threeLinksHTML)
+	})
+	mux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/pong", http.StatusFound)
+	})
+	mux.HandleFunc("/pong", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ping", http.StatusFound)
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	chain := []data.Redirect{
+		{URL: s.URL + "/http", Status: http.StatusFound, Location: "/www"},
+		{URL: s.URL + "/www", Status: http.StatusMovedPermanently, Location: "/en/"},
+	}
+
+	tt := []struct {
+		name              string
+		path              string
+		maxRedirects      int
+		expectedErr       error
+		expectedStatus    int
+		expectedURL       string
+		expectedRedirects []data.Redirect
+		expectedLoop      bool
+		expectedLong      bool
+	}{
+		{
+			name:           "No redirect",
+			path:           "/en/",
+			maxRedirects:   1,
+			expectedStatus: http.StatusOK,
+			expectedURL:    s.URL + "/en/",
+		},
+		{
+			name:              "Chain recorded",
+			path:              "/http",
+			maxRedirects:      2,
+			expectedStatus:    http.StatusOK,
+			expectedURL:       s.URL + "/en/",
+			expectedRedirects: chain,
+		},
+		{
+			name:              "Chain longer than the limit",
+			path:              "/http",
+			maxRedirects:      1,
+			expectedStatus:    http.StatusOK,
+			expectedURL:       s.URL + "/en/",
+			expectedRedirects: chain,
+			expectedLong:      true,
+		},
+		{
+			name:           "Loop stopped",
+			path:           "/ping",
+			expectedErr:    links.ErrRedirectLoop,
+			expectedStatus: http.StatusFound,
+			expectedURL:    s.URL + "/pong",
+			expectedRedirects: []data.Redirect{
+				{URL: s.URL + "/ping", Status: http.StatusFound, Location: "/pong"},
+				{URL: s.URL + "/pong", Status: http.StatusFound, Location: "/ping"},
+			},
+			expectedLoop: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			client := s.Client()
+			client.CheckRedirect = links.CheckRedirect
+			c := links.NewCollector(client, links.WithMaxRedirects(tc.maxRedirects))
+			page, err := c.Collect(context.Background(), s.URL+tc.path)
+
+			if tc.expectedErr != nil {
+				assert.ErrorIs(err, tc.expectedErr, tc.name)
+			} else {
+				assert.NoError(err, tc.name)
+			}
+			assert.Equal(tc.expectedStatus, page.StatusCode, tc.name)
+			assert.Equal(tc.expectedURL, page.URL, tc.name)
+			assert.Equal(tc.expectedRedirects, page.Redirects, tc.name)
+			assert.Equal(tc.expectedLoop, page.RedirectLoop, tc.name)
+			assert.Equal(tc.expectedLong, page.LongRedirects, tc.name)
+		})
+	}
+}
+
+func TestCollectCanonical(t *testing.T) {
+	assert := assert.New(t)
+
+	story := `<html><head><title>Story</title><link rel="canonical" href="/story"><style>p { color: red }</style></head>
+<body><p>Once   upon a
+time</p><script>var ts = %d;</script></body></html>`
+	mux := http.NewServeMux()
+	mux.HandleFunc("/story", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, story, 1)
+	})
+	mux.HandleFunc("/card", func(w http.ResponseWriter, r *http.Request) {
+		// Same text, other whitespace and script
+		fmt.Fprintf(w, strings.ReplaceAll(story, "\n", " "), 2)
+	})
+	mux.HandleFunc("/header", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Link", `<https://cdn.example.com/style.css>; rel=preload; as=style`)
+		w.Header().Add("Link", `</Story#top>; rel="alternate canonical"`)
+		fmt.Fprintf(w, story, 3)
+	})
+	mux.HandleFunc("/pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", `<https://example.com/paper.html>; rel="canonical"`)
+		w.Header().Set("Content-Type", "application/pdf")
+	})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<html><head><title>App</title></head><body><script>render()</script></body></html>`)
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	// The visible text with its whitespace collapsed is hashed and fingerprinted
+	sum := sha256.Sum256([]byte("Once upon a time"))
+	hash := hex.EncodeToString(sum[:])
+	fp := simhash.Fingerprint([]string{"Once", "upon", "a", "time"})
+
+	tt := []struct {
+		name                string
+		path                string
+		expectedCanonical   string
+		expectedContentHash string
+		expectedSimHash     uint64
+	}{
+		{
+			name:                "Canonical link element",
+			path:                "/story",
+			expectedCanonical:   s.URL + "/story",
+			expectedContentHash: hash,
+			expectedSimHash:     fp,
+		},
+		{
+			name:                "Same text hashed the same",
+			path:                "/card",
+			expectedCanonical:   s.URL + "/story",
+			expectedContentHash: hash,
+			expectedSimHash:     fp,
+		},
+		{
+			name:                "Link header wins",
+			path:                "/header",
+			expectedCanonical:   s.URL + "/Story",
+			expectedContentHash: hash,
+			expectedSimHash:     fp,
+		},
+		{
+			name:              "Link header of a document not parsed",
+			path:              "/pdf",
+			expectedCanonical: "https://example.com/paper.html",
+		},
+		{
+			name: "No text, no hash",
+			path: "/empty",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := links.NewCollector(s.Client())
+			page, err := c.Collect(context.Background(), s.URL+tc.path)
+
+			assert.NoError(err, tc.name)
+			assert.Equal(tc.expectedCanonical, page.Canonical, tc.name)
+			assert.Equal(tc.expectedContentHash, page.ContentHash, tc.name)
+			assert.Equal(tc.expectedSimHash, page.SimHash, tc.name)
+		})
+	}
+}
+
+func TestCollectCache(t *testing.T) {
+	assert := assert.New(t)
+
+	const lastModified = "Mon, 05 Oct 2026 10:00:00 GMT"
+	version := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/etag", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		io.WriteString(w, threeLinksHTML)
+	})
+	mux.HandleFunc("/modified", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Last-Modified", lastModified)
+		io.WriteString(w, threeLinksHTML)
+	})
+	mux.HandleFunc("/same", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, threeLinksHTML)
+	})
+	mux.HandleFunc("/changing", func(w http.ResponseWriter, r *http.Request) {
+		version++
+		fmt.Fprintf(w, "<html><title>Version %d</title></html>", version)
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	tt := []struct {
+		name              string
+		path              string
+		expectedStatus    int
+		expectedUnchanged bool
+	}{
+		{
+			name:              "Not modified since ETag",
+			path:              "/etag",
+			expectedStatus:    http.StatusNotModified,
+			expectedUnchanged: true,
+		},
+		{
+			name:              "Not modified since Last-Modified",
+			path:              "/modified",
+			expectedStatus:    http.StatusNotModified,
+			expectedUnchanged: true,
+		},
+		{
+			name:              "Same body without validators",
+			path:              "/same",
+			expectedStatus:    http.StatusOK,
+			expectedUnchanged: true,
+		},
+		{
+			name:              "Changed body",
+			path:              "/changing",
+			expectedStatus:    http.StatusOK,
+			expectedUnchanged: false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			pages, err := cache.NewCache()
+			assert.NoError(err)
+			c := links.NewCollector(s.Client(), links.WithCache(pages))
+
+			first, err := c.Collect(context.Background(), s.URL+tc.path)
+			assert.NoError(err, tc.name)
+			assert.False(first.Unchanged, tc.name)
+
+			second, err := c.Collect(context.Background(), s.URL+tc.path)
+			assert.NoError(err, tc.name)
+			assert.Equal(tc.expectedStatus, second.StatusCode, tc.name)
+			assert.Equal(tc.expectedUnchanged, second.Unchanged, tc.name)
+			if tc.expectedUnchanged {
+				assert.Equal(first.Title, second.Title, tc.name)
+				assert.Equal(first.Links, second.Links, tc.name)
+				assert.Equal(first.ContentType, second.ContentType, tc.name)
+			}
+		})
+	}
+}
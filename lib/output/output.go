@@ -0,0 +1,106 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/export"
+	"github.com/smashed-avo/go-crawler/lib/sitemap"
+)
+
+// Formats of a crawl result, the graph export formats are also accepted
+const (
+	FormatJSON    = "json"
+	FormatNDJSON  = "ndjson"
+	FormatSSE     = "sse"
+	FormatSitemap = "sitemap"
+)
+
+// Shapes of a crawl result
+const (
+	ShapeTree  = "tree"
+	ShapeGraph = "graph"
+)
+
+// Supported reports whether a format is known, json when empty
+func Supported(format string) bool {
+	switch format {
+	case "", FormatJSON, FormatNDJSON, FormatSSE, FormatSitemap:
+		return true
+	}
+	return export.Supported(format)
+}
+
+// Streamed reports whether a format streams the sites as they are crawled
+func Streamed(format string) bool {
+	return format == FormatNDJSON || format == FormatSSE
+}
+
+// ParseShape validates the shape of a crawl result, a tree of sites by default
+func ParseShape(s string) (string, error) {
+	switch s {
+	case "", ShapeTree:
+		return ShapeTree, nil
+	case ShapeGraph:
+		return ShapeGraph, nil
+	default:
+		return "", fmt.Errorf("invalid shape: %q", s)
+	}
+}
+
+// Output is a finished crawl encoded in a format
+type Output struct {
+	// ContentType is the media type of the encoded result
+	ContentType string
+	// Filename is set when the result is an archive rather than a document
+	Filename string
+	write    func(w io.Writer) error
+}
+
+// New encodes a finished crawl in a shape and a format, exports use the graph and a split sitemap is zipped
+func New(res *data.Response, format, shape string) (*Output, error) {
+	switch {
+	case Streamed(format):
+		return nil, fmt.Errorf("format %s is streamed", format)
+	case format == FormatSitemap:
+		files, err := sitemap.NewBuilder().Build(res)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 1 {
+			return &Output{ContentType: "application/xml; charset=utf-8", write: func(w io.Writer) error {
+				_, err := w.Write(files[0].Body)
+				return err
+			}}, nil
+		}
+		return &Output{ContentType: "application/zip", Filename: "sitemap.zip", write: func(w io.Writer) error {
+			return sitemap.WriteZip(w, files)
+		}}, nil
+	case export.Supported(format):
+		return &Output{ContentType: export.ContentType(format), write: func(w io.Writer) error {
+			return export.Write(w, format, res.Graph())
+		}}, nil
+	case format != "" && format != FormatJSON:
+		return nil, fmt.Errorf("invalid format: %q", format)
+	case res.LinkCheck != nil && shape != ShapeGraph:
+		// The report of a linkcheck crawl replaces its tree
+		return &Output{ContentType: "application/json", write: func(w io.Writer) error {
+			return json.NewEncoder(w).Encode(res.LinkCheck)
+		}}, nil
+	case shape == ShapeGraph:
+		return &Output{ContentType: "application/json", write: func(w io.Writer) error {
+			return json.NewEncoder(w).Encode(res.Graph())
+		}}, nil
+	default:
+		return &Output{ContentType: "application/json", write: func(w io.Writer) error {
+			return json.NewEncoder(w).Encode(res)
+		}}, nil
+	}
+}
+
+// Write writes the encoded result
+func (o *Output) Write(w io.Writer) error {
+	return o.write(w)
+}
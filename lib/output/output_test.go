@@ -0,0 +1,137 @@
+package output_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/export"
+	"github.com/smashed-avo/go-crawler/lib/output"
+)
+
+var res = &data.Response{
+	URL:         "https://www.successweb.com",
+	Title:       "Success Web",
+	Status:      200,
+	ContentType: "text/html",
+	Nodes: []*data.Response{
+		{Depth: 1, URL: "https://www.successweb.com/about", Title: "About", Status: 200, ContentType: "text/html"},
+	},
+}
+
+func TestNew(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name                string
+		format              string
+		shape               string
+		expectedContentType string
+		expectedFilename    string
+		expectedContains    string
+		expectedError       bool
+	}{
+		{
+			name:                "JSON tree",
+			format:              output.FormatJSON,
+			shape:               output.ShapeTree,
+			expectedContentType: "application/json",
+			expectedContains:    `"nodes":[{"depth":1`,
+		},
+		{
+			name:                "JSON graph",
+			shape:               output.ShapeGraph,
+			expectedContentType: "application/json",
+			expectedContains:    `"edges":[{"source":"https://www.successweb.com","target":"https://www.successweb.com/about"`,
+		},
+		{
+			name:                "DOT",
+			format:              export.FormatDOT,
+			expectedContentType: export.ContentType(export.FormatDOT),
+			expectedContains:    `"https://www.successweb.com" -> "https://www.successweb.com/about";`,
+		},
+		{
+			name:                "Sitemap",
+			format:              output.FormatSitemap,
+			expectedContentType: "application/xml; charset=utf-8",
+			expectedContains:    "<url><loc>https://www.successweb.com/about</loc></url>",
+		},
+		{
+			name:          "Streamed format",
+			format:        output.FormatNDJSON,
+			expectedError: true,
+		},
+		{
+			name:          "Unknown format",
+			format:        "svg",
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			o, err := output.New(res, tc.format, tc.shape)
+
+			assert.Equal(tc.expectedError, err != nil, tc.name)
+			if err != nil {
+				return
+			}
+			var b bytes.Buffer
+			assert.NoError(o.Write(&b), tc.name)
+			assert.Equal(tc.expectedContentType, o.ContentType, tc.name)
+			assert.Equal(tc.expectedFilename, o.Filename, tc.name)
+			assert.Contains(b.String(), tc.expectedContains, tc.name)
+		})
+	}
+}
+
+func TestStream(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name                string
+		format              string
+		expectedContentType string
+		expectedPrefix      string
+	}{
+		{
+			name:                "NDJSON",
+			format:              output.FormatNDJSON,
+			expectedContentType: "application/x-ndjson",
+			expectedPrefix:      `{"type":"node"`,
+		},
+		{
+			name:                "Server-Sent Events",
+			format:              output.FormatSSE,
+			expectedContentType: "text/event-stream",
+			expectedPrefix:      "event: node\ndata: ",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var b bytes.Buffer
+			s := output.NewStream(&b, tc.format)
+			s.Observe(data.Event{URL: res.URL, Status: 200})
+			s.Observe(data.Event{URL: res.Nodes[0].URL, Parent: res.URL, Depth: 1, Error: "Not Found"})
+			s.Finish(res)
+
+			assert.Equal(tc.expectedContentType, s.ContentType(), tc.name)
+			assert.True(strings.HasPrefix(b.String(), tc.expectedPrefix), tc.name)
+
+			// The summary is the last event
+			lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+			last := strings.TrimPrefix(lines[len(lines)-1], "data: ")
+			summary := make(map[string]interface{})
+			assert.NoError(json.Unmarshal([]byte(last), &summary), tc.name)
+			assert.Equal("summary", summary["type"], tc.name)
+			assert.Equal(float64(2), summary["nodes"], tc.name)
+			assert.Equal(float64(1), summary["fetched"], tc.name)
+			assert.Equal(float64(1), summary["errors"], tc.name)
+		})
+	}
+}
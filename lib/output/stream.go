@@ -0,0 +1,108 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+)
+
+// Types of the streamed events
+const (
+	eventNode    = "node"
+	eventSummary = "summary"
+)
+
+// nodeEvent is a streamed site of the crawl
+type nodeEvent struct {
+	Type string `json:"type"`
+	data.Event
+}
+
+// summaryEvent is streamed once the crawl is finished
+type summaryEvent struct {
+	Type      string   `json:"type"`
+	URL       string   `json:"url" description:"Seed URL of the crawl"`
+	Title     string   `json:"title" description:"Title of the seed site"`
+	Nodes     int      `json:"nodes" description:"Sites streamed"`
+	Fetched   int      `json:"fetched" description:"Sites fetched"`
+	Errors    int      `json:"errors" description:"Sites that failed to be fetched"`
+	Elapsed   int64    `json:"elapsed_ms" description:"Duration of the crawl in milliseconds"`
+	Truncated bool     `json:"truncated,omitempty" description:"Crawl stopped before completion"`
+	Limits    []string `json:"limits,omitempty" description:"Limits that stopped the crawl from expanding"`
+
+	LinkCheck      *data.LinkReport         `json:"linkcheck,omitempty" description:"Broken links found by a linkcheck crawl"`
+	Duplicates     []*data.DuplicateCluster `json:"duplicates,omitempty" description:"Clusters of duplicate sites"`
+	NearDuplicates []*data.DuplicateCluster `json:"near_duplicates,omitempty" description:"Clusters of near duplicate sites"`
+}
+
+// flusher is implemented by writers buffering the stream, such as http.ResponseWriter
+type flusher interface {
+	Flush()
+}
+
+// Stream writes the sites of a crawl as they are observed, as Server-Sent Events or newline delimited JSON
+type Stream struct {
+	w       io.Writer
+	sse     bool
+	start   time.Time
+	summary summaryEvent
+}
+
+// NewStream returns a pointer to a new stream of a crawl, Server-Sent Events for the sse format and newline
+// delimited JSON otherwise
+func NewStream(w io.Writer, format string) *Stream {
+	return &Stream{w: w, sse: format == FormatSSE, start: time.Now(), summary: summaryEvent{Type: eventSummary}}
+}
+
+// ContentType returns the media type of the stream
+func (s *Stream) ContentType() string {
+	if s.sse {
+		return "text/event-stream"
+	}
+	return "application/x-ndjson"
+}
+
+// Observe streams a site of the crawl
+func (s *Stream) Observe(e data.Event) {
+	s.summary.Nodes++
+	if e.Status > 0 {
+		s.summary.Fetched++
+	}
+	if e.Error != "" {
+		s.summary.Errors++
+	}
+	s.write(eventNode, nodeEvent{Type: eventNode, Event: e})
+}
+
+// Finish streams the summary of the crawl
+func (s *Stream) Finish(res *data.Response) {
+	s.summary.URL = res.URL
+	s.summary.Title = res.Title
+	s.summary.Elapsed = int64(time.Since(s.start) / time.Millisecond)
+	s.summary.Truncated = res.Truncated
+	s.summary.Limits = res.Limits
+	s.summary.LinkCheck = res.LinkCheck
+	s.summary.Duplicates = res.Duplicates
+	s.summary.NearDuplicates = res.NearDuplicates
+	s.write(eventSummary, s.summary)
+}
+
+// write sends an event and flushes it to the reader
+func (s *Stream) write(name string, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		println(err.Error())
+		return
+	}
+	if s.sse {
+		fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", name, b)
+	} else {
+		fmt.Fprintf(s.w, "%s\n", b)
+	}
+	if f, ok := s.w.(flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,289 @@
+package robots
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smashed-avo/go-crawler/lib/links"
+)
+
+// DefaultUserAgent is the product token the crawler identifies itself with
+const DefaultUserAgent = "go-crawler"
+
+// rule is a single Allow or Disallow line of a group
+type rule struct {
+	allow   bool
+	pattern string
+}
+
+// group holds the rules applying to the configured user-agent and the sitemaps listed by robots.txt
+type group struct {
+	rules    []rule
+	delay    time.Duration
+	sitemaps []string
+}
+
+var (
+	// allowAll is used when robots.txt does not exist
+	allowAll = &group{}
+	// disallowAll is used when robots.txt is unreachable
+	disallowAll = &group{rules: []rule{{allow: false, pattern: "/"}}}
+)
+
+// entry is a cached robots.txt, ready is closed once it has been fetched
+type entry struct {
+	ready   chan struct{}
+	group   *group
+	dropped bool
+}
+
+// Robots fetches, caches and applies robots.txt rules for every scheme and host, Crawl-delay is
+// enforced by the scheduler
+type Robots struct {
+	sync.Mutex
+	client    links.WebClient
+	userAgent string
+	cache     map[string]*entry
+}
+
+// NewRobots returns a pointer to a new robots.txt checker for the given user-agent
+func NewRobots(client links.WebClient, userAgent string) *Robots {
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	return &Robots{
+		client:    client,
+		userAgent: userAgent,
+		cache:     make(map[string]*entry),
+	}
+}
+
+// Allowed reports whether robots.txt lets the user-agent fetch the given URL, the error of the context is
+// returned when it is done before robots.txt is fetched
+func (r *Robots) Allowed(ctx context.Context, rawURL string) (bool, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false, nil
+	}
+	g, err := r.rules(ctx, u)
+	if err != nil {
+		return false, err
+	}
+	return g.allowed(u.RequestURI()), nil
+}
+
+// CrawlDelay returns the Crawl-delay robots.txt sets for the host of the given URL
+func (r *Robots) CrawlDelay(ctx context.Context, rawURL string) time.Duration {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0
+	}
+	g, err := r.rules(ctx, u)
+	if err != nil {
+		return 0
+	}
+	return g.delay
+}
+
+// Sitemaps returns the sitemap URLs robots.txt lists for the host of the given URL
+func (r *Robots) Sitemaps(ctx context.Context, rawURL string) []string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	g, err := r.rules(ctx, u)
+	if err != nil {
+		return nil
+	}
+	return g.sitemaps
+}
+
+// rules returns the cached group of a scheme and host, fetching robots.txt once. The error of the context is
+// returned when it is done first, an unreachable robots.txt is not an error and disallows everything
+func (r *Robots) rules(ctx context.Context, u *url.URL) (*group, error) {
+	key := u.Scheme + "://" + u.Host
+	for {
+		r.Lock()
+		e, ok := r.cache[key]
+		if !ok {
+			e = &entry{ready: make(chan struct{})}
+			r.cache[key] = e
+		}
+		r.Unlock()
+
+		if !ok {
+			e.group = r.fetch(ctx, key)
+			// A cancelled fetch is not cached so other crawls try again
+			if ctx.Err() != nil {
+				r.Lock()
+				delete(r.cache, key)
+				r.Unlock()
+				e.dropped = true
+			}
+			close(e.ready)
+		}
+
+		select {
+		case <-e.ready:
+			if !e.dropped {
+				return e.group, nil
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// fetch downloads and parses robots.txt for a scheme and host
+func (r *Robots) fetch(ctx context.Context, origin string) *group {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err != nil {
+		return disallowAll
+	}
+	req.Header.Set("User-Agent", r.userAgent)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return disallowAll
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return parse(resp.Body, r.userAgent)
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		// No robots.txt means no restrictions
+		return allowAll
+	default:
+		// Server errors mean the site cannot tell what is allowed
+		return disallowAll
+	}
+}
+
+// parse reads the robots.txt groups and keeps the most specific one for the user-agent
+func parse(body io.Reader, userAgent string) *group {
+	ua := strings.ToLower(userAgent)
+	groups := make(map[string]*group)
+	agents := make([]string, 0)
+	sitemaps := make([]string, 0)
+	inRules := false
+
+	s := bufio.NewScanner(body)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		val := strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "user-agent":
+			// Consecutive user-agent lines share the same rules
+			if inRules {
+				agents = agents[:0]
+				inRules = false
+			}
+			agent := strings.ToLower(val)
+			agents = append(agents, agent)
+			if groups[agent] == nil {
+				groups[agent] = &group{}
+			}
+		case "allow", "disallow":
+			inRules = true
+			// An empty Disallow allows everything
+			if val == "" {
+				continue
+			}
+			for _, agent := range agents {
+				groups[agent].rules = append(groups[agent].rules, rule{allow: key == "allow", pattern: val})
+			}
+		case "crawl-delay":
+			inRules = true
+			secs, err := strconv.ParseFloat(val, 64)
+			if err != nil || secs < 0 {
+				continue
+			}
+			for _, agent := range agents {
+				groups[agent].delay = time.Duration(secs * float64(time.Second))
+			}
+		case "sitemap":
+			// Sitemaps do not belong to a group
+			if val != "" {
+				sitemaps = append(sitemaps, val)
+			}
+		}
+	}
+
+	// The longest user-agent matching ours wins, * is the fallback
+	best, bestAgent := allowAll, ""
+	for agent, g := range groups {
+		if agent == "*" {
+			if bestAgent == "" {
+				best = g
+			}
+			continue
+		}
+		if strings.Contains(ua, agent) && len(agent) > len(bestAgent) {
+			best, bestAgent = g, agent
+		}
+	}
+	res := *best
+	res.sitemaps = sitemaps
+	return &res
+}
+
+// allowed applies the longest matching rule to a path, Allow wins ties
+func (g *group) allowed(path string) bool {
+	allow, length := true, -1
+	for _, r := range g.rules {
+		if !match(r.pattern, path) {
+			continue
+		}
+		if len(r.pattern) > length || (len(r.pattern) == length && r.allow) {
+			allow, length = r.allow, len(r.pattern)
+		}
+	}
+	return allow
+}
+
+// match reports whether a robots.txt pattern with * wildcards and a $ end anchor matches a path
+func match(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = strings.TrimSuffix(pattern, "$")
+	}
+	parts := strings.Split(pattern, "*")
+
+	// The first part is a prefix of the path
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i, part := range parts[1:] {
+		last := i == len(parts)-2
+		if last && anchored {
+			// The last part has to end the path
+			return len(path)-len(part) >= pos && strings.HasSuffix(path, part)
+		}
+		j := strings.Index(path[pos:], part)
+		if j < 0 {
+			return false
+		}
+		pos += j + len(part)
+	}
+	return !anchored || pos == len(path)
+}
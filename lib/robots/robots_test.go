@@ -0,0 +1,273 @@
+package robots_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smashed-avo/go-crawler/lib/robots"
+)
+
+const robotsTxt = `# Example robots.txt
+User-agent: *
+Disallow: /private/
+Allow: /private/public.html
+Disallow: /*.pdf$
+Disallow: /search*q=
+Crawl-delay: 0.05
+
+User-agent: go-crawler
+User-agent: other-bot
+Disallow: /no-crawler/
+Allow: /no-crawler/yes$
+
+User-agent: go-crawler-images
+Disallow: /
+
+Sitemap: https://www.example.com/sitemap.xml
+sitemap: https://www.example.com/news/sitemap.xml.gz
+`
+
+// newServer serves robots.txt with the given status and counts its fetches
+func newServer(status int, body string, fetches *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			atomic.AddInt32(fetches, 1)
+			w.WriteHeader(status)
+			fmt.Fprint(w, body)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestAllowed(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name            string
+		status          int
+		body            string
+		userAgent       string
+		path            string
+		expectedAllowed bool
+	}{
+		{
+			name:            "Allowed - no matching rule",
+			status:          http.StatusOK,
+			body:            robotsTxt,
+			userAgent:       "some-bot",
+			path:            "/blog/post",
+			expectedAllowed: true,
+		},
+		{
+			name:            "Disallowed - prefix rule for *",
+			status:          http.StatusOK,
+			body:            robotsTxt,
+			userAgent:       "some-bot",
+			path:            "/private/secret.html",
+			expectedAllowed: false,
+		},
+		{
+			name:            "Allowed - longer allow rule wins",
+			status:          http.StatusOK,
+			body:            robotsTxt,
+			userAgent:       "some-bot",
+			path:            "/private/public.html",
+			expectedAllowed: true,
+		},
+		{
+			name:            "Disallowed - wildcard with end anchor",
+			status:          http.StatusOK,
+			body:            robotsTxt,
+			userAgent:       "some-bot",
+			path:            "/files/report.pdf",
+			expectedAllowed: false,
+		},
+		{
+			name:            "Allowed - end anchor not matching",
+			status:          http.StatusOK,
+			body:            robotsTxt,
+			userAgent:       "some-bot",
+			path:            "/files/report.pdf?download=1",
+			expectedAllowed: true,
+		},
+		{
+			name:            "Disallowed - wildcard matching query",
+			status:          http.StatusOK,
+			body:            robotsTxt,
+			userAgent:       "some-bot",
+			path:            "/search?lang=en&q=go",
+			expectedAllowed: false,
+		},
+		{
+			name:            "Allowed - specific group replaces *",
+			status:          http.StatusOK,
+			body:            robotsTxt,
+			userAgent:       "go-crawler/1.0",
+			path:            "/private/secret.html",
+			expectedAllowed: true,
+		},
+		{
+			name:            "Disallowed - specific group rule",
+			status:          http.StatusOK,
+			body:            robotsTxt,
+			userAgent:       "go-crawler/1.0",
+			path:            "/no-crawler/page",
+			expectedAllowed: false,
+		},
+		{
+			name:            "Allowed - specific group allow anchored",
+			status:          http.StatusOK,
+			body:            robotsTxt,
+			userAgent:       "Go-Crawler",
+			path:            "/no-crawler/yes",
+			expectedAllowed: true,
+		},
+		{
+			name:            "Disallowed - longest user-agent wins",
+			status:          http.StatusOK,
+			body:            robotsTxt,
+			userAgent:       "go-crawler-images",
+			path:            "/blog/post",
+			expectedAllowed: false,
+		},
+		{
+			name:            "Allowed - robots.txt not found",
+			status:          http.StatusNotFound,
+			body:            "",
+			userAgent:       "go-crawler",
+			path:            "/private/secret.html",
+			expectedAllowed: true,
+		},
+		{
+			name:            "Disallowed - robots.txt unreachable",
+			status:          http.StatusServiceUnavailable,
+			body:            "",
+			userAgent:       "go-crawler",
+			path:            "/blog/post",
+			expectedAllowed: false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var fetches int32
+			s := newServer(tc.status, tc.body, &fetches)
+			defer s.Close()
+
+			r := robots.NewRobots(s.Client(), tc.userAgent)
+
+			allowed, err := r.Allowed(context.Background(), s.URL+tc.path)
+			assert.NoError(err, tc.name)
+			assert.Equal(tc.expectedAllowed, allowed, tc.name)
+			// robots.txt is fetched once per host
+			r.Allowed(context.Background(), s.URL+tc.path)
+			assert.Equal(int32(1), atomic.LoadInt32(&fetches), tc.name)
+		})
+	}
+}
+
+func TestAllowedCancelled(t *testing.T) {
+	assert := assert.New(t)
+
+	var fetches int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		// A slow robots.txt
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer s.Close()
+
+	r := robots.NewRobots(s.Client(), "go-crawler")
+
+	// A crawl stopped while robots.txt is fetched gets the error of its context, not a disallowed site
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	allowed, err := r.Allowed(ctx, s.URL+"/")
+	assert.Equal(context.DeadlineExceeded, err)
+	assert.False(allowed)
+
+	// The cancelled fetch is not cached
+	allowed, err = r.Allowed(context.Background(), s.URL+"/")
+	assert.NoError(err)
+	assert.True(allowed)
+	assert.Equal(int32(2), atomic.LoadInt32(&fetches))
+}
+
+func TestCrawlDelay(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name          string
+		userAgent     string
+		expectedDelay time.Duration
+	}{
+		{
+			name:          "Crawl-delay of * group",
+			userAgent:     "some-bot",
+			expectedDelay: 50 * time.Millisecond,
+		},
+		{
+			name:          "No Crawl-delay in specific group",
+			userAgent:     "go-crawler",
+			expectedDelay: 0,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var fetches int32
+			s := newServer(http.StatusOK, robotsTxt, &fetches)
+			defer s.Close()
+
+			r := robots.NewRobots(s.Client(), tc.userAgent)
+			assert.Equal(tc.expectedDelay, r.CrawlDelay(context.Background(), s.URL+"/"), tc.name)
+		})
+	}
+}
+
+func TestSitemaps(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name             string
+		status           int
+		body             string
+		expectedSitemaps []string
+	}{
+		{
+			name:             "Sitemaps of every group",
+			status:           http.StatusOK,
+			body:             robotsTxt,
+			expectedSitemaps: []string{"https://www.example.com/sitemap.xml", "https://www.example.com/news/sitemap.xml.gz"},
+		},
+		{
+			name:             "No robots.txt",
+			status:           http.StatusNotFound,
+			body:             "",
+			expectedSitemaps: nil,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var fetches int32
+			s := newServer(tc.status, tc.body, &fetches)
+			defer s.Close()
+
+			r := robots.NewRobots(s.Client(), "go-crawler")
+			assert.Equal(tc.expectedSitemaps, r.Sitemaps(context.Background(), s.URL+"/"), tc.name)
+		})
+	}
+}
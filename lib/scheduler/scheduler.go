@@ -0,0 +1,282 @@
+package scheduler
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/frontier"
+)
+
+// Limits model the politeness rules applied to every host, zero values disable a limit
+type Limits struct {
+	MaxConcurrent int
+	MinDelay      time.Duration
+	RPS           float64
+}
+
+// Delayer interface to a per host delay such as robots.txt Crawl-delay
+type Delayer interface {
+	CrawlDelay(ctx context.Context, url string) time.Duration
+}
+
+// host keeps the queue and politeness state of a single host
+type host struct {
+	queue     frontier.Frontier
+	running   int
+	last      time.Time
+	tokens    float64
+	refill    time.Time
+	delay     time.Duration
+	resolved  bool
+	resolving bool
+}
+
+// Scheduler hands out queued nodes to workers honouring per host limits, every host has its own queue
+// so a slow host does not block the rest
+type Scheduler struct {
+	sync.Mutex
+	limits      Limits
+	delayer     Delayer
+	newFrontier func() frontier.Frontier
+	hosts       map[string]*host
+	order       []string
+	next        int
+	strict      bool
+	wake        chan struct{}
+	closed      bool
+}
+
+// Option sets a setting of the scheduler
+type Option func(*Scheduler)
+
+// WithFrontier sets the queue created for every host, the order its nodes are handed out in. Nodes are
+// handed out first in first out when not set
+func WithFrontier(fn func() frontier.Frontier) Option {
+	return func(s *Scheduler) {
+		s.newFrontier = fn
+	}
+}
+
+// WithStrictOrder hands out the hosts in turn in the order they were first queued, waiting for the next host to
+// be ready rather than skipping to another one, so the order nodes are handed out in does not depend on the clock
+func WithStrictOrder() Option {
+	return func(s *Scheduler) {
+		s.strict = true
+	}
+}
+
+// NewScheduler returns a pointer to a new scheduler, the delayer is optional
+func NewScheduler(l Limits, d Delayer, opts ...Option) *Scheduler {
+	s := &Scheduler{
+		limits:  l,
+		delayer: d,
+		hosts:   make(map[string]*host),
+		wake:    make(chan struct{}),
+		newFrontier: func() frontier.Frontier {
+			return frontier.NewFIFO()
+		},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Push queues a node on the queue of its host
+func (s *Scheduler) Push(node *data.Response) {
+	s.Lock()
+	defer s.Unlock()
+	name := hostOf(node.URL)
+	h, ok := s.hosts[name]
+	if !ok {
+		h = &host{queue: s.newFrontier(), tokens: 1}
+		s.hosts[name] = h
+		s.order = append(s.order, name)
+	}
+	h.queue.Push(node)
+	s.notify()
+}
+
+// Rescore scores the queued nodes the links lead to again, on the queues of their hosts ranking them with a
+// scorer learning from links
+func (s *Scheduler) Rescore(links []data.Link) {
+	s.Lock()
+	defer s.Unlock()
+	for _, link := range links {
+		h, ok := s.hosts[hostOf(link.URL)]
+		if !ok {
+			continue
+		}
+		if r, ok := h.queue.(frontier.Rescorer); ok {
+			r.Rescore(link.URL)
+		}
+	}
+}
+
+// Next blocks until a queued node can be fetched, it returns false once the scheduler is closed or the context is done
+func (s *Scheduler) Next(ctx context.Context) (*data.Response, bool) {
+	for {
+		s.Lock()
+		if s.closed {
+			s.Unlock()
+			return nil, false
+		}
+
+		// Round robin over hosts so all of them make progress, a host that is not ready is skipped unless the
+		// order is strict
+		now := time.Now()
+		wait := time.Duration(-1)
+		for i := range s.order {
+			j := (s.next + i) % len(s.order)
+			name := s.order[j]
+			h := s.hosts[name]
+			if h.queue.Len() == 0 {
+				continue
+			}
+			d, ok := s.readyIn(h, now)
+			if !ok {
+				if s.strict {
+					break
+				}
+				continue
+			}
+			if d > 0 {
+				if wait < 0 || d < wait {
+					wait = d
+				}
+				if s.strict {
+					break
+				}
+				continue
+			}
+			node := s.take(h, now)
+			s.next = j + 1
+			resolve := !h.resolved && s.delayer != nil
+			h.resolved, h.resolving = true, resolve
+			s.Unlock()
+			if resolve {
+				// The host delay is resolved on its first fetch, outside the lock as it may do a request
+				delay := s.delayer.CrawlDelay(ctx, node.URL)
+				s.Lock()
+				h.delay, h.resolving = delay, false
+				s.notify()
+				s.Unlock()
+			}
+			return node, true
+		}
+		wake := s.wake
+		s.Unlock()
+
+		var timer *time.Timer
+		var chTimer <-chan time.Time
+		if wait >= 0 {
+			timer = time.NewTimer(wait)
+			chTimer = timer.C
+		}
+		select {
+		case <-wake:
+		case <-chTimer:
+		case <-ctx.Done():
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return nil, false
+		}
+	}
+}
+
+// Done releases the host slot taken by a node once it has been fetched
+func (s *Scheduler) Done(node *data.Response) {
+	s.Lock()
+	defer s.Unlock()
+	if h, ok := s.hosts[hostOf(node.URL)]; ok && h.running > 0 {
+		h.running--
+	}
+	s.notify()
+}
+
+// Close discards the queued nodes and releases the waiting workers, it returns the number of nodes discarded
+func (s *Scheduler) Close() int {
+	s.Lock()
+	defer s.Unlock()
+	dropped := 0
+	for _, h := range s.hosts {
+		for h.queue.Len() > 0 {
+			h.queue.Pop()
+			dropped++
+		}
+	}
+	s.closed = true
+	s.notify()
+	return dropped
+}
+
+// readyIn returns how long until a host can be fetched, false when it has to wait for a slot
+func (s *Scheduler) readyIn(h *host, now time.Time) (time.Duration, bool) {
+	if h.resolving || (s.limits.MaxConcurrent > 0 && h.running >= s.limits.MaxConcurrent) {
+		return 0, false
+	}
+	var wait time.Duration
+	delay := s.limits.MinDelay
+	if h.delay > delay {
+		delay = h.delay
+	}
+	if delay > 0 && !h.last.IsZero() {
+		if d := h.last.Add(delay).Sub(now); d > wait {
+			wait = d
+		}
+	}
+	if s.limits.RPS > 0 {
+		tokens := s.tokens(h, now)
+		if tokens < 1 {
+			if d := time.Duration((1 - tokens) / s.limits.RPS * float64(time.Second)); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait, true
+}
+
+// tokens returns the token bucket level of a host, the bucket holds a single token
+func (s *Scheduler) tokens(h *host, now time.Time) float64 {
+	if h.refill.IsZero() {
+		return h.tokens
+	}
+	tokens := h.tokens + now.Sub(h.refill).Seconds()*s.limits.RPS
+	if tokens > 1 {
+		tokens = 1
+	}
+	return tokens
+}
+
+// take pops the next node of a host and books its slot
+func (s *Scheduler) take(h *host, now time.Time) *data.Response {
+	node := h.queue.Pop()
+	h.running++
+	h.last = now
+	if s.limits.RPS > 0 {
+		h.tokens = s.tokens(h, now) - 1
+		h.refill = now
+	}
+	return node
+}
+
+// notify wakes up every worker waiting in Next
+func (s *Scheduler) notify() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+// hostOf returns the host a URL is queued on
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
@@ -0,0 +1,197 @@
+package scheduler_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/frontier"
+	"github.com/smashed-avo/go-crawler/lib/scheduler"
+)
+
+var (
+	hostA1 = &data.Response{Depth: 1, URL: "https://a.successweb.com/1"}
+	hostA2 = &data.Response{Depth: 1, URL: "https://a.successweb.com/2"}
+	hostB1 = &data.Response{Depth: 1, URL: "https://b.successweb.com/1"}
+	hostB2 = &data.Response{Depth: 1, URL: "https://b.successweb.com/2"}
+)
+
+type MockDelayer struct {
+	Delay time.Duration
+	Calls int
+}
+
+func (d *MockDelayer) CrawlDelay(ctx context.Context, url string) time.Duration {
+	d.Calls++
+	return d.Delay
+}
+
+// MockHostDelayer delays the hosts of the URLs set, the other hosts have no delay
+type MockHostDelayer struct {
+	Delays map[string]time.Duration
+}
+
+func (d *MockHostDelayer) CrawlDelay(ctx context.Context, url string) time.Duration {
+	return d.Delays[url]
+}
+
+// next returns the next node or nil when none is ready within the timeout
+func next(s *scheduler.Scheduler, timeout time.Duration) *data.Response {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	node, _ := s.Next(ctx)
+	return node
+}
+
+func TestNextDelay(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name          string
+		limits        scheduler.Limits
+		delayer       *MockDelayer
+		expectedDelay time.Duration
+	}{
+		{
+			name:          "No limits",
+			limits:        scheduler.Limits{},
+			expectedDelay: 0,
+		},
+		{
+			name:          "Minimum delay between requests",
+			limits:        scheduler.Limits{MinDelay: 50 * time.Millisecond},
+			expectedDelay: 50 * time.Millisecond,
+		},
+		{
+			name:          "Token bucket in requests per second",
+			limits:        scheduler.Limits{RPS: 20},
+			expectedDelay: 50 * time.Millisecond,
+		},
+		{
+			name:          "Host delay longer than minimum delay",
+			limits:        scheduler.Limits{MinDelay: 10 * time.Millisecond},
+			delayer:       &MockDelayer{Delay: 50 * time.Millisecond},
+			expectedDelay: 50 * time.Millisecond,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var d scheduler.Delayer
+			if tc.delayer != nil {
+				d = tc.delayer
+			}
+			s := scheduler.NewScheduler(tc.limits, d)
+			defer s.Close()
+			s.Push(hostA1)
+			s.Push(hostA2)
+
+			start := time.Now()
+			assert.Equal(hostA1, next(s, time.Second), tc.name)
+			assert.Equal(hostA2, next(s, time.Second), tc.name)
+			assert.True(time.Since(start) >= tc.expectedDelay, tc.name)
+			if tc.delayer != nil {
+				assert.Equal(1, tc.delayer.Calls, tc.name)
+			}
+		})
+	}
+}
+
+func TestNextHostConcurrency(t *testing.T) {
+	assert := assert.New(t)
+
+	s := scheduler.NewScheduler(scheduler.Limits{MaxConcurrent: 1}, nil)
+	defer s.Close()
+	s.Push(hostA1)
+	s.Push(hostA2)
+	s.Push(hostB1)
+
+	// A busy host does not block the other hosts
+	assert.Equal(hostA1, next(s, time.Second))
+	assert.Equal(hostB1, next(s, time.Second))
+	assert.Nil(next(s, 20*time.Millisecond))
+
+	// The host slot is released once the node is done
+	s.Done(hostA1)
+	assert.Equal(hostA2, next(s, time.Second))
+}
+
+func TestNextStrictOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name          string
+		opts          []scheduler.Option
+		expectedOrder []*data.Response
+	}{
+		{
+			name:          "Hosts waiting for their delay are skipped",
+			expectedOrder: []*data.Response{hostA1, hostB1, hostB2, hostA2},
+		},
+		{
+			name:          "Strict order waits for the next host",
+			opts:          []scheduler.Option{scheduler.WithStrictOrder()},
+			expectedOrder: []*data.Response{hostA1, hostB1, hostA2, hostB2},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			// Host a is slower than host b, the nodes of b are ready before the second node of a
+			s := scheduler.NewScheduler(scheduler.Limits{}, &MockHostDelayer{Delays: map[string]time.Duration{hostA1.URL: 50 * time.Millisecond}}, tc.opts...)
+			defer s.Close()
+			s.Push(hostA1)
+			s.Push(hostA2)
+			s.Push(hostB1)
+			s.Push(hostB2)
+
+			order := make([]*data.Response, 0)
+			for range tc.expectedOrder {
+				node := next(s, time.Second)
+				s.Done(node)
+				order = append(order, node)
+			}
+			assert.Equal(tc.expectedOrder, order, tc.name)
+		})
+	}
+}
+
+func TestRescore(t *testing.T) {
+	assert := assert.New(t)
+
+	scorer := frontier.NewInLinks()
+	s := scheduler.NewScheduler(scheduler.Limits{}, nil, scheduler.WithFrontier(func() frontier.Frontier {
+		return frontier.NewPriority(scorer, 0)
+	}))
+	defer s.Close()
+	s.Push(hostA1)
+	s.Push(hostA2)
+
+	// A node linked after it was queued moves ahead
+	links := []data.Link{{URL: hostA2.URL}, {URL: hostB1.URL}}
+	scorer.Count(links)
+	s.Rescore(links)
+	assert.Equal(hostA2, next(s, time.Second))
+	assert.Equal(hostA1, next(s, time.Second))
+}
+
+func TestClose(t *testing.T) {
+	assert := assert.New(t)
+
+	s := scheduler.NewScheduler(scheduler.Limits{MaxConcurrent: 1}, nil)
+	s.Push(hostA1)
+	s.Push(hostA2)
+	assert.Equal(hostA1, next(s, time.Second))
+
+	chNode := make(chan *data.Response)
+	go func() {
+		chNode <- next(s, time.Second)
+	}()
+
+	// Waiting workers are released and the queued node discarded
+	assert.Equal(1, s.Close())
+	assert.Nil(<-chNode)
+}
@@ -0,0 +1,154 @@
+package scope
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Scope modes, which links of the seed URL are followed
+const (
+	// ModeAll follows every link
+	ModeAll = "all"
+	// ModeHost follows links to the seed host only
+	ModeHost = "host"
+	// ModeDomain follows links to the seed registrable domain and its subdomains
+	ModeDomain = "domain"
+	// ModePath follows links to the seed host under a path prefix
+	ModePath = "path"
+)
+
+// Scope decides which links belong to a crawl
+type Scope struct {
+	sync.RWMutex
+	mode    string
+	hosts   map[string]bool
+	domains map[string]bool
+	prefix  string
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// NewScope returns a pointer to a new scope for a seed URL. The path prefix defaults to the directory of the
+// seed path, include and exclude are regular expressions matched against the whole URL
+func NewScope(seed *url.URL, mode, prefix string, include, exclude []string) (*Scope, error) {
+	if mode == "" {
+		mode = ModeAll
+	}
+	s := &Scope{mode: mode, hosts: make(map[string]bool), domains: make(map[string]bool)}
+	s.add(seed)
+
+	switch mode {
+	case ModeAll, ModeHost, ModeDomain:
+	case ModePath:
+		if prefix == "" {
+			prefix = "/"
+			if i := strings.LastIndex(seed.EscapedPath(), "/"); i >= 0 {
+				prefix = seed.EscapedPath()[:i+1]
+			}
+		}
+		if !strings.HasPrefix(prefix, "/") {
+			prefix = "/" + prefix
+		}
+		s.prefix = prefix
+	default:
+		return nil, fmt.Errorf("unknown scope mode: %q", mode)
+	}
+
+	var err error
+	if s.include, err = compile(include); err != nil {
+		return nil, err
+	}
+	if s.exclude, err = compile(exclude); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Redirected adds the host the seed was redirected to, so the links of a seed moved to another host stay in scope
+func (s *Scope) Redirected(final *url.URL) {
+	s.Lock()
+	defer s.Unlock()
+	s.add(final)
+}
+
+// InScope reports whether a link is followed
+func (s *Scope) InScope(u *url.URL) bool {
+	s.RLock()
+	defer s.RUnlock()
+	switch s.mode {
+	case ModeHost:
+		if !s.hosts[strings.ToLower(u.Host)] {
+			return false
+		}
+	case ModeDomain:
+		if !s.domains[registrableDomain(u.Hostname())] {
+			return false
+		}
+	case ModePath:
+		if !s.hosts[strings.ToLower(u.Host)] || !underPrefix(u.EscapedPath(), s.prefix) {
+			return false
+		}
+	}
+
+	raw := u.String()
+	if len(s.include) > 0 && !matchAny(s.include, raw) {
+		return false
+	}
+	return !matchAny(s.exclude, raw)
+}
+
+// add registers the host and the registrable domain of a seed URL
+func (s *Scope) add(u *url.URL) {
+	s.hosts[strings.ToLower(u.Host)] = true
+	s.domains[registrableDomain(u.Hostname())] = true
+}
+
+// underPrefix reports whether a path is the prefix or below it, a prefix not ending in a slash only matches
+// whole path segments so /blog does not match /blogger
+func underPrefix(path, prefix string) bool {
+	if path == "" {
+		path = "/"
+	}
+	if strings.HasSuffix(prefix, "/") {
+		return strings.HasPrefix(path, prefix)
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// registrableDomain returns the public suffix plus one label, or the host itself for IPs and local names
+func registrableDomain(host string) string {
+	host = strings.ToLower(host)
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+// compile parses a list of regular expressions
+func compile(exprs []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// matchAny reports whether any of the regular expressions matches a string
+func matchAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,220 @@
+package scope_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smashed-avo/go-crawler/lib/scope"
+)
+
+func TestInScope(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name            string
+		seed            string
+		mode            string
+		prefix          string
+		include         []string
+		exclude         []string
+		link            string
+		expectedInScope bool
+	}{
+		{
+			name:            "All - other site followed",
+			seed:            "https://blog.successweb.com/posts/",
+			mode:            scope.ModeAll,
+			link:            "https://twitter.com/successweb",
+			expectedInScope: true,
+		},
+		{
+			name:            "Host - same host followed",
+			seed:            "https://blog.successweb.com/posts/",
+			mode:            scope.ModeHost,
+			link:            "https://BLOG.successweb.com/about",
+			expectedInScope: true,
+		},
+		{
+			name:            "Host - subdomain not followed",
+			seed:            "https://blog.successweb.com/posts/",
+			mode:            scope.ModeHost,
+			link:            "https://www.successweb.com/",
+			expectedInScope: false,
+		},
+		{
+			name:            "Domain - subdomain followed",
+			seed:            "https://blog.successweb.co.uk/posts/",
+			mode:            scope.ModeDomain,
+			link:            "https://shop.successweb.co.uk/",
+			expectedInScope: true,
+		},
+		{
+			name:            "Domain - sibling under public suffix not followed",
+			seed:            "https://blog.successweb.co.uk/posts/",
+			mode:            scope.ModeDomain,
+			link:            "https://otherweb.co.uk/",
+			expectedInScope: false,
+		},
+		{
+			name:            "Domain - private public suffix respected",
+			seed:            "https://alice.github.io/",
+			mode:            scope.ModeDomain,
+			link:            "https://bob.github.io/",
+			expectedInScope: false,
+		},
+		{
+			name:            "Path - default prefix from seed directory",
+			seed:            "https://www.successweb.com/docs/intro",
+			mode:            scope.ModePath,
+			link:            "https://www.successweb.com/docs/install",
+			expectedInScope: true,
+		},
+		{
+			name:            "Path - outside default prefix",
+			seed:            "https://www.successweb.com/docs/intro",
+			mode:            scope.ModePath,
+			link:            "https://www.successweb.com/docsearch",
+			expectedInScope: false,
+		},
+		{
+			name:            "Path - explicit prefix",
+			seed:            "https://www.successweb.com/",
+			mode:            scope.ModePath,
+			prefix:          "/blog/",
+			link:            "https://www.successweb.com/blog/post-1",
+			expectedInScope: true,
+		},
+		{
+			name:            "Path - other host with same path",
+			seed:            "https://www.successweb.com/",
+			mode:            scope.ModePath,
+			prefix:          "/blog/",
+			link:            "https://www.otherweb.com/blog/post-1",
+			expectedInScope: false,
+		},
+		{
+			name:            "Path - prefix without trailing slash matches itself",
+			seed:            "https://www.successweb.com/",
+			mode:            scope.ModePath,
+			prefix:          "/blog",
+			link:            "https://www.successweb.com/blog",
+			expectedInScope: true,
+		},
+		{
+			name:            "Path - prefix without trailing slash matches below it",
+			seed:            "https://www.successweb.com/",
+			mode:            scope.ModePath,
+			prefix:          "/blog",
+			link:            "https://www.successweb.com/blog/post-1",
+			expectedInScope: true,
+		},
+		{
+			name:            "Path - prefix without trailing slash does not match a longer segment",
+			seed:            "https://www.successweb.com/",
+			mode:            scope.ModePath,
+			prefix:          "/blog",
+			link:            "https://www.successweb.com/blogger",
+			expectedInScope: false,
+		},
+		{
+			name:            "Path - prefix without trailing slash does not match a sibling",
+			seed:            "https://www.successweb.com/",
+			mode:            scope.ModePath,
+			prefix:          "/blog",
+			link:            "https://www.successweb.com/blog-old/post-1",
+			expectedInScope: false,
+		},
+		{
+			name:            "Path - root prefix matches an empty path",
+			seed:            "https://www.successweb.com/",
+			mode:            scope.ModePath,
+			link:            "https://www.successweb.com",
+			expectedInScope: true,
+		},
+		{
+			name:            "Include - matching link followed",
+			seed:            "https://www.successweb.com/",
+			mode:            scope.ModeHost,
+			include:         []string{`/blog/`, `/docs/`},
+			link:            "https://www.successweb.com/docs/install",
+			expectedInScope: true,
+		},
+		{
+			name:            "Include - non matching link not followed",
+			seed:            "https://www.successweb.com/",
+			mode:            scope.ModeHost,
+			include:         []string{`/blog/`, `/docs/`},
+			link:            "https://www.successweb.com/shop/",
+			expectedInScope: false,
+		},
+		{
+			name:            "Exclude - matching link not followed",
+			seed:            "https://www.successweb.com/",
+			include:         []string{`successweb`},
+			exclude:         []string{`\?source=`},
+			link:            "https://www.successweb.com/post?source=footer",
+			expectedInScope: false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			seed, err := url.Parse(tc.seed)
+			assert.NoError(err)
+			link, err := url.Parse(tc.link)
+			assert.NoError(err)
+
+			s, err := scope.NewScope(seed, tc.mode, tc.prefix, tc.include, tc.exclude)
+			assert.NoError(err, tc.name)
+			assert.Equal(tc.expectedInScope, s.InScope(link), tc.name)
+		})
+	}
+}
+
+func TestRedirected(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name            string
+		mode            string
+		link            string
+		expectedInScope bool
+	}{
+		{name: "Host - final host followed", mode: scope.ModeHost, link: "https://www.successweb.com/about", expectedInScope: true},
+		{name: "Host - seed host still followed", mode: scope.ModeHost, link: "https://successweb.com/about", expectedInScope: true},
+		{name: "Host - other host not followed", mode: scope.ModeHost, link: "https://blog.successweb.com/", expectedInScope: false},
+		{name: "Path - final host followed", mode: scope.ModePath, link: "https://www.successweb.com/about", expectedInScope: true},
+		{name: "Domain - final domain followed", mode: scope.ModeDomain, link: "https://shop.successweb.net/", expectedInScope: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			seed, _ := url.Parse("https://successweb.com/")
+			s, err := scope.NewScope(seed, tc.mode, "", nil, nil)
+			assert.NoError(err, tc.name)
+
+			final, _ := url.Parse("https://www.successweb.com/")
+			if tc.mode == scope.ModeDomain {
+				final, _ = url.Parse("https://www.successweb.net/")
+			}
+			s.Redirected(final)
+
+			link, _ := url.Parse(tc.link)
+			assert.Equal(tc.expectedInScope, s.InScope(link), tc.name)
+		})
+	}
+}
+
+func TestNewScopeErrors(t *testing.T) {
+	assert := assert.New(t)
+	seed, _ := url.Parse("https://www.successweb.com/")
+
+	_, err := scope.NewScope(seed, "planet", "", nil, nil)
+	assert.Error(err)
+	_, err = scope.NewScope(seed, scope.ModeHost, "", []string{`(`}, nil)
+	assert.Error(err)
+	_, err = scope.NewScope(seed, scope.ModeHost, "", nil, []string{`[a-`})
+	assert.Error(err)
+}
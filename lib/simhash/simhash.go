@@ -0,0 +1,130 @@
+package simhash
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+)
+
+// Bits is the size of a fingerprint
+const Bits = 64
+
+// Fingerprint returns the SimHash of a text split in words, every word weighs as many times as it appears so
+// texts differing by a few words have fingerprints differing by a few bits. It is 0 when there is no word
+func Fingerprint(words []string) uint64 {
+	if len(words) == 0 {
+		return 0
+	}
+	var v [Bits]int
+	for _, w := range words {
+		h := hash(strings.ToLower(w))
+		for i := 0; i < Bits; i++ {
+			if h&(1<<uint(i)) != 0 {
+				v[i]++
+			} else {
+				v[i]--
+			}
+		}
+	}
+	var fp uint64
+	for i := 0; i < Bits; i++ {
+		if v[i] > 0 {
+			fp |= 1 << uint(i)
+		}
+	}
+	return fp
+}
+
+// hash returns the 64 bit FNV-1a hash of a word with its bits mixed, FNV alone leaves the high bits of short
+// words alike
+func hash(w string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(w))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// Distance returns the Hamming distance of two fingerprints, the number of bits they differ by
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Similarity returns the share of the bits of two fingerprints a distance apart that are equal
+func Similarity(distance int) float64 {
+	return 1 - float64(distance)/Bits
+}
+
+// block is a range of bits of a fingerprint
+type block struct {
+	shift uint
+	mask  uint64
+}
+
+// Index finds the fingerprint nearest to another one within a Hamming distance. Fingerprints are split in
+// distance+1 blocks, two fingerprints within the distance have at least one block in common so only the
+// fingerprints sharing a block are compared. It is not safe for concurrent use
+type Index struct {
+	distance int
+	blocks   []block
+	tables   []map[uint64][]int
+	keys     []string
+	prints   []uint64
+}
+
+// NewIndex returns a pointer to a new empty index of the fingerprints within a distance, between 0 and 63
+func NewIndex(distance int) *Index {
+	if distance < 0 {
+		distance = 0
+	}
+	if distance >= Bits {
+		distance = Bits - 1
+	}
+	n := distance + 1
+	i := &Index{distance: distance, blocks: make([]block, n), tables: make([]map[uint64][]int, n)}
+	shift := uint(0)
+	for b := 0; b < n; b++ {
+		// The first blocks take the bits left over
+		width := uint(Bits / n)
+		if b < Bits%n {
+			width++
+		}
+		i.blocks[b] = block{shift: shift, mask: 1<<width - 1}
+		i.tables[b] = make(map[uint64][]int)
+		shift += width
+	}
+	return i
+}
+
+// Add registers the fingerprint of a key
+func (i *Index) Add(key string, fp uint64) {
+	id := len(i.keys)
+	i.keys = append(i.keys, key)
+	i.prints = append(i.prints, fp)
+	for b, blk := range i.blocks {
+		k := fp >> blk.shift & blk.mask
+		i.tables[b][k] = append(i.tables[b][k], id)
+	}
+}
+
+// Nearest returns the key of the fingerprint nearest to fp within the distance of the index and their
+// distance, the first key added wins a tie
+func (i *Index) Nearest(fp uint64) (string, int, bool) {
+	best, dist := -1, i.distance+1
+	for b, blk := range i.blocks {
+		for _, id := range i.tables[b][fp>>blk.shift&blk.mask] {
+			d := Distance(fp, i.prints[id])
+			if d < dist || d == dist && id < best {
+				best, dist = id, d
+			}
+		}
+	}
+	if best < 0 {
+		return "", 0, false
+	}
+	return i.keys[best], dist, true
+}
@@ -0,0 +1,139 @@
+package simhash_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smashed-avo/go-crawler/lib/simhash"
+)
+
+const story = `Once upon a time a small crawler set out to map the web. It followed every link it found, page after page,
+and kept a list of the sites it had visited so it would never fetch the same page twice. Some pages were slow, some
+were broken and some redirected it far away, but the crawler kept going until its budget ran out and it wrote down
+everything it had learnt about the sites it met along the way`
+
+func TestFingerprint(t *testing.T) {
+	assert := assert.New(t)
+
+	page := simhash.Fingerprint(strings.Fields(story + " Updated 12:01"))
+
+	tt := []struct {
+		name        string
+		text        string
+		maxDistance int
+		minDistance int
+	}{
+		{
+			name:        "Same text",
+			text:        story + " Updated 12:01",
+			maxDistance: 0,
+		},
+		{
+			name:        "Case is ignored",
+			text:        strings.ToUpper(story) + " UPDATED 12:01",
+			maxDistance: 0,
+		},
+		{
+			name:        "Other timestamp",
+			text:        story + " Updated 12:02",
+			maxDistance: 4,
+		},
+		{
+			name:        "Ad block",
+			text:        story + " Updated 12:01 Advertisement: buy shoes now",
+			maxDistance: 4,
+		},
+		{
+			name:        "Other text",
+			text:        "The quick brown fox jumps over the lazy dog while the cat sleeps on the warm windowsill all afternoon",
+			maxDistance: simhash.Bits,
+			minDistance: 16,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			d := simhash.Distance(page, simhash.Fingerprint(strings.Fields(tc.text)))
+			assert.LessOrEqual(d, tc.maxDistance, tc.name)
+			assert.GreaterOrEqual(d, tc.minDistance, tc.name)
+		})
+	}
+
+	assert.Equal(uint64(0), simhash.Fingerprint(nil))
+	assert.Equal(0.75, simhash.Similarity(16))
+}
+
+func TestIndex(t *testing.T) {
+	assert := assert.New(t)
+
+	// Fingerprints are added in order to the same index of the fingerprints within 3 bits
+	index := simhash.NewIndex(3)
+
+	tt := []struct {
+		name             string
+		add              map[string]uint64
+		fp               uint64
+		expectedKey      string
+		expectedDistance int
+		expectedOK       bool
+	}{
+		{
+			name: "Empty index",
+			add:  map[string]uint64{"zero": 0},
+			fp:   0,
+		},
+		{
+			name:        "Same fingerprint",
+			fp:          0,
+			expectedKey: "zero", expectedOK: true,
+		},
+		{
+			name:        "Bits in one block",
+			fp:          0x7,
+			expectedKey: "zero", expectedDistance: 3, expectedOK: true,
+		},
+		{
+			name:        "Bits in every block",
+			fp:          1 | 1<<20 | 1<<40,
+			expectedKey: "zero", expectedDistance: 3, expectedOK: true,
+		},
+		{
+			name: "Too far",
+			add:  map[string]uint64{"f": 0xf},
+			fp:   0xf,
+		},
+		{
+			name: "Bits in every block too far",
+			fp:   1 | 1<<20 | 1<<40 | 1<<60,
+		},
+		{
+			name:        "Nearest wins",
+			fp:          0x7,
+			expectedKey: "f", expectedDistance: 1, expectedOK: true,
+		},
+		{
+			name:        "First added wins a tie",
+			fp:          0x3,
+			expectedKey: "zero", expectedDistance: 2, expectedOK: true,
+		},
+		{
+			name: "Too far from every fingerprint",
+			fp:   0xff,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			// Lookups happen before the fingerprints of the case are added
+			key, d, ok := index.Nearest(tc.fp)
+			for k, fp := range tc.add {
+				index.Add(k, fp)
+			}
+			assert.Equal(tc.expectedKey, key, tc.name)
+			assert.Equal(tc.expectedDistance, d, tc.name)
+			assert.Equal(tc.expectedOK, ok, tc.name)
+		})
+	}
+}
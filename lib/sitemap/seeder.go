@@ -0,0 +1,151 @@
+package sitemap
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/smashed-avo/go-crawler/lib/links"
+)
+
+const (
+	// DefaultMaxSeeds is the number of URLs taken from the sitemaps of a site
+	DefaultMaxSeeds = 10000
+	// maxSitemaps is the number of sitemap documents fetched for a site, indexes included
+	maxSitemaps = 50
+)
+
+// Sitemapper lists the sitemaps robots.txt declares for a site
+type Sitemapper interface {
+	Sitemaps(ctx context.Context, url string) []string
+}
+
+// document is a urlset or a sitemapindex, only the locations are read
+type document struct {
+	XMLName  xml.Name
+	URLs     []string `xml:"url>loc"`
+	Sitemaps []string `xml:"sitemap>loc"`
+}
+
+// Seeder finds the pages listed in the sitemaps of a site
+type Seeder struct {
+	client    links.WebClient
+	robots    Sitemapper
+	userAgent string
+	maxSeeds  int
+}
+
+// SeederOption sets a setting of the seeder
+type SeederOption func(*Seeder)
+
+// WithUserAgent sets the User-Agent header sent when fetching sitemaps
+func WithUserAgent(ua string) SeederOption {
+	return func(s *Seeder) {
+		s.userAgent = ua
+	}
+}
+
+// WithMaxSeeds sets the number of URLs taken from the sitemaps of a site
+func WithMaxSeeds(n int) SeederOption {
+	return func(s *Seeder) {
+		if n > 0 {
+			s.maxSeeds = n
+		}
+	}
+}
+
+// NewSeeder returns a pointer to a new seeder, sitemaps are found in robots.txt when robots is set
+func NewSeeder(client links.WebClient, robots Sitemapper, opts ...SeederOption) *Seeder {
+	s := &Seeder{client: client, robots: robots, maxSeeds: DefaultMaxSeeds}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Seeds returns the normalized URLs listed in the sitemaps of a site. Sitemaps are the ones declared in
+// robots.txt or /sitemap.xml, sitemap indexes are followed and gzip-compressed documents are accepted
+func (s *Seeder) Seeds(ctx context.Context, seedURL *url.URL) []string {
+	queue := make([]string, 0)
+	if s.robots != nil {
+		queue = append(queue, s.robots.Sitemaps(ctx, seedURL.String())...)
+	}
+	if len(queue) == 0 {
+		queue = append(queue, seedURL.Scheme+"://"+seedURL.Host+"/"+IndexName)
+	}
+
+	seeds := make([]string, 0)
+	seen := make(map[string]bool)
+	fetched := make(map[string]bool)
+	for i := 0; i < len(queue) && i < maxSitemaps && len(seeds) < s.maxSeeds; i++ {
+		if fetched[queue[i]] || ctx.Err() != nil {
+			continue
+		}
+		fetched[queue[i]] = true
+
+		doc, err := s.fetch(ctx, queue[i])
+		if err != nil {
+			println(err.Error())
+			continue
+		}
+		// Sitemaps of an index are read after the ones already queued
+		queue = append(queue, doc.Sitemaps...)
+		for _, loc := range doc.URLs {
+			u, err := links.NormalizeURL(strings.TrimSpace(loc))
+			if err != nil || seen[u] || !strings.HasPrefix(u, "http") {
+				continue
+			}
+			seen[u] = true
+			seeds = append(seeds, u)
+			if len(seeds) >= s.maxSeeds {
+				break
+			}
+		}
+	}
+	return seeds
+}
+
+// fetch downloads and parses a sitemap document
+func (s *Seeder) fetch(ctx context.Context, loc string) (*document, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSpace(loc), nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.userAgent != "" {
+		req.Header.Set("User-Agent", s.userAgent)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("sitemap %s: %s", loc, resp.Status)
+	}
+
+	// Compressed sitemaps are recognised by their content, servers label them inconsistently
+	var body io.Reader = bufio.NewReader(resp.Body)
+	if magic, err := body.(*bufio.Reader).Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	doc := &document{}
+	if err := xml.NewDecoder(io.LimitReader(body, MaxSize)).Decode(doc); err != nil {
+		return nil, fmt.Errorf("sitemap %s: %v", loc, err)
+	}
+	if doc.XMLName.Local != "urlset" && doc.XMLName.Local != "sitemapindex" {
+		return nil, fmt.Errorf("sitemap %s: unexpected <%s> document", loc, doc.XMLName.Local)
+	}
+	return doc, nil
+}
@@ -0,0 +1,198 @@
+package sitemap
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/links"
+)
+
+// Limits of a single sitemap file set by the sitemaps.org protocol
+const (
+	MaxURLs = 50000
+	MaxSize = 50 * 1024 * 1024
+)
+
+// IndexName is the name of the first file, the sitemap itself or the index of the sitemaps
+const IndexName = "sitemap.xml"
+
+const (
+	urlsetOpen    = xml.Header + `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` + "\n"
+	urlsetClose   = "</urlset>\n"
+	indexOpen     = xml.Header + `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` + "\n"
+	indexClose    = "</sitemapindex>\n"
+	w3cDatetime   = "2006-01-02T15:04:05Z07:00"
+	sitemapFormat = "sitemap-%d.xml"
+)
+
+// File is a generated sitemap document
+type File struct {
+	Name string
+	Body []byte
+}
+
+// Builder turns a crawl into sitemap files
+type Builder struct {
+	maxURLs int
+	maxSize int
+	baseURL string
+}
+
+// Option sets a setting of the builder
+type Option func(*Builder)
+
+// WithMaxURLs sets the number of URLs of a sitemap file, capped to the protocol limit
+func WithMaxURLs(n int) Option {
+	return func(b *Builder) {
+		if n > 0 && n < MaxURLs {
+			b.maxURLs = n
+		}
+	}
+}
+
+// WithMaxSize sets the size in bytes of a sitemap file, capped to the protocol limit
+func WithMaxSize(n int) Option {
+	return func(b *Builder) {
+		if n > 0 && n < MaxSize {
+			b.maxSize = n
+		}
+	}
+}
+
+// WithBaseURL sets the URL the sitemap files are published under, the root of the seed site by default
+func WithBaseURL(u string) Option {
+	return func(b *Builder) {
+		b.baseURL = u
+	}
+}
+
+// NewBuilder returns a pointer to a new sitemap builder
+func NewBuilder(opts ...Option) *Builder {
+	b := &Builder{maxURLs: MaxURLs, maxSize: MaxSize}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Build returns the sitemap of a crawl. It lists the HTML pages of the seed host fetched with a 200 status or
+// unchanged since they were cached, duplicates left out, a single sitemap.xml when it fits the limits or a
+// sitemap.xml index followed by the sitemaps otherwise
+func (b *Builder) Build(res *data.Response) ([]File, error) {
+	seed, err := url.Parse(res.URL)
+	if res.FinalURL != "" {
+		seed, err = url.Parse(res.FinalURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	base := b.baseURL
+	if base == "" {
+		base = seed.Scheme + "://" + seed.Host + "/"
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+
+	// Split the entries in files within the limits
+	files := make([]File, 0)
+	var body bytes.Buffer
+	count := 0
+	flush := func() {
+		body.WriteString(urlsetClose)
+		files = append(files, File{Name: fmt.Sprintf(sitemapFormat, len(files)+1), Body: append([]byte(nil), body.Bytes()...)})
+		body.Reset()
+		count = 0
+	}
+	for _, entry := range entries(res, seed.Host) {
+		if count > 0 && (count >= b.maxURLs || body.Len()+len(entry)+len(urlsetClose) > b.maxSize) {
+			flush()
+		}
+		if count == 0 {
+			body.WriteString(urlsetOpen)
+		}
+		body.WriteString(entry)
+		count++
+	}
+	// A crawl without pages still has a valid, empty sitemap
+	if len(files) == 0 && count == 0 {
+		body.WriteString(urlsetOpen)
+	}
+	if body.Len() > 0 {
+		flush()
+	}
+
+	if len(files) == 1 {
+		files[0].Name = IndexName
+		return files, nil
+	}
+
+	var index bytes.Buffer
+	index.WriteString(indexOpen)
+	for _, f := range files {
+		index.WriteString("  <sitemap><loc>" + escape(base+f.Name) + "</loc></sitemap>\n")
+	}
+	index.WriteString(indexClose)
+	return append([]File{{Name: IndexName, Body: index.Bytes()}}, files...), nil
+}
+
+// entries returns the <url> elements of the pages to list, in breadth first order
+func entries(res *data.Response, host string) []string {
+	seen := make(map[string]bool)
+	list := make([]string, 0)
+	nodes := []*data.Response{res}
+	for i := 0; i < len(nodes); i++ {
+		n := nodes[i]
+		nodes = append(nodes, n.Nodes...)
+		if n.External || n.Skipped != "" || n.Error != "" || n.DuplicateOf != "" || (n.Status != http.StatusOK && !n.Unchanged) || !links.IsHTML(n.ContentType) {
+			continue
+		}
+		// Redirected pages are listed under their final URL
+		loc := n.URL
+		if n.FinalURL != "" {
+			loc = n.FinalURL
+		}
+		u, err := url.Parse(loc)
+		if err != nil || !strings.EqualFold(u.Host, host) || seen[loc] {
+			continue
+		}
+		seen[loc] = true
+
+		entry := "  <url><loc>" + escape(loc) + "</loc>"
+		if t, err := http.ParseTime(n.LastModified); err == nil {
+			entry += "<lastmod>" + t.UTC().Format(w3cDatetime) + "</lastmod>"
+		}
+		list = append(list, entry+"</url>\n")
+	}
+	return list
+}
+
+// escape returns a text escaped for XML
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// WriteZip writes the sitemap files in a zip archive
+func WriteZip(w io.Writer, files []File) error {
+	z := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := z.CreateHeader(&zip.FileHeader{Name: f.Name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(f.Body); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
@@ -0,0 +1,221 @@
+package sitemap_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/sitemap"
+)
+
+const (
+	header = `<?xml version="1.0" encoding="UTF-8"?>` + "\n"
+	urlset = header + `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` + "\n"
+)
+
+// crawl is a seed site with pages that are listed and pages that are not
+var crawl = &data.Response{Depth: 0, URL: "https://www.successweb.com", Status: 200, ContentType: "text/html; charset=utf-8", LastModified: "Wed, 21 Oct 2015 07:28:00 GMT", Nodes: []*data.Response{
+	{Depth: 1, URL: "https://www.successweb.com/a?b=1&c=2", Status: 200, ContentType: "text/html"},
+	{Depth: 1, URL: "https://www.successweb.com/old", FinalURL: "https://www.successweb.com/new", Status: 200},
+	{Depth: 1, URL: "https://www.successweb.com/missing", Status: 404, ContentType: "text/html"},
+	{Depth: 1, URL: "https://www.successweb.com/report.pdf", Status: 200, ContentType: "application/pdf"},
+	{Depth: 1, URL: "https://www.successweb.com/private", Skipped: data.SkippedRobots},
+	{Depth: 1, URL: "https://www.otherweb.com", External: true},
+	{Depth: 1, URL: "https://cdn.successweb.com/page", Status: 200, ContentType: "text/html"},
+	{Depth: 1, URL: "https://www.successweb.com/broken", Status: 200, ContentType: "text/html", Error: "unexpected EOF"},
+}}
+
+const (
+	seedEntry = `  <url><loc>https://www.successweb.com</loc><lastmod>2015-10-21T07:28:00Z</lastmod></url>` + "\n"
+	aEntry    = `  <url><loc>https://www.successweb.com/a?b=1&amp;c=2</loc></url>` + "\n"
+	newEntry  = `  <url><loc>https://www.successweb.com/new</loc></url>` + "\n"
+)
+
+func TestBuild(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name          string
+		opts          []sitemap.Option
+		crawl         *data.Response
+		expectedFiles []sitemap.File
+	}{
+		{
+			name:  "Single sitemap",
+			crawl: crawl,
+			expectedFiles: []sitemap.File{
+				{Name: "sitemap.xml", Body: []byte(urlset + seedEntry + aEntry + newEntry + "</urlset>\n")},
+			},
+		},
+		{
+			name:  "Empty sitemap",
+			crawl: &data.Response{URL: "https://www.successweb.com", Error: "no such host"},
+			expectedFiles: []sitemap.File{
+				{Name: "sitemap.xml", Body: []byte(urlset + "</urlset>\n")},
+			},
+		},
+		{
+			name:  "Index over the URL limit",
+			opts:  []sitemap.Option{sitemap.WithMaxURLs(2)},
+			crawl: crawl,
+			expectedFiles: []sitemap.File{
+				{Name: "sitemap.xml", Body: []byte(header + `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` + "\n" +
+					"  <sitemap><loc>https://www.successweb.com/sitemap-1.xml</loc></sitemap>\n" +
+					"  <sitemap><loc>https://www.successweb.com/sitemap-2.xml</loc></sitemap>\n" +
+					"</sitemapindex>\n")},
+				{Name: "sitemap-1.xml", Body: []byte(urlset + seedEntry + aEntry + "</urlset>\n")},
+				{Name: "sitemap-2.xml", Body: []byte(urlset + newEntry + "</urlset>\n")},
+			},
+		},
+		{
+			name:  "Index over the size limit under a base URL",
+			opts:  []sitemap.Option{sitemap.WithMaxSize(len(urlset) + len(seedEntry) + len(aEntry) + len("</urlset>\n") - 1), sitemap.WithBaseURL("https://static.successweb.com/maps")},
+			crawl: crawl,
+			expectedFiles: []sitemap.File{
+				{Name: "sitemap.xml", Body: []byte(header + `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` + "\n" +
+					"  <sitemap><loc>https://static.successweb.com/maps/sitemap-1.xml</loc></sitemap>\n" +
+					"  <sitemap><loc>https://static.successweb.com/maps/sitemap-2.xml</loc></sitemap>\n" +
+					"</sitemapindex>\n")},
+				{Name: "sitemap-1.xml", Body: []byte(urlset + seedEntry + "</urlset>\n")},
+				{Name: "sitemap-2.xml", Body: []byte(urlset + aEntry + newEntry + "</urlset>\n")},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			files, err := sitemap.NewBuilder(tc.opts...).Build(tc.crawl)
+
+			assert.NoError(err, tc.name)
+			assert.Equal(len(tc.expectedFiles), len(files), tc.name)
+			for i := range tc.expectedFiles {
+				if i < len(files) {
+					assert.Equal(tc.expectedFiles[i].Name, files[i].Name, tc.name)
+					assert.Equal(string(tc.expectedFiles[i].Body), string(files[i].Body), tc.name)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteZip(t *testing.T) {
+	assert := assert.New(t)
+
+	files := []sitemap.File{{Name: "sitemap.xml", Body: []byte("index")}, {Name: "sitemap-1.xml", Body: []byte("urls")}}
+	var b bytes.Buffer
+	require.NoError(t, sitemap.WriteZip(&b, files))
+
+	z, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	require.NoError(t, err)
+	assert.Len(z.File, 2)
+	for i, f := range z.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(files[i].Name, f.Name)
+		assert.Equal(files[i].Body, body)
+	}
+}
+
+type MockSitemapper struct {
+	URLs []string
+}
+
+func (m *MockSitemapper) Sitemaps(ctx context.Context, url string) []string {
+	return m.URLs
+}
+
+// newSitemapServer serves a sitemap index pointing to a plain and a gzip-compressed sitemap, and /sitemap.xml
+func newSitemapServer() *httptest.Server {
+	var s *httptest.Server
+	urlset := func(locs ...string) string {
+		body := `<?xml version="1.0" encoding="UTF-8"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`
+		for _, l := range locs {
+			body += "<url><loc>" + s.URL + l + "</loc></url>"
+		}
+		return body + "</urlset>"
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sitemap_index.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"><sitemap><loc>%[1]s/pages.xml</loc></sitemap><sitemap><loc> %[1]s/news.xml.gz </loc></sitemap><sitemap><loc>%[1]s/missing.xml</loc></sitemap></sitemapindex>`, s.URL)
+	})
+	mux.HandleFunc("/pages.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, urlset("/a", "/b#top", "/a"))
+	})
+	mux.HandleFunc("/news.xml.gz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		gz := gzip.NewWriter(w)
+		fmt.Fprint(gz, urlset("/news/1"))
+		gz.Close()
+	})
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, urlset("/root"))
+	})
+	s = httptest.NewServer(mux)
+	return s
+}
+
+func TestSeeds(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newSitemapServer()
+	defer s.Close()
+
+	tt := []struct {
+		name          string
+		robots        *MockSitemapper
+		opts          []sitemap.SeederOption
+		expectedSeeds []string
+	}{
+		{
+			name:          "Index declared in robots.txt",
+			robots:        &MockSitemapper{URLs: []string{s.URL + "/sitemap_index.xml"}},
+			expectedSeeds: []string{s.URL + "/a", s.URL + "/b", s.URL + "/news/1"},
+		},
+		{
+			name:          "Default sitemap without robots.txt",
+			expectedSeeds: []string{s.URL + "/root"},
+		},
+		{
+			name:          "Default sitemap when robots.txt has none",
+			robots:        &MockSitemapper{},
+			expectedSeeds: []string{s.URL + "/root"},
+		},
+		{
+			name:          "Limited number of seeds",
+			robots:        &MockSitemapper{URLs: []string{s.URL + "/sitemap_index.xml"}},
+			opts:          []sitemap.SeederOption{sitemap.WithMaxSeeds(2)},
+			expectedSeeds: []string{s.URL + "/a", s.URL + "/b"},
+		},
+		{
+			name:          "Missing sitemap",
+			robots:        &MockSitemapper{URLs: []string{s.URL + "/missing.xml"}},
+			expectedSeeds: []string{},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var robots sitemap.Sitemapper
+			if tc.robots != nil {
+				robots = tc.robots
+			}
+			seeder := sitemap.NewSeeder(s.Client(), robots, tc.opts...)
+
+			u, _ := url.Parse(s.URL + "/start")
+			assert.Equal(tc.expectedSeeds, seeder.Seeds(context.Background(), u), tc.name)
+		})
+	}
+}
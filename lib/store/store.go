@@ -0,0 +1,89 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/smashed-avo/go-crawler/lib/jobs"
+)
+
+// openTimeout is how long to wait for the lock of a file used by another process
+const openTimeout = time.Second
+
+// bucketJobs holds the records of the jobs keyed by ID
+var bucketJobs = []byte("jobs")
+
+// Store keeps the jobs of the manager in an embedded key value file, it is safe for concurrent use
+type Store struct {
+	db *bolt.DB
+}
+
+// NewStore opens the store file, creating it when missing
+func NewStore(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketJobs)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Save writes the record of a job, replacing the previous one
+func (s *Store) Save(r *jobs.Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketJobs).Put([]byte(r.Status.ID), b)
+	})
+}
+
+// Get returns the record of a job, jobs.ErrNotFound when it is unknown
+func (s *Store) Get(id string) (*jobs.Record, error) {
+	r := &jobs.Record{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketJobs).Get([]byte(id))
+		if v == nil {
+			return jobs.ErrNotFound
+		}
+		return json.Unmarshal(v, r)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// List returns the records of every job
+func (s *Store) List() ([]*jobs.Record, error) {
+	records := make([]*jobs.Record, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketJobs).ForEach(func(k, v []byte) error {
+			r := &jobs.Record{}
+			if err := json.Unmarshal(v, r); err != nil {
+				return err
+			}
+			records = append(records, r)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Close releases the store file
+func (s *Store) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,78 @@
+package store_test
+
+import (
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/jobs"
+	"github.com/smashed-avo/go-crawler/lib/store"
+)
+
+var created = time.Date(2026, 10, 5, 10, 0, 0, 0, time.UTC)
+
+func record(id, status string) *jobs.Record {
+	return &jobs.Record{
+		Status: jobs.Status{ID: id, URL: "https://www.successweb.com", Depth: 2, Status: status, Created: created},
+		Params: url.Values{"url": {"https://www.successweb.com"}, "depth": {"2"}},
+		Result: &data.Response{Title: "Success Web", URL: "https://www.successweb.com", Nodes: make([]*data.Response, 0), Truncated: true},
+		Links:  map[string][]data.Link{"https://www.successweb.com": {{URL: "https://www.successweb.com/about", Text: "About"}}},
+	}
+}
+
+func TestStore(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		name     string
+		saved    []*jobs.Record
+		expected []*jobs.Record
+	}{
+		{
+			name:     "Empty",
+			expected: []*jobs.Record{},
+		},
+		{
+			name:     "Records",
+			saved:    []*jobs.Record{record("a", jobs.StatusDone), record("b", jobs.StatusRunning)},
+			expected: []*jobs.Record{record("a", jobs.StatusDone), record("b", jobs.StatusRunning)},
+		},
+		{
+			name:     "Record replaced",
+			saved:    []*jobs.Record{record("a", jobs.StatusRunning), record("a", jobs.StatusDone)},
+			expected: []*jobs.Record{record("a", jobs.StatusDone)},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "jobs.db")
+			s, err := store.NewStore(path)
+			require.NoError(t, err)
+			for _, r := range tc.saved {
+				assert.NoError(s.Save(r))
+			}
+			require.NoError(t, s.Close())
+
+			// Records survive a reopen
+			s, err = store.NewStore(path)
+			require.NoError(t, err)
+			defer s.Close()
+			records, err := s.List()
+			assert.NoError(err)
+			assert.Equal(tc.expected, records)
+			for _, r := range tc.expected {
+				got, err := s.Get(r.Status.ID)
+				assert.NoError(err)
+				assert.Equal(r, got)
+			}
+			_, err = s.Get("unknown")
+			assert.Equal(jobs.ErrNotFound, err)
+		})
+	}
+}
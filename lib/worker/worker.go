@@ -1,85 +1,195 @@
 package worker
 
 import (
+	"context"
 	"net/url"
-	"strings"
-
-	"github.com/PuerkitoBio/goquery"
 
 	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/links"
 )
 
 // Collectorer interface to collector function
 type Collectorer interface {
-	Collect(url string, chLinks chan string, chFinished chan bool, chErrors chan error)
+	Collect(ctx context.Context, url string) (*links.Page, error)
+}
+
+// Robotser interface to robots.txt rules
+type Robotser interface {
+	Allowed(ctx context.Context, url string) (bool, error)
 }
 
 // Worker responsible for a single URL to retrieve all its linkr and store them as linked nodes
 type Worker struct {
-	Collector  Collectorer
-	ChLinks    chan string
-	ChErrors   chan error
-	ChFinished chan bool
+	Collector Collectorer
+	Robots    Robotser
+}
+
+// Option sets a setting of the worker
+type Option func(*Worker)
+
+// WithRobots makes the worker honour robots.txt rules
+func WithRobots(r Robotser) Option {
+	return func(w *Worker) {
+		w.Robots = r
+	}
 }
 
 // NewWorker factory method to inject collector instance
-func NewWorker(c Collectorer) *Worker {
-	return &Worker{Collector: c}
+func NewWorker(c Collectorer, opts ...Option) *Worker {
+	w := &Worker{Collector: c}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
 }
 
-// Do gets all links for a website and stores them in the node
-func (w *Worker) Do(node *data.Response, depth int, chQueue chan []*data.Response, visited *data.Visited) {
-	// Channels
-	w.ChLinks = make(chan string)
-	w.ChFinished = make(chan bool)
-	w.ChErrors = make(chan error)
-	defer close(w.ChLinks)
-	defer close(w.ChFinished)
-	defer close(w.ChErrors)
-
-	go w.Collector.Collect(node.URL, w.ChLinks, w.ChFinished, w.ChErrors)
-
-	// Subscribe to channels
-	for {
-		select {
-		case link := <-w.ChLinks:
-			// check if link ir parseable
-			u, err := url.Parse(link)
-			if err != nil {
-				println(err.Error())
-				continue
-			}
-			visited.RLock()
-			// If node already visited, do not register
-			if visited.M[link] {
-				continue
-			}
-			visited.M[link] = true
-			visited.RUnlock()
-			subNode := data.Response{
-				Depth: depth,
-				Title: w.GetPageTitle(u.String()),
-				URL:   u.String(),
-				Nodes: make([]*data.Response, 0),
-			}
-			node.Nodes = append(node.Nodes, &subNode)
-			break
-		case <-w.ChFinished:
-			chQueue <- node.Nodes
+// Do fetches a website once, stores its details in the node and, if maximum depth allows it, its links as children.
+// Links out of the crawl scope are registered as external leaves.
+func (w *Worker) Do(ctx context.Context, node *data.Response, crawl *data.Crawl) {
+	// Sites disallowed by robots.txt are kept in the tree as skipped, a crawl stopped before robots.txt is
+	// fetched leaves the site unfetched
+	if w.Robots != nil {
+		allowed, err := w.Robots.Allowed(ctx, node.URL)
+		if err != nil {
 			return
-		case <-w.ChErrors:
-			// Failed to return 200 OK for this link
-			chQueue <- node.Nodes
+		}
+		if !allowed {
+			node.Skipped = data.SkippedRobots
 			return
 		}
 	}
-}
 
-// GetPageTitle gets title for a page
-func (w *Worker) GetPageTitle(u string) string {
-	doc, err := goquery.NewDocument(u)
+	page, err := w.Collector.Collect(ctx, node.URL)
+	if page != nil {
+		node.Title = page.Title
+		node.Status = page.StatusCode
+		node.FinalURL = page.URL
+		node.Redirects = page.Redirects
+		node.RedirectLoop = page.RedirectLoop
+		node.LongRedirects = page.LongRedirects
+		node.Canonical = page.Canonical
+		node.ContentHash = page.ContentHash
+		node.SimHash = page.SimHash
+		node.ContentType = page.ContentType
+		node.ContentLength = page.ContentLength
+		node.ResponseTime = page.ResponseTime.Milliseconds()
+		node.LastModified = page.Header.Get("Last-Modified")
+		node.Unchanged = page.Unchanged
+	}
 	if err != nil {
-		return ""
+		// Failed to fetch this link, the error is kept in the node
+		node.Error = err.Error()
+		return
+	}
+
+	// A seed redirected to another host is crawled on that host
+	if node.Depth == 0 {
+		redirected(node, crawl)
+	}
+
+	// Links, to pages and resources, are kept for the graph, children of a node at maximum depth, of an error
+	// page or of a duplicate are not registered, nor those of a near duplicate when they are skipped
+	node.Links = page.Links
+	depth := node.Depth + 1
+	if !succeeded(node) || !final(node, crawl) || duplicate(node, crawl) || nearDuplicate(node, crawl) || depth >= crawl.MaxDepth {
+		return
+	}
+
+	// The seed may already have children listed in the sitemaps
+	registered := 0
+	for _, link := range page.Links {
+		// Resources such as images and scripts are recorded but not followed
+		if !link.Navigational() {
+			continue
+		}
+		// Stop registering children once the page reached its limit
+		if crawl.MaxLinksPerPage > 0 && registered >= crawl.MaxLinksPerPage {
+			crawl.Hit(data.LimitMaxLinksPerPage)
+			break
+		}
+		// Links that do not parse are kept in the links of the node but not followed
+		u, err := url.Parse(link.URL)
+		if err != nil {
+			continue
+		}
+		crawl.Visited.Lock()
+		// If node already visited, do not register
+		if crawl.Visited.M[link.URL] {
+			crawl.Visited.Unlock()
+			continue
+		}
+		crawl.Visited.M[link.URL] = true
+		crawl.Visited.Unlock()
+		subNode := data.Response{
+			Depth:    depth,
+			URL:      u.String(),
+			Nodes:    make([]*data.Response, 0),
+			Source:   data.SourceLink,
+			External: crawl.Scope != nil && !crawl.Scope.InScope(u),
+		}
+		node.Nodes = append(node.Nodes, &subNode)
+		registered++
+	}
+}
+
+// succeeded reports whether a site was fetched with a 2xx status, or was unchanged since cached
+func succeeded(node *data.Response) bool {
+	return node.Unchanged || node.Status >= 200 && node.Status < 300
+}
+
+// final marks the URL a site was redirected to as visited, so links to it are not fetched again. It returns
+// false when another site already reached it, the page is then only expanded once
+func final(node *data.Response, crawl *data.Crawl) bool {
+	if node.FinalURL == "" {
+		return true
+	}
+	u, err := links.NormalizeURL(node.FinalURL)
+	requested, _ := links.NormalizeURL(node.URL)
+	if err != nil || u == requested {
+		return true
+	}
+	crawl.Visited.Lock()
+	defer crawl.Visited.Unlock()
+	if crawl.Visited.M[u] {
+		return false
+	}
+	crawl.Visited.M[u] = true
+	return true
+}
+
+// redirected hands the URL the seed was redirected to to the crawl scope, when it follows redirects
+func redirected(node *data.Response, crawl *data.Crawl) {
+	r, ok := crawl.Scope.(data.Redirecter)
+	if !ok || node.FinalURL == "" {
+		return
+	}
+	if u, err := url.Parse(node.FinalURL); err == nil {
+		r.Redirected(u)
+	}
+}
+
+// duplicate reports whether a page has the canonical URL or the content of a page already crawled, the
+// page it duplicates is recorded
+func duplicate(node *data.Response, crawl *data.Crawl) bool {
+	if crawl.Dedup == nil {
+		return false
+	}
+	orig, by, dup := crawl.Dedup.Seen(node)
+	if dup {
+		node.DuplicateOf, node.DuplicateBy = orig, by
+	}
+	return dup
+}
+
+// nearDuplicate records the page a page nearly duplicates, if any, and reports whether it is not to be
+// expanded
+func nearDuplicate(node *data.Response, crawl *data.Crawl) bool {
+	if crawl.Dedup == nil {
+		return false
+	}
+	orig, similarity, near := crawl.Dedup.Near(node)
+	if near {
+		node.NearDuplicateOf, node.Similarity = orig, similarity
 	}
-	return strings.TrimSpace(doc.Find("title").Text())
+	return near && crawl.SkipNear
 }
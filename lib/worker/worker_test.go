@@ -1,13 +1,18 @@
 package worker_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/smashed-avo/go-crawler/lib/data"
+	"github.com/smashed-avo/go-crawler/lib/links"
 	"github.com/smashed-avo/go-crawler/lib/worker"
 )
 
@@ -21,11 +26,23 @@ var (
 	link2             = "www.fakeweb.com/test2"
 	link3             = "www.fakeweb.com/test3"
 	linkNonParseable  = "http://a b.com/"
-	link1node         = data.Response{Depth: 1, Title: "", URL: "www.fakeweb.com/test1", Nodes: []*data.Response{}}
-	link2node         = data.Response{Depth: 1, Title: "", URL: "www.fakeweb.com/test2", Nodes: []*data.Response{}}
-	link3node         = data.Response{Depth: 1, Title: "", URL: "www.fakeweb.com/test3", Nodes: []*data.Response{}}
+	link1node         = data.Response{Depth: 1, Title: "", URL: "www.fakeweb.com/test1", Nodes: []*data.Response{}, Source: data.SourceLink}
+	link2node         = data.Response{Depth: 1, Title: "", URL: "www.fakeweb.com/test2", Nodes: []*data.Response{}, Source: data.SourceLink}
+	link3node         = data.Response{Depth: 1, Title: "", URL: "www.fakeweb.com/test3", Nodes: []*data.Response{}, Source: data.SourceLink}
+	link2externalNode = data.Response{Depth: 1, Title: "", URL: "www.fakeweb.com/test2", Nodes: []*data.Response{}, Source: data.SourceLink, External: true}
 	linkWithTitle     = "https://en.wikipedia.org/wiki/Go_(programming_language)"
-	linkWithTitleNode = data.Response{Depth: 1, Title: "Go (programming language) - Wikipedia", URL: "https://en.wikipedia.org/wiki/Go_(programming_language)", Nodes: []*data.Response{}}
+	linkWithTitleNode = data.Response{Depth: 1, Title: "", URL: "https://en.wikipedia.org/wiki/Go_(programming_language)", Nodes: []*data.Response{}, Source: data.SourceLink}
+	threeLinks        = toLinks(link1, link2, link3)
+	repeatedLinks     = toLinks(link1, link2, link3, link1)
+	nonParseableLinks = toLinks(link1, link2, linkNonParseable, link3)
+	titleLinks        = toLinks(linkWithTitle)
+	redirects         = []data.Redirect{{URL: "https://www.successweb.com", Status: 301, Location: "https://www.successweb.com/home"}}
+	resourceLinks     = []data.Link{
+		{URL: "www.fakeweb.com/logo.png", Element: "img", Attr: "src"},
+		{URL: link1, Element: "a", Attr: "href"},
+		{URL: "www.fakeweb.com/app.js", Element: "script", Attr: "src"},
+		{URL: link2, Element: "area", Attr: "href"},
+	}
 )
 
 const (
@@ -34,137 +51,356 @@ const (
 	successLinkWithTitleFinished
 	successRepeatedLinkFinished
 	successNonParseableLinkNotIncluded
+	successUnchangedFinished
+	successResourcesNotFollowed
+	successRedirected
+	notFoundWithLinks
 	errored
+	erroredBody
 )
 
 type mockStateCollector int
 
 type MockCollector struct {
-	State      mockStateCollector
-	ChLinks    chan string
-	ChErrors   chan error
-	ChFinished chan bool
+	State mockStateCollector
 }
 
-func (w *MockCollector) Collect(url string, chLinks chan string, chFinished chan bool, chErrors chan error) {
+func (w *MockCollector) Collect(ctx context.Context, url string) (*links.Page, error) {
 	switch w.State {
 	case successThreeLinksFinished:
-		chLinks <- link1
-		chLinks <- link2
-		chLinks <- link3
-		chFinished <- true
-		return
+		return &links.Page{StatusCode: 200, URL: url, Title: "Success Web", Links: threeLinks}, nil
 	case successLinkWithTitleFinished:
-		chLinks <- linkWithTitle
-		chFinished <- true
-		return
+		return &links.Page{StatusCode: 200, URL: url, Title: "Go (programming language) - Wikipedia", Links: titleLinks, Header: http.Header{"Last-Modified": []string{"Wed, 21 Oct 2015 07:28:00 GMT"}}}, nil
 	case successRepeatedLinkFinished:
-		chLinks <- link1
-		chLinks <- link2
-		chLinks <- link3
-		chLinks <- link1
-		chFinished <- true
-		return
+		return &links.Page{StatusCode: 200, URL: url, Title: "Success Web", Links: repeatedLinks}, nil
 	case successNonParseableLinkNotIncluded:
-		chLinks <- link1
-		chLinks <- link2
-		chLinks <- linkNonParseable
-		chLinks <- link3
-		chFinished <- true
-		return
+		return &links.Page{StatusCode: 200, URL: url, Title: "Success Web", Links: nonParseableLinks}, nil
+	case successUnchangedFinished:
+		return &links.Page{StatusCode: 304, URL: url, Title: "Success Web", Links: threeLinks, Unchanged: true}, nil
+	case successResourcesNotFollowed:
+		return &links.Page{StatusCode: 200, URL: url, Title: "Success Web", Links: resourceLinks}, nil
+	case successRedirected:
+		return &links.Page{StatusCode: 200, URL: "https://www.successweb.com/home", Title: "Success Web", Links: threeLinks, Redirects: redirects, LongRedirects: true}, nil
+	case notFoundWithLinks:
+		return &links.Page{StatusCode: 404, URL: url, Title: "Not Found", Links: threeLinks}, nil
 	case errored:
-		chErrors <- errors.New("Test error")
-		return
+		return nil, errors.New("Test error")
+	case erroredBody:
+		return &links.Page{StatusCode: 200, URL: url + "/", ContentType: "text/html", ContentLength: 512, ResponseTime: 1500 * time.Millisecond, Links: []data.Link{}}, errors.New("unexpected EOF")
 	default:
 		panic(fmt.Sprintf("Invalid mockStateCollector: %v", w.State))
 	}
 }
 
+type MockRobots struct {
+	Allow bool
+	Err   error
+}
+
+func (r *MockRobots) Allowed(ctx context.Context, url string) (bool, error) {
+	return r.Allow, r.Err
+}
+
+type MockDeduper struct {
+	Original string
+	NearOf   string
+}
+
+func (d *MockDeduper) Seen(node *data.Response) (string, string, bool) {
+	return d.Original, data.DuplicateCanonical, d.Original != ""
+}
+
+func (d *MockDeduper) Near(node *data.Response) (string, float64, bool) {
+	if d.NearOf == "" {
+		return "", 0, false
+	}
+	return d.NearOf, 0.96875, true
+}
+
+type MockScope struct {
+	Out string
+}
+
+func (s *MockScope) InScope(u *url.URL) bool {
+	return u.String() != s.Out
+}
+
+// MockRedirectScope only follows links once the seed redirect is known
+type MockRedirectScope struct {
+	Final string
+}
+
+func (s *MockRedirectScope) Redirected(final *url.URL) {
+	s.Final = final.String()
+}
+
+func (s *MockRedirectScope) InScope(u *url.URL) bool {
+	return s.Final != ""
+}
+
 func TestDo(t *testing.T) {
 	assert := assert.New(t)
 
 	tt := []struct {
-		name                string
-		state               mockStateCollector
-		depth               int
-		node                *data.Response
-		expectedQueueValues []*data.Response
-		expectedVisited     *data.Visited
-		expectedNode        *data.Response
+		name             string
+		state            mockStateCollector
+		maxDepth         int
+		robots           *MockRobots
+		scope            data.Scoper
+		maxLinksPerPage  int
+		visited          []string
+		dedup            data.Deduper
+		skipNear         bool
+		expectedLimits   []string
+		node             *data.Response
+		expectedChildren []*data.Response
+		expectedVisited  *data.Visited
+		expectedNode     *data.Response
 	}{
 		{
-			name:                "Success - Collect three links",
-			state:               successThreeLinksFinished,
-			depth:               1,
-			node:                &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{}},
-			expectedQueueValues: []*data.Response{&link1node, &link2node, &link3node},
-			expectedVisited:     addVisited(&data.Visited{M: make(map[string]bool)}, link1, link2, link3),
-			expectedNode:        &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{&link1node, &link2node, &link3node}},
-		},
-		{
-			name:                "Success - Collect link with title",
-			state:               successLinkWithTitleFinished,
-			depth:               1,
-			node:                &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{}},
-			expectedQueueValues: []*data.Response{&linkWithTitleNode},
-			expectedVisited:     addVisited(&data.Visited{M: make(map[string]bool)}, linkWithTitle),
-			expectedNode:        &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{&linkWithTitleNode}},
-		},
-		{
-			name:                "Success - Repeated link",
-			state:               successRepeatedLinkFinished,
-			depth:               1,
-			node:                &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{}},
-			expectedQueueValues: []*data.Response{&link1node, &link2node, &link3node},
-			expectedVisited:     addVisited(&data.Visited{M: make(map[string]bool)}, link1, link2, link3),
-			expectedNode:        &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{&link1node, &link2node, &link3node}},
-		},
-		{
-			name:                "Success - Non parseable link excluded",
-			state:               successNonParseableLinkNotIncluded,
-			depth:               1,
-			node:                &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{}},
-			expectedQueueValues: []*data.Response{&link1node, &link2node, &link3node},
-			expectedVisited:     addVisited(&data.Visited{M: make(map[string]bool)}, link1, link2, link3),
-			expectedNode:        &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{&link1node, &link2node, &link3node}},
-		},
-		{
-			name:                "Error - couldn't connect to site",
-			state:               errored,
-			depth:               1,
-			node:                &data.Response{Depth: 0, Title: "Error Web", URL: "https://www.errorweb.com", Nodes: []*data.Response{}},
-			expectedQueueValues: []*data.Response{},
-			expectedVisited:     &data.Visited{M: make(map[string]bool)},
-			expectedNode:        &data.Response{Depth: 0, Title: "Error Web", URL: "https://www.errorweb.com", Nodes: []*data.Response{}},
+			name:             "Success - Collect three links",
+			state:            successThreeLinksFinished,
+			maxDepth:         2,
+			node:             &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{}},
+			expectedChildren: []*data.Response{&link1node, &link2node, &link3node},
+			expectedVisited:  addVisited(&data.Visited{M: make(map[string]bool)}, link1, link2, link3),
+			expectedNode:     &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{&link1node, &link2node, &link3node}, Status: 200, FinalURL: "https://www.successweb.com", Links: threeLinks},
+		},
+		{
+			name:             "Success - Collect link with title",
+			state:            successLinkWithTitleFinished,
+			maxDepth:         2,
+			node:             &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{}},
+			expectedChildren: []*data.Response{&linkWithTitleNode},
+			expectedVisited:  addVisited(&data.Visited{M: make(map[string]bool)}, linkWithTitle),
+			expectedNode:     &data.Response{Depth: 0, Title: "Go (programming language) - Wikipedia", URL: "https://www.successweb.com", Nodes: []*data.Response{&linkWithTitleNode}, Status: 200, FinalURL: "https://www.successweb.com", LastModified: "Wed, 21 Oct 2015 07:28:00 GMT", Links: titleLinks},
+		},
+		{
+			name:             "Success - Unchanged page keeps the cached links",
+			state:            successUnchangedFinished,
+			maxDepth:         2,
+			node:             &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{}},
+			expectedChildren: []*data.Response{&link1node, &link2node, &link3node},
+			expectedVisited:  addVisited(&data.Visited{M: make(map[string]bool)}, link1, link2, link3),
+			expectedNode:     &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{&link1node, &link2node, &link3node}, Status: 304, FinalURL: "https://www.successweb.com", Unchanged: true, Links: threeLinks},
+		},
+		{
+			name:             "Success - Repeated link",
+			state:            successRepeatedLinkFinished,
+			maxDepth:         2,
+			node:             &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{}},
+			expectedChildren: []*data.Response{&link1node, &link2node, &link3node},
+			expectedVisited:  addVisited(&data.Visited{M: make(map[string]bool)}, link1, link2, link3),
+			expectedNode:     &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{&link1node, &link2node, &link3node}, Status: 200, FinalURL: "https://www.successweb.com", Links: repeatedLinks},
+		},
+		{
+			name:             "Success - Non parseable link excluded",
+			state:            successNonParseableLinkNotIncluded,
+			maxDepth:         2,
+			node:             &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{}},
+			expectedChildren: []*data.Response{&link1node, &link2node, &link3node},
+			expectedVisited:  addVisited(&data.Visited{M: make(map[string]bool)}, link1, link2, link3),
+			expectedNode:     &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{&link1node, &link2node, &link3node}, Status: 200, FinalURL: "https://www.successweb.com", Links: nonParseableLinks},
+		},
+		{
+			name:             "Success - Max depth reached, title only",
+			state:            successThreeLinksFinished,
+			maxDepth:         1,
+			node:             &data.Response{Depth: 0, Title: "", URL: "https://www.successweb.com", Nodes: []*data.Response{}},
+			expectedChildren: []*data.Response{},
+			expectedVisited:  &data.Visited{M: make(map[string]bool)},
+			expectedNode:     &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{}, Status: 200, FinalURL: "https://www.successweb.com", Links: threeLinks},
+		},
+		{
+			name:             "Success - Allowed by robots.txt",
+			state:            successThreeLinksFinished,
+			maxDepth:         2,
+			robots:           &MockRobots{Allow: true},
+			node:             &data.Response{Depth: 0, Title: "", URL: "https://www.successweb.com", Nodes: []*data.Response{}},
+			expectedChildren: []*data.Response{&link1node, &link2node, &link3node},
+			expectedVisited:  addVisited(&data.Visited{M: make(map[string]bool)}, link1, link2, link3),
+			expectedNode:     &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{&link1node, &link2node, &link3node}, Status: 200, FinalURL: "https://www.successweb.com", Links: threeLinks},
+		},
+		{
+			name:             "Skipped - Disallowed by robots.txt",
+			state:            successThreeLinksFinished,
+			maxDepth:         2,
+			robots:           &MockRobots{Allow: false},
+			node:             &data.Response{Depth: 1, Title: "", URL: "https://www.successweb.com/private", Nodes: []*data.Response{}},
+			expectedChildren: []*data.Response{},
+			expectedVisited:  &data.Visited{M: make(map[string]bool)},
+			expectedNode:     &data.Response{Depth: 1, Title: "", URL: "https://www.successweb.com/private", Nodes: []*data.Response{}, Skipped: data.SkippedRobots},
+		},
+		{
+			name:             "Unfetched - Crawl stopped before robots.txt is fetched",
+			state:            successThreeLinksFinished,
+			maxDepth:         2,
+			robots:           &MockRobots{Err: context.DeadlineExceeded},
+			node:             &data.Response{Depth: 1, Title: "", URL: "https://www.successweb.com/private", Nodes: []*data.Response{}},
+			expectedChildren: []*data.Response{},
+			expectedVisited:  &data.Visited{M: make(map[string]bool)},
+			expectedNode:     &data.Response{Depth: 1, Title: "", URL: "https://www.successweb.com/private", Nodes: []*data.Response{}},
+		},
+		{
+			name:             "Success - Out of scope link external",
+			state:            successThreeLinksFinished,
+			maxDepth:         2,
+			scope:            &MockScope{Out: link2},
+			node:             &data.Response{Depth: 0, Title: "", URL: "https://www.successweb.com", Nodes: []*data.Response{}},
+			expectedChildren: []*data.Response{&link1node, &link2externalNode, &link3node},
+			expectedVisited:  addVisited(&data.Visited{M: make(map[string]bool)}, link1, link2, link3),
+			expectedNode:     &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{&link1node, &link2externalNode, &link3node}, Status: 200, FinalURL: "https://www.successweb.com", Links: threeLinks},
+		},
+		{
+			name:             "Success - Max links per page",
+			state:            successThreeLinksFinished,
+			maxDepth:         2,
+			maxLinksPerPage:  2,
+			expectedLimits:   []string{data.LimitMaxLinksPerPage},
+			node:             &data.Response{Depth: 0, Title: "", URL: "https://www.successweb.com", Nodes: []*data.Response{}},
+			expectedChildren: []*data.Response{&link1node, &link2node},
+			expectedVisited:  addVisited(&data.Visited{M: make(map[string]bool)}, link1, link2),
+			expectedNode:     &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{&link1node, &link2node}, Status: 200, FinalURL: "https://www.successweb.com", Links: threeLinks},
+		},
+		{
+			name:             "Error - couldn't connect to site",
+			state:            errored,
+			maxDepth:         2,
+			node:             &data.Response{Depth: 0, Title: "Error Web", URL: "https://www.errorweb.com", Nodes: []*data.Response{}},
+			expectedChildren: []*data.Response{},
+			expectedVisited:  &data.Visited{M: make(map[string]bool)},
+			expectedNode:     &data.Response{Depth: 0, Title: "Error Web", URL: "https://www.errorweb.com", Nodes: []*data.Response{}, Error: "Test error"},
+		},
+		{
+			name:             "Success - Links of an error page recorded but not followed",
+			state:            notFoundWithLinks,
+			maxDepth:         2,
+			node:             &data.Response{Depth: 0, Title: "", URL: "https://www.successweb.com/missing", Nodes: []*data.Response{}},
+			expectedChildren: []*data.Response{},
+			expectedVisited:  &data.Visited{M: make(map[string]bool)},
+			expectedNode:     &data.Response{Depth: 0, Title: "Not Found", URL: "https://www.successweb.com/missing", Nodes: []*data.Response{}, Status: 404, FinalURL: "https://www.successweb.com/missing", Links: threeLinks},
+		},
+		{
+			name:             "Success - Resources recorded but not followed",
+			state:            successResourcesNotFollowed,
+			maxDepth:         2,
+			node:             &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{}},
+			expectedChildren: []*data.Response{&link1node, &link2node},
+			expectedVisited:  addVisited(&data.Visited{M: make(map[string]bool)}, link1, link2),
+			expectedNode:     &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{&link1node, &link2node}, Status: 200, FinalURL: "https://www.successweb.com", Links: resourceLinks},
+		},
+		{
+			name:             "Success - Redirected, final URL visited",
+			state:            successRedirected,
+			maxDepth:         2,
+			node:             &data.Response{Depth: 0, Title: "", URL: "https://www.successweb.com", Nodes: []*data.Response{}},
+			expectedChildren: []*data.Response{&link1node, &link2node, &link3node},
+			expectedVisited:  addVisited(&data.Visited{M: make(map[string]bool)}, "https://www.successweb.com/home", link1, link2, link3),
+			expectedNode:     &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{&link1node, &link2node, &link3node}, Status: 200, FinalURL: "https://www.successweb.com/home", Redirects: redirects, LongRedirects: true, Links: threeLinks},
+		},
+		{
+			name:             "Success - Redirected seed, links in the scope of the final URL",
+			state:            successRedirected,
+			maxDepth:         2,
+			scope:            &MockRedirectScope{},
+			node:             &data.Response{Depth: 0, Title: "", URL: "https://www.successweb.com", Nodes: []*data.Response{}},
+			expectedChildren: []*data.Response{&link1node, &link2node, &link3node},
+			expectedVisited:  addVisited(&data.Visited{M: make(map[string]bool)}, "https://www.successweb.com/home", link1, link2, link3),
+			expectedNode:     &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{&link1node, &link2node, &link3node}, Status: 200, FinalURL: "https://www.successweb.com/home", Redirects: redirects, LongRedirects: true, Links: threeLinks},
+		},
+		{
+			name:             "Success - Redirected to a page already visited, not expanded",
+			state:            successRedirected,
+			maxDepth:         2,
+			visited:          []string{"https://www.successweb.com/home"},
+			node:             &data.Response{Depth: 1, Title: "", URL: "https://www.successweb.com/old", Nodes: []*data.Response{}},
+			expectedChildren: []*data.Response{},
+			expectedVisited:  addVisited(&data.Visited{M: make(map[string]bool)}, "https://www.successweb.com/home"),
+			expectedNode:     &data.Response{Depth: 1, Title: "Success Web", URL: "https://www.successweb.com/old", Nodes: []*data.Response{}, Status: 200, FinalURL: "https://www.successweb.com/home", Redirects: redirects, LongRedirects: true, Links: threeLinks},
+		},
+		{
+			name:             "Success - Not a duplicate",
+			state:            successThreeLinksFinished,
+			maxDepth:         2,
+			dedup:            &MockDeduper{},
+			node:             &data.Response{Depth: 0, Title: "", URL: "https://www.successweb.com", Nodes: []*data.Response{}},
+			expectedChildren: []*data.Response{&link1node, &link2node, &link3node},
+			expectedVisited:  addVisited(&data.Visited{M: make(map[string]bool)}, link1, link2, link3),
+			expectedNode:     &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{&link1node, &link2node, &link3node}, Status: 200, FinalURL: "https://www.successweb.com", Links: threeLinks},
+		},
+		{
+			name:             "Success - Duplicate not expanded",
+			state:            successThreeLinksFinished,
+			maxDepth:         2,
+			dedup:            &MockDeduper{Original: "https://www.successweb.com/home"},
+			node:             &data.Response{Depth: 1, Title: "", URL: "https://www.successweb.com/home?source=card", Nodes: []*data.Response{}},
+			expectedChildren: []*data.Response{},
+			expectedVisited:  &data.Visited{M: make(map[string]bool)},
+			expectedNode:     &data.Response{Depth: 1, Title: "Success Web", URL: "https://www.successweb.com/home?source=card", Nodes: []*data.Response{}, Status: 200, FinalURL: "https://www.successweb.com/home?source=card", DuplicateOf: "https://www.successweb.com/home", DuplicateBy: data.DuplicateCanonical, Links: threeLinks},
+		},
+		{
+			name:             "Success - Near duplicate expanded",
+			state:            successThreeLinksFinished,
+			maxDepth:         2,
+			dedup:            &MockDeduper{NearOf: "https://www.successweb.com/home"},
+			node:             &data.Response{Depth: 0, Title: "", URL: "https://www.successweb.com", Nodes: []*data.Response{}},
+			expectedChildren: []*data.Response{&link1node, &link2node, &link3node},
+			expectedVisited:  addVisited(&data.Visited{M: make(map[string]bool)}, link1, link2, link3),
+			expectedNode:     &data.Response{Depth: 0, Title: "Success Web", URL: "https://www.successweb.com", Nodes: []*data.Response{&link1node, &link2node, &link3node}, Status: 200, FinalURL: "https://www.successweb.com", NearDuplicateOf: "https://www.successweb.com/home", Similarity: 0.96875, Links: threeLinks},
+		},
+		{
+			name:             "Success - Near duplicate skipped",
+			state:            successThreeLinksFinished,
+			maxDepth:         2,
+			dedup:            &MockDeduper{NearOf: "https://www.successweb.com/home"},
+			skipNear:         true,
+			node:             &data.Response{Depth: 1, Title: "", URL: "https://www.successweb.com/home?ts=1", Nodes: []*data.Response{}},
+			expectedChildren: []*data.Response{},
+			expectedVisited:  &data.Visited{M: make(map[string]bool)},
+			expectedNode:     &data.Response{Depth: 1, Title: "Success Web", URL: "https://www.successweb.com/home?ts=1", Nodes: []*data.Response{}, Status: 200, FinalURL: "https://www.successweb.com/home?ts=1", NearDuplicateOf: "https://www.successweb.com/home", Similarity: 0.96875, Links: threeLinks},
+		},
+		{
+			name:             "Error - body not fully read",
+			state:            erroredBody,
+			maxDepth:         2,
+			node:             &data.Response{Depth: 0, Title: "", URL: "https://www.errorweb.com", Nodes: []*data.Response{}},
+			expectedChildren: []*data.Response{},
+			expectedVisited:  &data.Visited{M: make(map[string]bool)},
+			expectedNode:     &data.Response{Depth: 0, Title: "", URL: "https://www.errorweb.com", Nodes: []*data.Response{}, Status: 200, FinalURL: "https://www.errorweb.com/", ContentType: "text/html", ContentLength: 512, ResponseTime: 1500, Error: "unexpected EOF"},
 		},
 	}
 
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
 			m := MockCollector{State: tc.state}
-			w := worker.NewWorker(&m)
-
-			w.ChLinks = make(chan string)
-			w.ChErrors = make(chan error)
-			w.ChFinished = make(chan bool)
-			defer close(w.ChLinks)
-			defer close(w.ChErrors)
-			defer close(w.ChFinished)
+			opts := make([]worker.Option, 0)
+			if tc.robots != nil {
+				opts = append(opts, worker.WithRobots(tc.robots))
+			}
+			w := worker.NewWorker(&m, opts...)
 
-			q := make(chan []*data.Response)
 			v := data.Visited{M: make(map[string]bool)}
+			addVisited(&v, tc.visited...)
 
-			go w.Do(tc.node, tc.depth, q, &v)
-
-			values := <-q
+			crawl := &data.Crawl{MaxDepth: tc.maxDepth, MaxLinksPerPage: tc.maxLinksPerPage, Scope: tc.scope, Visited: &v, Dedup: tc.dedup, SkipNear: tc.skipNear}
+			w.Do(context.Background(), tc.node, crawl)
 
+			assert.Equal(tc.expectedLimits, crawl.LimitsHit(), tc.name)
 			assert.Equal(tc.expectedVisited.M, v.M, tc.name)
-			assert.Equal(tc.expectedQueueValues, values, tc.name)
+			assert.Equal(tc.expectedChildren, tc.node.Nodes, tc.name)
 			assert.Equal(tc.expectedNode, tc.node, tc.name)
 		})
 	}
 }
 
+func toLinks(urls ...string) []data.Link {
+	res := make([]data.Link, 0, len(urls))
+	for _, u := range urls {
+		res = append(res, data.Link{URL: u})
+	}
+	return res
+}
+
 func addVisited(v *data.Visited, links ...string) *data.Visited {
 	for _, s := range links {
 		v.M[s] = true